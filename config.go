@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadConfig sets flags from a config file made up of `flag-name = value` lines
+// Blank lines and lines starting with # are ignored, and flags that may be repeated can be given more than once
+// Anything already set on the command line wins over the file
+func loadConfig(path string, flags *flag.FlagSet) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	setOnCommandLine := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return fmt.Errorf("%s:%d: expected flag-name = value", path, lineNumber)
+		}
+		name := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+
+		if flags.Lookup(name) == nil {
+			return fmt.Errorf("%s:%d: unknown flag %q", path, lineNumber, name)
+		}
+		if setOnCommandLine[name] {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// environmentPrefix is prepended to a flag's name to find its environment variable,
+// e.g. -path-style can be set with MEDIAAUDIT_PATH_STYLE
+const environmentPrefix string = "MEDIAAUDIT_"
+
+// environmentName returns the environment variable that sets the named flag
+func environmentName(flagName string) string {
+	return environmentPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadEnvironment sets flags from MEDIAAUDIT_* environment variables
+// Flags that may be repeated take one value per line
+// Anything already set on the command line wins over the environment
+func loadEnvironment(flags *flag.FlagSet) error {
+	setOnCommandLine := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(environmentName(f.Name))
+		if !ok || setOnCommandLine[f.Name] || err != nil {
+			return
+		}
+
+		values := []string{value}
+		if _, repeatable := f.Value.(*stringList); repeatable {
+			values = strings.Split(value, "\n")
+		}
+		for _, v := range values {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			if setErr := flags.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("%s: %w", environmentName(f.Name), setErr)
+				return
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"gitlab.com/sheckler/mediaaudit/pkg/mediaaudit"
+)
+
+// genFixtures implements the gen-fixtures subcommand, writing the synthetic test corpus to a directory
+func genFixtures(args []string) {
+	flags := flag.NewFlagSet("gen-fixtures", flag.ExitOnError)
+	duration := flags.Duration("duration", 2*time.Second, "How long each fixture is")
+	list := flags.Bool("list", false, "List the fixtures and what each covers instead of generating them")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s gen-fixtures [flags] <directory>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	logger := newCLILogger(os.Stderr, mediaaudit.LevelInfo, logFormatText)
+	if *list {
+		for _, fixture := range mediaaudit.Fixtures {
+			fmt.Printf("%s\t%s\n", fixture.Name, fixture.Description)
+		}
+		return
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	written, err := mediaaudit.GenerateFixtures(context.Background(), flags.Arg(0), *duration)
+	for _, path := range written {
+		fmt.Println(path)
+	}
+	if err != nil {
+		logger.Fatalf("%s", err.Error())
+	}
+}
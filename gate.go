@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gitlab.com/sheckler/mediaaudit/pkg/mediaaudit"
+)
+
+// exitAuditFailed is the exit status when -fail-if or -fail-on-violations trips
+const exitAuditFailed int = 3
+
+// auditGate watches the reports and failures a scan produces, to decide whether the library passes
+// Failures are passed on to next, if set
+type auditGate struct {
+	conditions        []*mediaaudit.Condition
+	failOnViolations  bool
+	next              mediaaudit.FailureWriter
+	violatingReports  int
+	violationsExample string
+	probeFailures     int
+}
+
+func (g *auditGate) Write(report *mediaaudit.Report) error {
+	for _, condition := range g.conditions {
+		condition.Add(report)
+	}
+	if violations := report.Violations(); len(violations) > 0 {
+		if g.violatingReports == 0 {
+			g.violationsExample = fmt.Sprintf("%s (%s)", report.Name, strings.Join(violations, ", "))
+		}
+		g.violatingReports++
+	}
+	return nil
+}
+
+func (g *auditGate) WriteFailure(failure *mediaaudit.Failure) error {
+	// A file still being written isn't broken, it'll be checked next time
+	if failure.Status != mediaaudit.FailureInUse && failure.Status != mediaaudit.FailureLocked {
+		g.probeFailures++
+	}
+	if g.next != nil {
+		return g.next.WriteFailure(failure)
+	}
+	return nil
+}
+
+func (g *auditGate) Close() error {
+	return nil
+}
+
+// reasons explains why the library failed the audit, empty if it passed
+func (g *auditGate) reasons() []string {
+	var reasons []string
+	for _, condition := range g.conditions {
+		if condition.Met() {
+			reasons = append(reasons, fmt.Sprintf("-fail-if %q is true, the value is %g", condition.String(), condition.Value()))
+		}
+	}
+	if g.failOnViolations {
+		if g.violatingReports > 0 {
+			reasons = append(reasons, fmt.Sprintf("%d files have violations, e.g. %s", g.violatingReports, g.violationsExample))
+		}
+		if g.probeFailures > 0 {
+			reasons = append(reasons, fmt.Sprintf("%d files couldn't be probed", g.probeFailures))
+		}
+	}
+	return reasons
+}
+
+// audioGate applies -fail-on-violations to -audio-library scans, where a lossy hint on a lossless file is the violation
+type audioGate struct {
+	mediaaudit.AudioWriter
+	gate *auditGate
+}
+
+func (g *audioGate) Write(report *mediaaudit.AudioReport) error {
+	if report.LossyHint != "" && report.LossyHint != mediaaudit.LossyHintNone {
+		if g.gate.violatingReports == 0 {
+			g.gate.violationsExample = fmt.Sprintf("%s (LossyHint %s)", report.Name, report.LossyHint)
+		}
+		g.gate.violatingReports++
+	}
+	return g.AudioWriter.Write(report)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gitlab.com/sheckler/mediaaudit/pkg/mediaaudit"
+)
+
+// Goals the init wizard can set up for
+const (
+	goalStreaming string = "streaming" // A library played through Plex, Jellyfin or the like, which should direct play
+	goalArchive   string = "archive"   // Long term storage, which should above all still be intact
+)
+
+// starterSpecs are the delivery specs the init wizard writes, one per goal
+const starterSpecs string = `# Starter delivery specs, see the README's Delivery specs section for every setting
+
+# Direct plays on most clients without transcoding
+[streaming]
+container = MPEG-4, Matroska
+codec = AVC, HEVC, AV1
+
+# Open or widely supported containers and codecs that will still play in years to come
+[archive]
+container = Matroska, MPEG-4, MXF
+codec = AVC, HEVC, AV1, VP9, FFV1, ProRes, MPEG Video
+`
+
+// wizard asks its questions on out and reads the answers from in
+type wizard struct {
+	in   *bufio.Reader
+	out  io.Writer
+	done bool // Whether in has run out of answers
+}
+
+// ask asks question, returning the answer, or fallback if it's left blank
+func (w *wizard) ask(question, fallback string) string {
+	if fallback != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, fallback)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	line, err := w.in.ReadString('\n')
+	w.done = err != nil
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return fallback
+}
+
+// choose asks question until the answer is one of choices, the first being the default
+func (w *wizard) choose(question string, choices ...string) string {
+	for {
+		answer := strings.ToLower(w.ask(fmt.Sprintf("%s (%s)", question, strings.Join(choices, "/")), choices[0]))
+		for _, choice := range choices {
+			if answer == choice || (len(answer) == 1 && strings.HasPrefix(choice, answer)) {
+				return choice
+			}
+		}
+		fmt.Fprintf(w.out, "Please answer %s\n", strings.Join(choices, " or "))
+	}
+}
+
+// detectTool reports whether name is on the PATH, and where it is along with its version,
+// the first line of its version output with a number in it, less any copyright notice
+func detectTool(name string, versionArgs ...string) (string, bool) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", false
+	}
+	output, _ := exec.Command(path, versionArgs...).CombinedOutput()
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.ContainsAny(line, "0123456789") {
+			version := strings.TrimSpace(strings.SplitN(line, " Copyright", 2)[0])
+			return fmt.Sprintf("%s, %s", path, version), true
+		}
+	}
+	return path, true
+}
+
+// runInit implements the init subcommand, asking about the library and writing a starter config and specs
+func runInit(args []string) {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	configPath := flags.String("config", "mediaaudit.conf", "Where to write the config")
+	specsPath := flags.String("spec-file", "mediaaudit-specs.conf", "Where to write the delivery specs the config checks against")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s init [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	logger := newCLILogger(os.Stderr, mediaaudit.LevelInfo, logFormatText)
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+
+	// mediainfo does the probing, and ffmpeg everything that needs decoding
+	mediainfo, haveMediainfo := detectTool("mediainfo", "--Version")
+	ffmpeg, haveFFmpeg := detectTool("ffmpeg", "-version")
+	if haveMediainfo {
+		fmt.Fprintf(w.out, "Found mediainfo: %s\n", mediainfo)
+	} else {
+		fmt.Fprintln(w.out, "mediainfo isn't on your PATH, install it before scanning, nothing can be probed without it")
+	}
+	if haveFFmpeg {
+		fmt.Fprintf(w.out, "Found ffmpeg: %s\n", ffmpeg)
+	} else {
+		fmt.Fprintln(w.out, "ffmpeg isn't on your PATH, so checks that decode files are left out")
+	}
+	fmt.Fprintln(w.out)
+
+	var roots []string
+	for len(roots) == 0 {
+		if w.done {
+			logger.Fatalf("Setup cancelled")
+		}
+		for _, root := range strings.Split(w.ask("Library folders to audit, comma separated", ""), ",") {
+			if root = strings.TrimSpace(root); root == "" {
+				continue
+			}
+			if info, err := os.Stat(root); err != nil || !info.IsDir() {
+				fmt.Fprintf(w.out, "%q isn't a folder\n", root)
+				roots = nil
+				break
+			}
+			roots = append(roots, root)
+		}
+	}
+
+	goal := w.choose("Is the library for streaming or an archive", goalStreaming, goalArchive)
+	audioLanguages := w.ask("Languages every file needs audio in, comma separated ISO 639-2 codes like eng, or blank for none", "")
+	subtitleLanguages := w.ask("Languages every file needs subtitles in, or blank for none", "")
+	gate := w.choose("Exit with an error when a file fails a check, for cron jobs and CI", "no", "yes") == "yes"
+
+	absSpecs, err := filepath.Abs(*specsPath)
+	if err != nil {
+		logger.Fatalf("%s", err.Error())
+	}
+
+	var config strings.Builder
+	fmt.Fprintf(&config, "# Written by mediaaudit init on %s for %s\n", time.Now().Format("2006-01-02"), strings.Join(roots, ", "))
+	fmt.Fprintf(&config, "# Every setting is a flag, see mediaaudit -help\n\n")
+	fmt.Fprintf(&config, "spec-file = %s\nspec = %s\n", absSpecs, goal)
+	if audioLanguages != "" {
+		fmt.Fprintf(&config, "audio-languages = %s\n", audioLanguages)
+	}
+	if subtitleLanguages != "" {
+		fmt.Fprintf(&config, "subtitle-languages = %s\n", subtitleLanguages)
+	}
+	switch goal {
+	case goalStreaming:
+		// Plex and Jellyfin only find files named their way
+		fmt.Fprintf(&config, "check-naming = true\ncheck-aspect-ratio = true\n")
+	case goalArchive:
+		// Bit rot is what an archive has to worry about, so check everything can still be read
+		if haveFFmpeg {
+			fmt.Fprintf(&config, "verify = %s\n", mediaaudit.VerifyDecode)
+		} else {
+			fmt.Fprintf(&config, "verify = %s\n", mediaaudit.VerifyStructure)
+		}
+		fmt.Fprintf(&config, "retries = 2\n")
+	}
+	fmt.Fprintf(&config, "report-card = true\n")
+	if gate {
+		fmt.Fprintf(&config, "fail-on-violations = true\n")
+	}
+
+	for _, file := range []struct{ path, contents string }{
+		{*configPath, config.String()},
+		{*specsPath, starterSpecs},
+	} {
+		if _, err := os.Stat(file.path); err == nil && w.choose(fmt.Sprintf("%s already exists, overwrite it", file.path), "no", "yes") != "yes" {
+			fmt.Fprintf(w.out, "Left %s as it was\n", file.path)
+			continue
+		}
+		if err := os.WriteFile(file.path, []byte(file.contents), 0644); err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		fmt.Fprintf(w.out, "Wrote %s\n", file.path)
+	}
+
+	fmt.Fprintln(w.out, "\nRun an audit with:")
+	for _, root := range roots {
+		fmt.Fprintf(w.out, "  %s -config %s %q\n", os.Args[0], *configPath, root)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gitlab.com/sheckler/mediaaudit/pkg/mediaaudit"
+)
+
+// Log formats
+const (
+	logFormatText string = "text"
+	logFormatJSON string = "json"
+)
+
+// cliLogger writes leveled log messages as text or JSON lines, dropping anything below its level
+// It's kept separate from the report output, which always goes to stdout
+type cliLogger struct {
+	lock   sync.Mutex
+	out    io.Writer
+	level  mediaaudit.LogLevel
+	format string
+}
+
+func newCLILogger(out io.Writer, level mediaaudit.LogLevel, format string) *cliLogger {
+	return &cliLogger{out: out, level: level, format: format}
+}
+
+func (l *cliLogger) Log(level mediaaudit.LogLevel, path string, message string) {
+	if level < l.level {
+		return
+	}
+	now := time.Now()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.format == logFormatJSON {
+		entry := struct {
+			Time    string `json:"time"`
+			Level   string `json:"level"`
+			Path    string `json:"path,omitempty"`
+			Message string `json:"msg"`
+		}{now.Format(time.RFC3339), level.String(), path, message}
+		line, _ := json.Marshal(entry)
+		l.out.Write(append(line, '\n'))
+		return
+	}
+	fmt.Fprintf(l.out, "%s %-5s %s\n", now.Format("2006/01/02 15:04:05"), level.String(), message)
+}
+
+func (l *cliLogger) Infof(format string, args ...interface{}) {
+	l.Log(mediaaudit.LevelInfo, "", fmt.Sprintf(format, args...))
+}
+
+func (l *cliLogger) Warnf(format string, args ...interface{}) {
+	l.Log(mediaaudit.LevelWarn, "", fmt.Sprintf(format, args...))
+}
+
+func (l *cliLogger) Errorf(format string, args ...interface{}) {
+	l.Log(mediaaudit.LevelError, "", fmt.Sprintf(format, args...))
+}
+
+// Fatalf logs an error and exits, these are always logged whatever the level
+func (l *cliLogger) Fatalf(format string, args ...interface{}) {
+	l.Log(mediaaudit.LevelError, "", fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
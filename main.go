@@ -3,104 +3,772 @@ package main
 import (
 	"context"
 	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
-	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
-	"sync"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"golang.org/x/sync/semaphore"
+	"gitlab.com/sheckler/mediaaudit/pkg/mediaaudit"
 )
 
-const mediainfoTemplate string = `General;%OverallBitRate%,
-Video;%Format%,%Width%,%Height%,%BitRate_Maximum%,%BitRate%,%BitRate_Nominal%`
-
 var (
-	maxSem int64 = 150 // A sane value to avoid hitting file open limits
-
-	videoFileRegex    *regexp.Regexp = regexp.MustCompile(`\.mp4$|\.mkv$|\.avi$|\.mov$`)
-	subtitleFileRegex *regexp.Regexp = regexp.MustCompile(`\.srt$|\.idx$|\.sub$`)
-
 	outputFile io.Writer = os.Stdout
+
+	noPager   bool // Don't send table output through a pager
+	fullWidth bool // Don't truncate table output to the terminal width
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "gen-fixtures" {
+		genFixtures(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		runInit(os.Args[2:])
+		return
+	}
+
+	scanner := &mediaaudit.Scanner{
+		Concurrency: mediaaudit.DefaultConcurrency,
+		PathStyle:   mediaaudit.PathStyleBasename,
+	}
+
+	videoExtensions := flag.String("extensions", strings.Join(mediaaudit.DefaultVideoExtensions, ","), "Comma separated list of extensions of files to probe")
+	flag.BoolVar(&scanner.EstimateCommercials, "commercials", false, "Decode every file with ffmpeg to estimate what percentage of it is commercials, for DVR recordings")
+	tsProgram := flag.Int("ts-program", 0, "For transport streams with more than one program, the program number to report, e.g. a DVR recording's subchannel, the first if 0")
+	tsPID := flag.Int("ts-pid", 0, "For transport streams, the PID of the video stream to report, overrides -ts-program")
+	flag.BoolVar(&scanner.Sniff, "sniff", false, "Also probe files with other extensions if their content looks like a video container, e.g. misnamed or .webm, .ts and .wmv files")
+	sample := flag.String("sample", "", "Only probe a random but reproducible subset of files, e.g. 5% or 500, and print estimates for the whole tree")
+	sampleSeed := flag.Int64("sample-seed", mediaaudit.DefaultSampleSeed, "With -sample, which files are chosen, the same seed always chooses the same files from the same tree")
+	sampleCount := flag.Int("sample-count", 0, "Only probe this many randomly chosen files, the same as -sample with a number")
+	shard := flag.String("shard", "", "Only scan one deterministic subset of the tree, e.g. 2/8 for the second of eight, so separate runs can split the work")
+	flag.BoolVar(&scanner.DeferLocked, "defer-locked", false, "Leave files another program has locked until the end of the scan, and skip them if they're still locked")
+	flag.DurationVar(&scanner.SettleTime, "settle", 0, "Leave files modified less than this long ago, e.g. 5m, until the end of the scan, and skip them if they're still being written")
+	flag.DurationVar(&scanner.ProbeTimeout, "probe-timeout", 0, "Kill mediainfo and record the file as timed out if probing it takes longer than this, e.g. 60s")
+	flag.BoolVar(&scanner.Sandbox, "sandbox", false, "Run mediainfo and ffmpeg without network access in their own namespaces, as they parse untrusted files (Linux only)")
+	flag.Int64Var(&scanner.MaxProcesses, "max-processes", 0, "How many mediainfo and ffmpeg processes can run at once, others wait their turn, unlimited if 0")
+	var maxMemory byteSize
+	flag.Var(&maxMemory, "max-memory", "Memory limit for each mediainfo and ffmpeg process, e.g. 2G, unlimited if 0 (Linux only, and only advisory unless prlimit is installed)")
+	flag.IntVar(&scanner.Retries, "retries", 0, "How many more times to probe a file that failed before giving up, for flaky network mounts")
+	flag.DurationVar(&scanner.RetryBackoff, "retry-backoff", mediaaudit.DefaultRetryBackoff, "How long to wait before the first retry, doubling with each one and randomly jittered")
+	flag.StringVar(&scanner.Verify, "verify", mediaaudit.VerifyNone, "How thoroughly to check files for corruption: none, structure or decode")
+	flag.IntVar(&scanner.DecodeSegments, "decode-segments", 0, "With -verify decode, how many evenly spaced segments to decode instead of the whole file")
+	flag.DurationVar(&scanner.DecodeSegmentLength, "decode-segment-length", 10*time.Second, "With -verify decode, how long each sampled segment is")
+	flag.BoolVar(&scanner.IdetProbe, "idet", false, "Use ffmpeg's idet filter to detect interlacing when mediainfo reports an ambiguous scan type")
+	flag.BoolVar(&noPager, "no-pager", false, "Print the table directly instead of through $PAGER when writing to a terminal")
+	flag.BoolVar(&fullWidth, "full-width", false, "Don't truncate long names to fit the terminal when writing to a terminal")
+	flag.BoolVar(&scanner.CheckNFO, "check-nfo", false, "Compare each file's codec, resolution and duration to the stream details in its Kodi .nfo")
+	flag.BoolVar(&scanner.CheckNaming, "check-naming", false, "Check file and folder names against Plex/Jellyfin conventions, e.g. Movie (2010)/Movie (2010).mkv")
+	flag.BoolVar(&scanner.CheckAspectRatio, "check-aspect-ratio", false, "Check each file's display aspect ratio agrees with its stored dimensions and pixel aspect ratio")
+	maxRatings := flag.String("max-rating", "", "Comma separated list of restricted folders and the highest content rating allowed in each, e.g. Kids=PG,Teens=PG-13, read from each file's .nfo")
+	specFile := flag.String("spec-file", "", "Check every file against a delivery spec from this file, filling in the Spec column")
+	specName := flag.String("spec", "", "Which spec in -spec-file to check against, may be left out if it only has one")
+	aspectRatios := flag.String("aspect-ratios", "", "Comma separated list of display aspect ratios, e.g. 16:9,2.39, files are expected to have, implies -check-aspect-ratio")
+	referencesPath := flag.String("references", "", "CSV of encoded file, reference file pairs to score encodes against with ffmpeg")
+	flag.StringVar(&scanner.QualityMetric, "quality-metric", mediaaudit.QualityVMAF, "With -references, how to score encodes: vmaf or ssim")
+	flag.Int64Var(&scanner.QualityConcurrency, "quality-concurrency", mediaaudit.DefaultQualityConcurrency, "With -verify decode, -references or any of the analyses that decode files, like -commercials or -check-frames, how many files to decode at once")
+	audioLanguages := flag.String("audio-languages", "", "Comma separated list of ISO 639-2 languages, e.g. eng,jpn, that every file must have an audio track in")
+	flag.BoolVar(&scanner.RequireCaptions, "require-captions", false, "Flag files without embedded CEA-608 or CEA-708 closed captions")
+	subtitleLanguages := flag.String("subtitle-languages", "", "Comma separated list of ISO 639-2 languages, e.g. eng, that every file must have embedded or sidecar subtitles in")
+	flag.StringVar(&scanner.PathStyle, "path-style", scanner.PathStyle, "How to name files in the output: relative, absolute or basename")
+	var plugins stringList
+	flag.Var(&plugins, "plugin", "Program that adds extra columns to the report, may be repeated")
+	var fields stringList
+	flag.Var(&fields, "field", "Extra mediainfo parameter to add as a column, e.g. 'Video;%Encoded_Library_Settings%', may be repeated")
+	columns := flag.String("columns", "", "Comma separated list of columns to output, in order, e.g. Name,Codec,Height, every column if empty")
+	groupParts := flag.Bool("group-parts", false, "Report each multi-part release, e.g. Movie - cd1.avi and Movie - cd2.avi, as a single row once the scan finishes")
+	var failIf stringList
+	flag.Var(&failIf, "fail-if", "Exit with status 3 if this aggregate over the report is true, e.g. 'count(BitrateMbps < 1) > 0', may be repeated")
+	failOnViolations := flag.Bool("fail-on-violations", false, "Exit with status 3 if any file fails a check or couldn't be probed")
+	filterExpression := flag.String("filter", "", "Only output files matching this expression, e.g. 'Height >= 1080 && BitrateMbps < 3 && Codec != \"HEVC\"'")
+	auditAssets := flag.Bool("audit-assets", false, "Instead of probing files, report movie, show and season folders missing Plex/Jellyfin artwork or theme songs")
+	audioLibrary := flag.Bool("audio-library", false, "Instead of video files, probe music files and report their codec, bitrate, sample rate, bit depth and channels")
+	audioExtensions := flag.String("audio-extensions", strings.Join(mediaaudit.DefaultAudioExtensions, ","), "With -audio-library, comma separated list of extensions of files to probe")
+	flag.BoolVar(&scanner.LossyHints, "lossy-hints", false, "With -audio-library, check lossless files for the spectral cutoff left by a lossy source, with ffmpeg")
+	dryRun := flag.Bool("dry-run", false, "List what would be scanned, and what would be skipped, without probing anything")
+	checkpointPath := flag.String("checkpoint", "", "File recording finished files, so an interrupted scan can be resumed by running it again with the same checkpoint")
+	flag.StringVar(&scanner.Order, "order", "", "Which files to probe first: walk, newest-first, largest-first, never-scanned-first or random, walk by default")
+	historyPath := flag.String("history", "", "File recording every file ever scanned, kept between runs, for -order never-scanned-first")
+	maxDuration := flag.Duration("max-duration", 0, "With -checkpoint, stop starting new probes after this long, e.g. 2h, newest files first, leaving the rest for the next run")
+	errorsOut := flag.String("errors-out", "", "Write every file that couldn't be probed, and why, to this CSV file")
+	production := flag.Bool("production", false, "For production storage, fill in each file's Project folder and Class, camera-original, proxy or deliverable, and print the space each class takes per project to stderr once the scan finishes")
+	retentionPath := flag.String("retention", "", "File of retention rules, e.g. keep 5 episodes per show or news for 7 days, to print a deletion plan for to stderr once the scan finishes")
+	applyRetention := flag.Bool("apply-retention", false, "With -retention, delete the files in the plan, only after a complete scan")
+	trailingData := flag.Bool("trailing-data", false, "Walk each file's container for padding or junk after its logical end, in the TrailingMB column, and print to stderr a plan to truncate it once the scan finishes")
+	truncateTrailing := flag.Bool("truncate-trailing", false, "With -trailing-data, truncate the files in the plan")
+	flag.BoolVar(&scanner.DetectDropouts, "audio-dropouts", false, "Decode each file with ffmpeg to find where the audio drops out while the picture carries on, a sign of a broken mux")
+	flag.BoolVar(&scanner.CheckFrames, "check-frames", false, "Sample each file with ffmpeg for black, frozen and corrupt frames, flagging recordings that decode but can't be watched")
+	flag.BoolVar(&scanner.EstimateGrain, "grain", false, "Sample each file with ffmpeg to estimate how much film grain or noise it has, in the GrainLevel column")
+	bitrateModel := flag.Bool("bitrate-model", false, "Measure each file's complexity with ffmpeg, and once the scan finishes print to stderr the files with far less bitrate than a model fitted to the library expects")
+	reportCard := flag.Bool("report-card", false, "Once the scan finishes, print to stderr letter grades for the library's integrity, policy compliance, naming, subtitle coverage and duplicate waste, with the top 5 things to fix")
+	licensingSummary := flag.Bool("licensing-summary", false, "Once the scan finishes, print to stderr how many files and how much space each codec licensing family accounts for")
+	influxURL := flag.String("influx-url", "", "Push scan metrics in line protocol to this InfluxDB write URL, e.g. http://localhost:8086/api/v2/write?org=home&bucket=media")
+	influxToken := flag.String("influx-token", "", "With -influx-url, the API token to send")
+	influxFiles := flag.Bool("influx-files", false, "With -influx-url, push a point for every file as well as the totals")
+	quiet := flag.Bool("quiet", false, "Only log errors")
+	verbose := flag.Bool("verbose", false, "Log debugging detail, like every file as it's probed")
+	logFormat := flag.String("log-format", logFormatText, "Log format: text or json")
+	logFile := flag.String("log-file", "", "Append logs to this file instead of stderr")
+	configPath := flag.String("config", "", "File of flag-name = value lines to read flags from, the command line takes precedence")
+	presetName := flag.String("preset", "", fmt.Sprintf("Bundle of checks, columns and output settings for a common kind of library, one of %s, anything else set overrides it", strings.Join(presetNames(), ", ")))
+	flag.Parse()
+
+	// Until we know how the user wants logs, errors go to stderr
+	logger := newCLILogger(os.Stderr, mediaaudit.LevelInfo, logFormatText)
+	if err := loadEnvironment(flag.CommandLine); err != nil {
+		logger.Fatalf("%s", err.Error())
+	}
+	if *configPath != "" {
+		if err := loadConfig(*configPath, flag.CommandLine); err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+	}
+
+	// A preset's columns leave out any extra ones, unless they're added back here
+	presetColumns := false
+	if *presetName != "" {
+		set, err := applyPreset(*presetName, flag.CommandLine)
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		for _, name := range set {
+			presetColumns = presetColumns || name == "columns"
+		}
+	}
+
+	if *logFormat != logFormatText && *logFormat != logFormatJSON {
+		logger.Fatalf("Unknown log format %q, expected text or json", *logFormat)
+	}
+	logger.format = *logFormat
+	switch {
+	case *quiet:
+		logger.level = mediaaudit.LevelError
+	case *verbose:
+		logger.level = mediaaudit.LevelDebug
+	}
+	if *logFile != "" {
+		file, err := os.OpenFile(*logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		defer file.Close()
+		logger.out = file
+	}
+	scanner.Logger = logger
+
+	scanner.VideoExtensions = splitList(*videoExtensions)
+	scanner.AudioExtensions = splitList(*audioExtensions)
+	scanner.MaxMemory = uint64(maxMemory)
+	scanner.RequiredAudioLanguages = splitList(*audioLanguages)
+	scanner.RequiredSubtitleLanguages = splitList(*subtitleLanguages)
+	for _, value := range splitList(*aspectRatios) {
+		ratio, err := mediaaudit.ParseAspectRatio(value)
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		scanner.AspectRatios = append(scanner.AspectRatios, ratio)
+	}
+	if *maxRatings != "" {
+		var err error
+		if scanner.RatingLimits, err = mediaaudit.ParseRatingLimits(*maxRatings); err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+	}
+	if *specFile != "" {
+		var err error
+		if scanner.Spec, err = mediaaudit.LoadDeliverySpec(*specFile, *specName); err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+	} else if *specName != "" {
+		// Without a file, the spec is one of those mediaaudit init writes
+		var err error
+		if scanner.Spec, err = mediaaudit.ReadDeliverySpec(strings.NewReader(starterSpecs), "The built-in set of specs", *specName); err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+	}
+
 	// Get our directory to traverse
-	dirPath := os.Args[1]
+	dirPath, fromEnvironment := os.LookupEnv(environmentPrefix + "DIRECTORY")
+	switch {
+	case flag.NArg() == 1:
+		dirPath = flag.Arg(0)
+	case flag.NArg() != 0 || !fromEnvironment:
+		logger.Fatalf("Usage: %s [flags] <directory>", os.Args[0])
+	}
+
+	switch scanner.Verify {
+	case mediaaudit.VerifyNone, mediaaudit.VerifyStructure, mediaaudit.VerifyDecode:
+	default:
+		logger.Fatalf("Unknown verification level %q, expected none, structure or decode", scanner.Verify)
+	}
+
+	switch scanner.PathStyle {
+	case mediaaudit.PathStyleRelative, mediaaudit.PathStyleAbsolute, mediaaudit.PathStyleBasename:
+	default:
+		logger.Fatalf("Unknown path style %q, expected one of relative, absolute or basename", scanner.PathStyle)
+	}
+
+	switch scanner.QualityMetric {
+	case mediaaudit.QualityVMAF, mediaaudit.QualitySSIM:
+	default:
+		logger.Fatalf("Unknown quality metric %q, expected vmaf or ssim", scanner.QualityMetric)
+	}
+
+	if *referencesPath != "" {
+		var err error
+		if scanner.References, err = mediaaudit.LoadReferences(*referencesPath); err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		logger.Infof("Scoring %d encodes against their references with %s", scanner.References.Len(), scanner.QualityMetric)
+	}
+
+	if *shard != "" {
+		var err error
+		if scanner.Shard, err = mediaaudit.ParseShard(*shard); err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+	}
+
+	switch {
+	case *sample != "" && *sampleCount != 0:
+		logger.Fatalf("Only one of -sample and -sample-count can be set")
+	case *sample != "":
+		var err error
+		if scanner.Sample, err = mediaaudit.ParseSample(*sample); err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+	case *sampleCount < 0:
+		logger.Fatalf("Invalid -sample-count %d, expected a number of files", *sampleCount)
+	case *sampleCount > 0:
+		scanner.Sample = &mediaaudit.Sample{Count: *sampleCount}
+	}
+	if scanner.Sample != nil {
+		scanner.Sample.Seed = *sampleSeed
+	}
+
+	if *maxDuration > 0 {
+		if *checkpointPath == "" {
+			logger.Fatalf("-max-duration needs -checkpoint, to carry the files it doesn't get to over to the next run")
+		}
+		if scanner.Order == "" {
+			scanner.Order = mediaaudit.OrderNewestFirst
+		}
+	}
+	if err := mediaaudit.ValidOrder(scanner.Order); err != nil {
+		logger.Fatalf("%s", err.Error())
+	}
+	if scanner.Order == mediaaudit.OrderNeverScannedFirst && *historyPath == "" {
+		logger.Fatalf("-order %s needs -history, to know which files have been scanned before", scanner.Order)
+	}
+	if *historyPath != "" {
+		var err error
+		if scanner.History, err = mediaaudit.OpenCheckpoint(*historyPath); err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		defer scanner.History.Close()
+	}
+
+	if *auditAssets {
+		reports, err := mediaaudit.AuditAssets(dirPath)
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		writer := csv.NewWriter(outputFile)
+		writer.Write(mediaaudit.AssetReportHeaders)
+		for _, report := range reports {
+			writer.Write(report.ToSlice())
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		return
+	}
+
+	// Conditions, filters and the summaries printed once the scan finishes are over the video columns,
+	// so there's nothing for them to work with in a music library
+	if *audioLibrary {
+		if len(failIf) > 0 {
+			logger.Fatalf("-fail-if doesn't apply to -audio-library, use -fail-on-violations")
+		}
+		videoOnly := []struct {
+			flag string
+			set  bool
+		}{
+			{"-filter", *filterExpression != ""},
+			{"-columns", *columns != ""},
+			{"-no-pager", noPager},
+			{"-full-width", fullWidth},
+			{"-field", len(fields) > 0},
+			{"-plugin", len(plugins) > 0},
+			{"-group-parts", *groupParts},
+			{"-retention", *retentionPath != ""},
+			{"-trailing-data", *trailingData},
+			{"-bitrate-model", *bitrateModel},
+			{"-report-card", *reportCard},
+			{"-licensing-summary", *licensingSummary},
+			{"-production", *production},
+			{"-sample", *sample != ""},
+			{"-sample-count", *sampleCount > 0},
+		}
+		for _, option := range videoOnly {
+			if option.set {
+				logger.Fatalf("%s doesn't apply to -audio-library, music files are reported as CSV with their own columns", option.flag)
+			}
+		}
+	}
+
+	if *dryRun {
+		planFiles := scanner.Plan
+		if *audioLibrary {
+			planFiles = scanner.PlanAudio
+		}
+		plan, err := planFiles(context.Background(), dirPath)
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		for _, path := range plan.Skipped {
+			fmt.Fprintf(outputFile, "Would skip: %s\n", path)
+		}
+		fmt.Fprintf(outputFile, "Would scan %d files, %.2f GiB", len(plan.Files), float64(plan.Bytes)/(1<<30))
+		if plan.UniqueBytes != plan.Bytes {
+			fmt.Fprintf(outputFile, ", %.2f GiB counting hardlinked files once", float64(plan.UniqueBytes)/(1<<30))
+		}
+		fmt.Fprintln(outputFile)
+		return
+	}
+
+	var failures *mediaaudit.CSVFailureWriter
+	if *errorsOut != "" {
+		file, err := os.Create(*errorsOut)
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		defer file.Close()
+		failures = mediaaudit.NewCSVFailureWriter(file)
+		scanner.Failures = failures
+	}
+
+	// The conditions are added once the extra columns are known
+	var gate *auditGate
+	if len(failIf) > 0 || *failOnViolations {
+		gate = &auditGate{failOnViolations: *failOnViolations}
+		if failures != nil {
+			gate.next = failures
+		}
+		scanner.Failures = gate
+	}
 
-	// Mediainfo cannot handle a template that grabs from more than one section as a commandline argument
-	// However, it supports multi-section templates when read in from a file
-	// Writing the template to file means we can avoid calling mediainfo
-	// more than once for a given file, so while this is gross, it's notably faster
-	templateTempFile, err := ioutil.TempFile("", "mediaauditTemplate")
+	resumed := false
+	if *checkpointPath != "" {
+		var err error
+		scanner.Checkpoint, err = mediaaudit.OpenCheckpoint(*checkpointPath)
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		if done := scanner.Checkpoint.Len(); done > 0 {
+			resumed = true
+			logger.Infof("Resuming from %q, skipping %d files already scanned", *checkpointPath, done)
+		}
+	}
+
+	if *audioLibrary {
+		backend, err := mediaaudit.NewAudioMediaInfo()
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		defer backend.Close()
+
+		writer := mediaaudit.NewCSVAudioWriter(outputFile)
+		var audioWriter mediaaudit.AudioWriter = writer
+		if gate != nil {
+			audioWriter = &audioGate{AudioWriter: writer, gate: gate}
+		}
+		interrupted, outOfTime := runScan(scanner, logger, *maxDuration, func(ctx context.Context) error {
+			return scanner.ScanAudio(ctx, dirPath, backend, audioWriter)
+		})
+		finishCheckpoint(scanner, logger, *checkpointPath, *maxDuration, interrupted, outOfTime)
+		if failures != nil {
+			if err := failures.Close(); err != nil {
+				logger.Errorf("%s", err.Error())
+			}
+		}
+		if err := writer.Close(); err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		exitForAudit(logger, gate, interrupted)
+		return
+	}
+
+	for _, plugin := range plugins {
+		extension, err := mediaaudit.NewExecExtension(context.Background(), plugin)
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		scanner.Extensions = append(scanner.Extensions, extension)
+	}
+
+	var extraFields []mediaaudit.ExtraField
+	for _, field := range fields {
+		extraField, err := mediaaudit.ParseExtraField(field)
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		extraFields = append(extraFields, extraField)
+	}
+
+	backend, err := mediaaudit.NewMediaInfo(extraFields...)
 	if err != nil {
-		log.Fatal(err)
+		logger.Fatalf("%s", err.Error())
 	}
-	defer os.Remove(templateTempFile.Name())
-	templateTempFile.WriteString(mediainfoTemplate)
-	templateTempFile.Close()
+	defer backend.Close()
+	backend.Program = *tsProgram
+	backend.PID = *tsPID
+	scanner.Backend = backend
 
-	var csvLock sync.Mutex
-	sem := semaphore.NewWeighted(maxSem)
+	if *filterExpression != "" {
+		scanner.Filter, err = mediaaudit.ParseFilter(*filterExpression, scanner.ExtraColumns())
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+	}
 
-	// Add a header to our CSV output
-	writer := csv.NewWriter(outputFile)
-	var headers []string
-	headers = append(headers, "Name")
-	headers = append(headers, reportHeaders...)
-	writer.Write(headers) // Don't bother flushing here, the goroutine will flush for us
+	selectedColumns := splitList(*columns)
+	if presetColumns {
+		selectedColumns = append(selectedColumns, scanner.ExtraColumns()...)
+	}
+	if err := mediaaudit.CheckColumns(scanner.ExtraColumns(), selectedColumns); err != nil {
+		logger.Fatalf("%s", err.Error())
+	}
 
-	// Traverse the given directory
-	filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		// Make sure we actually want to check the file
-		switch {
-		case err != nil:
-			log.Printf("Prevent panic by handling failure accessing a path %q: %v\n", path, err)
-			return err
-		case info.IsDir():
-			return nil
-		case subtitleFileRegex.MatchString(info.Name()):
-			return nil
-		case !videoFileRegex.MatchString(info.Name()):
-			// We're not sure what we're skipping here, so log to stderr
-			log.Printf("Skipping non-video file: %q\n", info.Name())
-			return nil
-		}
-
-		// Acquire a semaphore
-		sem.Acquire(context.TODO(), 1)
-		go func(path string, info os.FileInfo) {
-			defer sem.Release(1)
-			// Get the report from mediainfo
-			report, err := getReport(path, templateTempFile.Name())
-			if err != nil {
-				log.Println(err.Error())
-				return
+	// CSV is for machines, so give people at a terminal something readable instead
+	var writer mediaaudit.Writer
+	var pager *pager
+	if f, ok := outputFile.(*os.File); ok && isTerminal(f) {
+		out := outputFile
+		if !noPager {
+			if pager, err = startPager(outputFile); err == nil {
+				out = pager
+			} else {
+				// No usable pager, just print the table
+				pager = nil
 			}
+		}
+		table := mediaaudit.NewTableWriter(out, scanner.ExtraColumns(), terminalWidth(f), fullWidth)
+		table.SelectColumns(selectedColumns) // Already checked
+		writer = table
+	} else {
+		csvWriter := mediaaudit.NewCSVWriter(outputFile, scanner.ExtraColumns())
+		csvWriter.SelectColumns(selectedColumns) // Already checked
+		writer = csvWriter
+	}
 
-			// Calculate the size of the file
-			report.SizeMB = math.Round((float64(info.Size())/1048576)*100) / 100
-
-			// Add the entry to our output
-			var values []string
-			values = append(values, info.Name())
-			values = append(values, report.ToSlice()...)
-
-			// Now write it
-			csvLock.Lock()
-			defer csvLock.Unlock()
-			writer.Write(values)
-			writer.Flush()
-			if writer.Error() != nil {
-				log.Printf("Failed to flush writes to CSV when checking %q: %s\n", info.Name(), err.Error())
+	// Metrics are only sent for complete scans, so they're closed separately from the report
+	var metrics *mediaaudit.LineProtocolWriter
+	scanWriter := writer
+	if *influxURL != "" {
+		root, err := filepath.Abs(dirPath)
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		metrics = mediaaudit.NewLineProtocolWriter(*influxURL, *influxToken, root, *influxFiles)
+		scanWriter = mediaaudit.NewMultiWriter(writer, metrics)
+	}
+
+	var licensing *mediaaudit.LicensingWriter
+	if *licensingSummary {
+		licensing = mediaaudit.NewLicensingWriter(os.Stderr)
+		scanWriter = mediaaudit.NewMultiWriter(scanWriter, licensing)
+	}
+
+	var model *mediaaudit.BitrateModelWriter
+	if *bitrateModel {
+		scanner.MeasureComplexity = true
+		model = mediaaudit.NewBitrateModelWriter(os.Stderr)
+		scanWriter = mediaaudit.NewMultiWriter(scanWriter, model)
+	}
+
+	var card *mediaaudit.ReportCardWriter
+	if *reportCard {
+		card = mediaaudit.NewReportCardWriter(os.Stderr, scanner)
+		scanWriter = mediaaudit.NewMultiWriter(scanWriter, card)
+	}
+
+	var productionSummary *mediaaudit.ProductionWriter
+	if *production {
+		scanner.Production = true
+		productionSummary = mediaaudit.NewProductionWriter(os.Stderr)
+		scanWriter = mediaaudit.NewMultiWriter(scanWriter, productionSummary)
+	}
+
+	if gate != nil {
+		for _, expression := range failIf {
+			condition, err := mediaaudit.ParseCondition(expression, scanner.ExtraColumns())
+			if err != nil {
+				logger.Fatalf("%s", err.Error())
 			}
-		}(path, info)
-		return nil
+			gate.conditions = append(gate.conditions, condition)
+		}
+		scanWriter = mediaaudit.NewMultiWriter(scanWriter, gate)
+	}
+
+	// Parts are grouped before anything else sees them, so totals and conditions count titles
+	var grouper *mediaaudit.PartGrouper
+	if *groupParts {
+		grouper = mediaaudit.NewPartGrouper(scanWriter)
+		scanWriter = grouper
+	}
+
+	// Retention sees every part of a multi-part recording, since each one is a file to delete
+	var retention *mediaaudit.RetentionWriter
+	if *retentionPath != "" {
+		rules, err := mediaaudit.LoadRetentionRules(*retentionPath)
+		if err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+		retention = mediaaudit.NewRetentionWriter(dirPath, rules)
+		scanWriter = mediaaudit.NewMultiWriter(scanWriter, retention)
+	} else if *applyRetention {
+		logger.Fatalf("-apply-retention needs -retention")
+	}
+
+	// Totals count every part of a multi-part release, since each one is a file taking up space
+	var totals *mediaaudit.TotalsWriter
+	if !*quiet {
+		totals = mediaaudit.NewTotalsWriter(os.Stderr)
+		scanWriter = mediaaudit.NewMultiWriter(scanWriter, totals)
+	}
+
+	// Truncation sees every part of a multi-part release, since each one is a file to truncate
+	var truncation *mediaaudit.TruncationWriter
+	if *trailingData {
+		scanner.CheckTrailingData = true
+		truncation = mediaaudit.NewTruncationWriter()
+		scanWriter = mediaaudit.NewMultiWriter(scanWriter, truncation)
+	} else if *truncateTrailing {
+		logger.Fatalf("-truncate-trailing needs -trailing-data")
+	}
+
+	interrupted, outOfTime := runScan(scanner, logger, *maxDuration, func(ctx context.Context) error {
+		return scanner.Scan(ctx, dirPath, scanWriter)
 	})
 
-	// Wait for all goroutines to finish
-	sem.Acquire(context.TODO(), maxSem)
+	if grouper != nil {
+		if err := grouper.Flush(); err != nil {
+			logger.Errorf("%s", err.Error())
+		}
+	}
+
+	finishCheckpoint(scanner, logger, *checkpointPath, *maxDuration, interrupted, outOfTime)
+
+	if failures != nil {
+		if err := failures.Close(); err != nil {
+			logger.Errorf("%s", err.Error())
+		}
+	}
+	if metrics != nil {
+		if interrupted || outOfTime {
+			logger.Warnf("Not sending metrics for a partial scan")
+		} else if err := metrics.Close(); err != nil {
+			logger.Errorf("%s", err.Error())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		logger.Fatalf("%s", err.Error())
+	}
+	if pager != nil {
+		if err := pager.Close(); err != nil {
+			logger.Fatalf("%s", err.Error())
+		}
+	}
+
+	// Estimates go after the report, and to stderr so they don't end up in the CSV
+	if totals != nil {
+		if err := totals.Close(); err != nil {
+			logger.Errorf("%s", err.Error())
+		}
+	}
+	if scanner.Sample != nil {
+		if err := scanner.Sample.Summary().Write(os.Stderr); err != nil {
+			logger.Errorf("%s", err.Error())
+		}
+	}
+	if licensing != nil {
+		if err := licensing.Close(); err != nil {
+			logger.Errorf("%s", err.Error())
+		}
+	}
+	if productionSummary != nil {
+		if err := productionSummary.Close(); err != nil {
+			logger.Errorf("%s", err.Error())
+		}
+	}
+	if model != nil {
+		if err := model.Close(); err != nil {
+			logger.Errorf("%s", err.Error())
+		}
+	}
+	if card != nil {
+		if err := card.Close(); err != nil {
+			logger.Errorf("%s", err.Error())
+		}
+	}
+	if retention != nil {
+		plan := retention.Plan(time.Now())
+		if err := mediaaudit.WriteRetentionPlan(os.Stderr, plan); err != nil {
+			logger.Errorf("%s", err.Error())
+		}
+		if *applyRetention && (interrupted || outOfTime || resumed) {
+			// Unseen episodes only leave deletions out, but the plan is incomplete, so wait for a full scan before deleting anything
+			logger.Warnf("Not applying the retention plan after a partial scan")
+		} else if *applyRetention {
+			for _, deletion := range plan {
+				if err := os.Remove(deletion.Path); err != nil {
+					logger.Errorf("%s", err.Error())
+					continue
+				}
+				logger.Infof("Deleted %q: %s", deletion.Path, deletion.Reason)
+			}
+		}
+	}
+
+	if truncation != nil {
+		plan := truncation.Plan()
+		if err := mediaaudit.WriteTruncationPlan(os.Stderr, plan); err != nil {
+			logger.Errorf("%s", err.Error())
+		}
+		// Each file is checked again before it's truncated, so unlike retention a partial scan is fine
+		for _, file := range plan {
+			if !*truncateTrailing || file.Skipped != "" {
+				continue
+			}
+			if err := file.Apply(); err != nil {
+				logger.Errorf("%s", err.Error())
+				continue
+			}
+			logger.Infof("Truncated %d bytes of trailing data from %q", file.TrailingBytes, file.Path)
+		}
+	}
+
+	exitForAudit(logger, gate, interrupted)
+}
+
+// runScan runs scan until it finishes, the first SIGINT or SIGTERM, or the -max-duration budget runs out,
+// reporting which of the last two stopped it
+func runScan(scanner *mediaaudit.Scanner, logger *cliLogger, maxDuration time.Duration, scan func(ctx context.Context) error) (interrupted, outOfTime bool) {
+	// Stop starting new probes on the first signal, but let the running ones finish so nothing is half written
+	// A second signal gets the default behaviour and kills us outright
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	handlePauseSignals(ctx, scanner, logger)
+
+	// The time budget works like an interrupt, but is expected, so isn't a failure
+	scanCtx := ctx
+	if maxDuration > 0 {
+		var cancel context.CancelFunc
+		scanCtx, cancel = context.WithTimeout(ctx, maxDuration)
+		defer cancel()
+	}
+
+	scanErr := scan(scanCtx)
+	interrupted = ctx.Err() != nil && errors.Is(scanErr, context.Canceled)
+	outOfTime = !interrupted && errors.Is(scanErr, context.DeadlineExceeded)
+	if scanErr != nil && !interrupted && !outOfTime {
+		logger.Errorf("%s", scanErr.Error())
+	}
+	return interrupted, outOfTime
+}
+
+// finishCheckpoint keeps the checkpoint after a partial scan so the next run can resume, and removes it after a full one
+func finishCheckpoint(scanner *mediaaudit.Scanner, logger *cliLogger, checkpointPath string, maxDuration time.Duration, interrupted, outOfTime bool) {
+	if scanner.Checkpoint != nil {
+		switch {
+		case interrupted:
+			logger.Warnf("Scan interrupted, run again with -checkpoint %q to resume", checkpointPath)
+			scanner.Checkpoint.Close()
+		case outOfTime:
+			logger.Infof("Stopped after %s, run again with -checkpoint %q to scan the rest", maxDuration, checkpointPath)
+			scanner.Checkpoint.Close()
+		default:
+			scanner.Checkpoint.Remove()
+		}
+	} else if interrupted {
+		logger.Warnf("Scan interrupted, partial results written")
+	}
+}
+
+// exitForAudit exits with an error status after an interrupted scan or a failed audit
+func exitForAudit(logger *cliLogger, gate *auditGate, interrupted bool) {
+	// Don't let automation mistake a partial scan for a full one
+	if interrupted {
+		os.Exit(1)
+	}
+	if gate != nil {
+		if reasons := gate.reasons(); len(reasons) > 0 {
+			for _, reason := range reasons {
+				logger.Errorf("Audit failed: %s", reason)
+			}
+			os.Exit(exitAuditFailed)
+		}
+	}
+}
+
+// stringList collects every value of a flag that may be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// byteSize is a flag for an amount of memory, in bytes or with a K, M, G or T suffix
+type byteSize uint64
+
+var byteSuffixes map[string]uint64 = map[string]uint64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+
+func (b *byteSize) String() string {
+	return strconv.FormatUint(uint64(*b), 10)
+}
+
+func (b *byteSize) Set(value string) error {
+	value = strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(value), "B"))
+	multiplier := uint64(1)
+	if len(value) > 0 {
+		if m, ok := byteSuffixes[value[len(value)-1:]]; ok {
+			multiplier = m
+			value = value[:len(value)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q, expected e.g. 512M or 2G", value)
+	}
+	*b = byteSize(n * float64(multiplier))
+	return nil
+}
+
+// splitList splits a comma separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
 }
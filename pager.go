@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// pager feeds everything written to it through $PAGER
+type pager struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+// startPager launches $PAGER, or less if unset, writing to out
+func startPager(out io.Writer) (*pager, error) {
+	pagerCmd := os.Getenv("PAGER")
+	if pagerCmd == "" {
+		pagerCmd = "less"
+	}
+	cmd := exec.Command("sh", "-c", pagerCmd)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	// -F quits if the table fits on one screen, -S chops long lines instead of wrapping
+	if os.Getenv("LESS") == "" {
+		cmd.Env = append(os.Environ(), "LESS=FRSX")
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &pager{cmd: cmd, stdin: stdin}, nil
+}
+
+func (p *pager) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+// Close signals the end of the output and waits for the user to quit the pager
+func (p *pager) Close() error {
+	p.stdin.Close()
+	return p.cmd.Wait()
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package main
+
+import (
+	"context"
+
+	"gitlab.com/sheckler/mediaaudit/pkg/mediaaudit"
+)
+
+// handlePauseSignals does nothing, there are no signals to pause and resume with here
+func handlePauseSignals(ctx context.Context, scanner *mediaaudit.Scanner, logger *cliLogger) {}
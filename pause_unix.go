@@ -0,0 +1,37 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"gitlab.com/sheckler/mediaaudit/pkg/mediaaudit"
+)
+
+// handlePauseSignals pauses the scan on SIGUSR1 and resumes it on SIGUSR2, until ctx is done
+func handlePauseSignals(ctx context.Context, scanner *mediaaudit.Scanner, logger *cliLogger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				switch {
+				case sig == syscall.SIGUSR1 && !scanner.Paused():
+					scanner.Pause()
+					logger.Infof("Paused, files already being probed will finish, send SIGUSR2 to pid %d to resume", os.Getpid())
+				case sig == syscall.SIGUSR2 && scanner.Paused():
+					scanner.Resume()
+					logger.Infof("Resumed")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,93 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// aspectRatioTolerance is how far apart, relatively, two aspect ratios can be and still count as the same
+// It's loose enough for DVDs, whose 704 pixel wide picture area is often signalled as if it were all 720
+const aspectRatioTolerance = 0.03
+
+// ParseAspectRatio parses an aspect ratio written either as a ratio, e.g. 16:9, or a number, e.g. 2.39
+func ParseAspectRatio(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	var ratio float64
+	var err error
+	if width, height, ok := cut(value, ":"); ok {
+		var w, h float64
+		if w, err = strconv.ParseFloat(width, 64); err == nil {
+			if h, err = strconv.ParseFloat(height, 64); err == nil && h != 0 {
+				ratio = w / h
+			}
+		}
+	} else {
+		ratio, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil || ratio <= 0 || math.IsInf(ratio, 0) || math.IsNaN(ratio) {
+		return 0, fmt.Errorf("Invalid aspect ratio %q, expected something like 16:9 or 2.39", value)
+	}
+	return ratio, nil
+}
+
+// sameAspectRatio reports whether a and b are within aspectRatioTolerance of each other
+func sameAspectRatio(a, b float64) bool {
+	return math.Abs(a-b) <= aspectRatioTolerance*math.Max(a, b)
+}
+
+// fillAspectRatio works out whichever of the display and pixel aspect ratios the backend couldn't find
+// from the other and the stored dimensions, and whether the file is anamorphic
+func fillAspectRatio(report *Report) {
+	if report.Width <= 0 || report.Height <= 0 {
+		return
+	}
+	stored := float64(report.Width) / float64(report.Height)
+	switch {
+	case report.PixelAspectRatio == 0 && report.DisplayAspectRatio == 0:
+		report.PixelAspectRatio = 1
+		report.DisplayAspectRatio = stored
+	case report.PixelAspectRatio == 0:
+		report.PixelAspectRatio = report.DisplayAspectRatio / stored
+	case report.DisplayAspectRatio == 0:
+		report.DisplayAspectRatio = stored * report.PixelAspectRatio
+	}
+	report.DisplayAspectRatio = math.Round(report.DisplayAspectRatio*1000) / 1000
+	report.PixelAspectRatio = math.Round(report.PixelAspectRatio*1000) / 1000
+
+	// Anything under 1% off square is rounding, not a deliberate stretch
+	report.Anamorphic = math.Abs(report.PixelAspectRatio-1) > 0.01
+}
+
+// checkAspectRatio checks that the display aspect ratio agrees with the stored dimensions and pixel aspect ratio,
+// and, if allowed isn't empty, that it's one of the allowed ratios
+func checkAspectRatio(report *Report, allowed []float64) string {
+	if report.Width <= 0 || report.Height <= 0 || report.DisplayAspectRatio <= 0 {
+		return ""
+	}
+
+	var problems []string
+	expected := float64(report.Width) / float64(report.Height) * report.PixelAspectRatio
+	if !sameAspectRatio(report.DisplayAspectRatio, expected) {
+		problems = append(problems, fmt.Sprintf("DAR %.3f but %dx%d at PAR %.3f is %.3f", report.DisplayAspectRatio, report.Width, report.Height, report.PixelAspectRatio, expected))
+	}
+
+	if len(allowed) > 0 {
+		found := false
+		for _, ratio := range allowed {
+			if sameAspectRatio(report.DisplayAspectRatio, ratio) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("unexpected DAR %.3f", report.DisplayAspectRatio))
+		}
+	}
+
+	if len(problems) == 0 {
+		return "ok"
+	}
+	return strings.Join(problems, ", ")
+}
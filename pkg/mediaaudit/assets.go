@@ -0,0 +1,168 @@
+package mediaaudit
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Headers for AssetReport.ToSlice
+var AssetReportHeaders []string = []string{"Folder", "Type", "MissingAssets"}
+
+// Folder types recognised by AuditAssets
+const (
+	AssetFolderMovie  string = "Movie"
+	AssetFolderShow   string = "Show"
+	AssetFolderSeason string = "Season"
+)
+
+var (
+	seasonFolderRegex *regexp.Regexp = regexp.MustCompile(`(?i)^(season|series)[ ._-]*(\d+)$|^specials$`)
+	artworkExtensions []string       = []string{".jpg", ".jpeg", ".png", ".tbn"}
+)
+
+// AssetReport lists the local artwork a Plex/Jellyfin library folder is missing
+type AssetReport struct {
+	Folder        string
+	Type          string
+	MissingAssets []string
+}
+
+// ToSlice formats the report as a row matching AssetReportHeaders
+func (a *AssetReport) ToSlice() []string {
+	return []string{a.Folder, a.Type, strings.Join(a.MissingAssets, " ")}
+}
+
+// AuditAssets checks every movie and show folder under root for the local assets Plex and Jellyfin look for:
+// a poster and backdrop for movies and shows, a theme song for shows, and a poster for every season
+// Folders with nothing missing aren't included
+func AuditAssets(root string) ([]*AssetReport, error) {
+	var reports []*AssetReport
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || path == root {
+			return nil
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		var files, seasons []string
+		hasVideo := false
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() {
+				if seasonFolderRegex.MatchString(name) {
+					seasons = append(seasons, name)
+				}
+				continue
+			}
+			files = append(files, strings.ToLower(name))
+			if hasExtension(name, DefaultVideoExtensions) {
+				hasVideo = true
+			}
+		}
+
+		switch {
+		case len(seasons) > 0:
+			reports = append(reports, auditShow(path, files, seasons)...)
+			// Seasons are covered by the show, but keep walking for extras folders and the like
+		case hasVideo && !seasonFolderRegex.MatchString(info.Name()):
+			if missing := missingMovieAssets(path, files); len(missing) > 0 {
+				reports = append(reports, &AssetReport{Folder: path, Type: AssetFolderMovie, MissingAssets: missing})
+			}
+		}
+		return nil
+	})
+	return reports, err
+}
+
+func missingMovieAssets(path string, files []string) []string {
+	base := strings.ToLower(filepath.Base(path))
+	var missing []string
+	if !hasArtwork(files, "poster", "folder", "cover", "movie", base, base+"-poster") {
+		missing = append(missing, "poster")
+	}
+	if !hasArtwork(files, "fanart", "backdrop", "background", "art", base+"-fanart") {
+		missing = append(missing, "backdrop")
+	}
+	return missing
+}
+
+func auditShow(path string, files, seasons []string) []*AssetReport {
+	var reports []*AssetReport
+
+	var missing []string
+	if !hasArtwork(files, "poster", "folder", "cover", "show") {
+		missing = append(missing, "poster")
+	}
+	if !hasArtwork(files, "fanart", "backdrop", "background", "art") {
+		missing = append(missing, "backdrop")
+	}
+	if !hasFile(files, "theme.mp3") {
+		missing = append(missing, "theme")
+	}
+	if len(missing) > 0 {
+		reports = append(reports, &AssetReport{Folder: path, Type: AssetFolderShow, MissingAssets: missing})
+	}
+
+	sort.Strings(seasons)
+	for _, season := range seasons {
+		// Season posters can live in the show folder, e.g. season01-poster.jpg or season-specials-poster.jpg,
+		// or in the season folder itself as poster.jpg or folder.jpg
+		names := []string{"season-specials-poster", "season-specials"}
+		if match := seasonFolderRegex.FindStringSubmatch(season); match != nil && match[2] != "" {
+			number := strings.TrimLeft(match[2], "0")
+			if number == "" {
+				number = "0"
+			}
+			padded := number
+			if len(padded) < 2 {
+				padded = "0" + padded
+			}
+			names = []string{"season" + padded + "-poster", "season" + padded, "season" + number + "-poster", "season" + number}
+		}
+		if hasArtwork(files, names...) {
+			continue
+		}
+
+		seasonPath := filepath.Join(path, season)
+		var seasonFiles []string
+		if entries, err := os.ReadDir(seasonPath); err == nil {
+			for _, entry := range entries {
+				seasonFiles = append(seasonFiles, strings.ToLower(entry.Name()))
+			}
+		}
+		if !hasArtwork(seasonFiles, "poster", "folder", "cover") {
+			reports = append(reports, &AssetReport{Folder: seasonPath, Type: AssetFolderSeason, MissingAssets: []string{"poster"}})
+		}
+	}
+	return reports
+}
+
+// hasArtwork reports whether any of the names exist in files with an image extension
+// files must already be lowercase
+func hasArtwork(files []string, names ...string) bool {
+	for _, name := range names {
+		for _, ext := range artworkExtensions {
+			if hasFile(files, name+ext) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasFile(files []string, name string) bool {
+	for _, file := range files {
+		if file == name {
+			return true
+		}
+	}
+	return false
+}
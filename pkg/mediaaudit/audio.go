@@ -0,0 +1,24 @@
+package mediaaudit
+
+import "strings"
+
+// checkAudioLanguages fills in which of the required languages have no audio track,
+// along with how many tracks have no language tag at all
+func checkAudioLanguages(report *Report, required []string) {
+	present := make(map[string]bool)
+	report.UntaggedAudioTracks = 0
+	for _, language := range report.AudioLanguages {
+		if language == "und" {
+			report.UntaggedAudioTracks++
+			continue
+		}
+		present[strings.ToLower(language)] = true
+	}
+
+	report.MissingAudioLanguages = nil
+	for _, language := range required {
+		if !present[strings.ToLower(language)] {
+			report.MissingAudioLanguages = append(report.MissingAudioLanguages, language)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package mediaaudit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+const (
+	// complexitySeconds is how much of each file is decoded to measure its complexity, starting a third of the way in
+	complexitySeconds = 60
+	// Frames are scaled to the same size before measuring, so complexity doesn't depend on resolution
+	complexityFilter string = "scale=960:540,siti=print_summary=1"
+
+	// minModelFiles is the fewest files the bitrate model will fit, fewer and it would fit the noise
+	minModelFiles = 20
+	// minCodecFiles is the fewest files of a codec it takes to learn how efficient the codec is
+	minCodecFiles = 3
+	// ridge keeps the fit stable when a feature doesn't vary, e.g. every file is the same resolution,
+	// by pulling coefficients slightly towards 0
+	ridge = 1e-6
+	// outlierDeviations is how many standard deviations below the model's prediction a bitrate has to be to be flagged
+	outlierDeviations = 2
+)
+
+// Matches the averages in the summary of ffmpeg's siti filter
+var (
+	spatialInfoRegex  *regexp.Regexp = regexp.MustCompile(`Spatial Information:\s*Average:\s*([\d.]+)`)
+	temporalInfoRegex *regexp.Regexp = regexp.MustCompile(`Temporal Information:\s*Average:\s*([\d.]+)`)
+)
+
+// measureComplexity decodes a minute of the file at path with ffmpeg's siti filter, returning its average
+// spatial information, how much detail each frame has, and temporal information, how much changes between frames
+// Grain and fast motion score high, and flat animation low, which is most of what makes one file need more bitrate than another
+func measureComplexity(ctx context.Context, path string, duration float64) (float64, float64, error) {
+	start := strconv.FormatFloat(math.Max(duration/3, 0), 'f', 3, 64)
+	output, err := runFFmpegFilter(ctx, "-ss", start, "-t", strconv.Itoa(complexitySeconds), "-i", path, "-map", "0:v:0", "-vf", complexityFilter)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var averages [2]float64
+	for i, regex := range []*regexp.Regexp{spatialInfoRegex, temporalInfoRegex} {
+		match := regex.FindStringSubmatch(output)
+		if match == nil {
+			return 0, 0, fmt.Errorf("No siti summary in ffmpeg output for %q", path)
+		}
+		if averages[i], err = strconv.ParseFloat(match[1], 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	return averages[0], averages[1], nil
+}
+
+// measureComplexity fills in the spatial and temporal information of the file at path, waiting its turn in the heavy work queue
+func (s *Scanner) measureComplexity(ctx context.Context, report *Report, path string) {
+	if err := s.qualitySem.Acquire(ctx, 1); err != nil {
+		return
+	}
+	defer s.qualitySem.Release(1)
+
+	s.logf(LevelDebug, path, "Measuring the complexity of %q", path)
+	spatial, temporal, err := measureComplexity(ctx, path, report.DurationSeconds)
+	if err != nil {
+		s.logf(LevelWarn, path, "Failed to measure the complexity of %q: %s", path, err.Error())
+		return
+	}
+	report.SpatialInfo = spatial
+	report.TemporalInfo = temporal
+}
+
+// bitsPerPixel is how many bits the video spends on each pixel of each frame, 0 if that isn't known
+func bitsPerPixel(report *Report) float64 {
+	if report.BitrateMbps <= 0 || report.Width <= 0 || report.Height <= 0 || report.FrameRate <= 0 {
+		return 0
+	}
+	return report.BitrateMbps * 1e6 / (float64(report.Width*report.Height) * report.FrameRate)
+}
+
+// BitrateModelWriter fits a model of the bitrate each file should have, given its resolution, codec and complexity,
+// to the scanned library once the scan finishes, and prints the files with far less bitrate than the model expects
+// A flat threshold per resolution flags clean animation that needs little and misses grainy film that needs a lot,
+// where the model learns from the rest of the library what files like each one get
+type BitrateModelWriter struct {
+	out     io.Writer
+	reports []*Report
+	seen    map[string]bool
+}
+
+// NewBitrateModelWriter returns a BitrateModelWriter that prints to out
+func NewBitrateModelWriter(out io.Writer) *BitrateModelWriter {
+	return &BitrateModelWriter{out: out, seen: make(map[string]bool)}
+}
+
+func (w *BitrateModelWriter) Write(report *Report) error {
+	if w.seen[report.ID] || report.SpatialInfo <= 0 || bitsPerPixel(report) <= 0 {
+		return nil
+	}
+	w.seen[report.ID] = true
+	w.reports = append(w.reports, report)
+	return nil
+}
+
+// bitrateOutlier is a file the model expects to have more bitrate
+type bitrateOutlier struct {
+	report     *Report
+	expected   float64 // Mbps
+	deviations float64
+}
+
+// Close fits log bits per pixel to log pixels, log spatial and temporal information, log grain and a constant for each codec
+// with least squares, and prints the files furthest below the fit
+func (w *BitrateModelWriter) Close() error {
+	codecCounts := make(map[string]int)
+	for _, report := range w.reports {
+		codecCounts[report.Codec]++
+	}
+	var codecs []string
+	for codec, count := range codecCounts {
+		if count >= minCodecFiles {
+			codecs = append(codecs, codec)
+		}
+	}
+	sort.Strings(codecs)
+
+	var reports []*Report
+	var features [][]float64
+	var targets []float64
+	for _, report := range w.reports {
+		row := modelFeatures(report, codecs)
+		if row == nil {
+			continue
+		}
+		reports = append(reports, report)
+		features = append(features, row)
+		targets = append(targets, math.Log(bitsPerPixel(report)))
+	}
+	if len(reports) < minModelFiles {
+		fmt.Fprintf(w.out, "Bitrate model needs at least %d files with a measured complexity and known bitrate, frame rate and codec, found %d\n", minModelFiles, len(reports))
+		return nil
+	}
+
+	coefficients, ok := leastSquares(features, targets)
+	if !ok {
+		fmt.Fprintln(w.out, "Bitrate model couldn't be fitted, the files are too alike to tell their resolution, codec and complexity apart")
+		return nil
+	}
+	residuals := make([]float64, len(reports))
+	sumSquares := 0.0
+	for i, row := range features {
+		residuals[i] = targets[i] - dot(coefficients, row)
+		sumSquares += residuals[i] * residuals[i]
+	}
+	deviation := math.Sqrt(sumSquares / math.Max(float64(len(reports)-len(coefficients)), 1))
+
+	var outliers []bitrateOutlier
+	for i, report := range reports {
+		if deviation > 0 && residuals[i] < -outlierDeviations*deviation {
+			expected := math.Exp(dot(coefficients, features[i])) * float64(report.Width*report.Height) * report.FrameRate / 1e6
+			outliers = append(outliers, bitrateOutlier{report: report, expected: expected, deviations: residuals[i] / deviation})
+		}
+	}
+	sort.Slice(outliers, func(i, j int) bool {
+		return outliers[i].deviations < outliers[j].deviations
+	})
+
+	fmt.Fprintf(w.out, "Bitrate model fitted to %d files, %d starved of bitrate:\n", len(reports), len(outliers))
+	table := tabwriter.NewWriter(w.out, 0, 8, 2, ' ', 0)
+	for _, outlier := range outliers {
+		fmt.Fprintf(table, "%s\t%.2f Mbps\texpected %.2f Mbps\t%.1fσ\n", outlier.report.Name, outlier.report.BitrateMbps, outlier.expected, outlier.deviations)
+	}
+	return table.Flush()
+}
+
+// modelFeatures are what the bitrate model predicts from: a constant, log pixels per frame,
+// log spatial and temporal information, log grain, and whether the file is each of codecs, nil if its codec isn't one of them
+// Grain is 0 unless it was estimated, and grain takes more bitrate to keep than anything else
+// The first codec is the baseline the constant stands for, so it has no feature of its own
+func modelFeatures(report *Report, codecs []string) []float64 {
+	index := -1
+	for i, codec := range codecs {
+		if codec == report.Codec {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil
+	}
+
+	grain, _ := strconv.ParseFloat(report.GrainLevel, 64)
+	row := []float64{1, math.Log(float64(report.Width * report.Height)), math.Log(report.SpatialInfo), math.Log1p(report.TemporalInfo), math.Log1p(grain)}
+	for i := 1; i < len(codecs); i++ {
+		if i == index {
+			row = append(row, 1)
+		} else {
+			row = append(row, 0)
+		}
+	}
+	return row
+}
+
+// leastSquares finds the coefficients minimising the squared error of features times coefficients against targets,
+// by solving the normal equations with Gaussian elimination, false if they have no single solution
+// Every coefficient but the first, the constant, is slightly penalised, see ridge
+func leastSquares(features [][]float64, targets []float64) ([]float64, bool) {
+	n := len(features[0])
+	// Each row of the augmented matrix is a normal equation, with its right hand side at the end
+	matrix := make([][]float64, n)
+	for i := range matrix {
+		matrix[i] = make([]float64, n+1)
+		for k, row := range features {
+			for j := 0; j < n; j++ {
+				matrix[i][j] += row[i] * row[j]
+			}
+			matrix[i][n] += row[i] * targets[k]
+		}
+		if i > 0 {
+			matrix[i][i] += ridge * float64(len(features))
+		}
+	}
+
+	for column := 0; column < n; column++ {
+		pivot := column
+		for row := column + 1; row < n; row++ {
+			if math.Abs(matrix[row][column]) > math.Abs(matrix[pivot][column]) {
+				pivot = row
+			}
+		}
+		if math.Abs(matrix[pivot][column]) < 1e-9 {
+			return nil, false
+		}
+		matrix[column], matrix[pivot] = matrix[pivot], matrix[column]
+		for row := 0; row < n; row++ {
+			if row == column {
+				continue
+			}
+			factor := matrix[row][column] / matrix[column][column]
+			for j := column; j <= n; j++ {
+				matrix[row][j] -= factor * matrix[column][j]
+			}
+		}
+	}
+
+	coefficients := make([]float64, n)
+	for i := range coefficients {
+		coefficients[i] = matrix[i][n] / matrix[i][i]
+	}
+	return coefficients, true
+}
+
+// dot is the dot product of two equally long vectors
+func dot(a, b []float64) float64 {
+	total := 0.0
+	for i := range a {
+		total += a[i] * b[i]
+	}
+	return total
+}
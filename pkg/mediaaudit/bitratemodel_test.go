@@ -0,0 +1,115 @@
+package mediaaudit
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestLeastSquares(t *testing.T) {
+	tests := []struct {
+		name     string
+		features [][]float64
+		targets  []float64
+		want     []float64 // nil if there's no single solution
+	}{
+		{
+			name:     "exact fit",
+			features: [][]float64{{1, 0, 0}, {1, 1, 0}, {1, 0, 1}, {1, 2, 3}, {1, 4, 1}},
+			targets:  []float64{2, 5, 1.5, 6.5, 13.5}, // 2 + 3x - 0.5y
+			want:     []float64{2, 3, -0.5},
+		},
+		{
+			name:     "line through noisy points",
+			features: [][]float64{{1, 0}, {1, 1}, {1, 2}, {1, 3}},
+			targets:  []float64{1, 3, 2, 5},
+			want:     []float64{1.1, 1.1},
+		},
+		{
+			name:     "no constant",
+			features: [][]float64{{0, 1}, {0, 2}},
+			targets:  []float64{1, 2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			coefficients, ok := leastSquares(test.features, test.targets)
+			if ok != (test.want != nil) {
+				t.Fatalf("leastSquares() = %v, %t, want %v", coefficients, ok, test.want)
+			}
+			for i := range test.want {
+				if math.Abs(coefficients[i]-test.want[i]) > 1e-4 {
+					t.Errorf("leastSquares() = %v, want %v", coefficients, test.want)
+					break
+				}
+			}
+		})
+	}
+
+	// A feature that doesn't vary has many fits, ridge picks one, which must still predict every target
+	features := [][]float64{{1, 5, 0}, {1, 5, 1}, {1, 5, 2}}
+	targets := []float64{1, 3, 5}
+	coefficients, ok := leastSquares(features, targets)
+	if !ok {
+		t.Fatalf("leastSquares() with a constant feature found no solution")
+	}
+	for i, row := range features {
+		if got := dot(coefficients, row); math.Abs(got-targets[i]) > 1e-4 {
+			t.Errorf("leastSquares() with a constant feature predicts %g for row %d, want %g", got, i, targets[i])
+		}
+	}
+}
+
+func TestBitrateModelWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := NewBitrateModelWriter(&out)
+	for i := 0; i < 24; i++ {
+		// Bits per pixel grow with detail, with a little noise
+		spatial := float64(20 + i*2)
+		report := &Report{ID: fmt.Sprint(i), Name: fmt.Sprintf("%02d.mkv", i), Codec: "AVC", Width: 1920, Height: 1080, FrameRate: 25,
+			SpatialInfo: spatial, TemporalInfo: float64(i % 5)}
+		report.BitrateMbps = bitsPerPixelFor(spatial) * (1 + 0.05*math.Sin(float64(i))) * 1920 * 1080 * 25 / 1e6
+		if i == 12 {
+			report.Name = "starved.mkv"
+			report.BitrateMbps /= 4
+		}
+		if err := w.Write(report); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files without a measured complexity can't be modelled
+	if err := w.Write(&Report{ID: "unmeasured", Codec: "AVC", Width: 1920, Height: 1080, FrameRate: 25, BitrateMbps: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || lines[0] != "Bitrate model fitted to 24 files, 1 starved of bitrate:" || !strings.HasPrefix(lines[1], "starved.mkv ") {
+		t.Errorf("BitrateModelWriter printed:\n%s", out.String())
+	}
+}
+
+// bitsPerPixelFor is the bits per pixel TestBitrateModelWriter gives a file with the spatial information si
+func bitsPerPixelFor(si float64) float64 {
+	return 0.002 * math.Pow(si, 1.2)
+}
+
+func TestBitsPerPixel(t *testing.T) {
+	tests := []struct {
+		report Report
+		want   float64
+	}{
+		{Report{BitrateMbps: 8.2944, Width: 1920, Height: 1080, FrameRate: 40}, 0.1},
+		{Report{BitrateMbps: 8, Width: 1920, Height: 1080}, 0},
+		{Report{Width: 1920, Height: 1080, FrameRate: 25}, 0},
+	}
+	for _, test := range tests {
+		if got := bitsPerPixel(&test.report); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("bitsPerPixel(%+v) = %g, want %g", test.report, got, test.want)
+		}
+	}
+}
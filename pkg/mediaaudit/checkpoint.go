@@ -0,0 +1,142 @@
+package mediaaudit
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Checkpoint records which files a scan has finished with, so an interrupted scan can pick up where it left off
+// It's a plain text file with one absolute path per line, and its modification time after a tab,
+// appended to as files finish
+// A file modified since it was recorded isn't done, it needs scanning again
+type Checkpoint struct {
+	lock sync.Mutex
+	path string
+	file *os.File
+	done map[string]int64 // Modification times in Unix nanoseconds, 0 if unknown
+}
+
+// OpenCheckpoint loads the checkpoint at path, creating it if it doesn't exist
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	c := &Checkpoint{path: path, done: make(map[string]int64)}
+
+	lines := 0
+	existing, err := os.Open(path)
+	if err == nil {
+		scanner := bufio.NewScanner(existing)
+		for scanner.Scan() {
+			key, modTime := parseCheckpointLine(scanner.Text())
+			c.done[key] = modTime
+			lines++
+		}
+		existing.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Files recorded again after changing leave their old lines behind, which adds up when a checkpoint is kept for good
+	if lines > 2*len(c.done) {
+		if err := c.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+
+	c.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Len returns how many files have been recorded
+func (c *Checkpoint) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.done)
+}
+
+// Done reports whether the file at path has already been recorded, and hasn't been modified since
+func (c *Checkpoint) Done(path string, info os.FileInfo) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	modTime, ok := c.done[checkpointKey(path)]
+	return ok && (modTime == 0 || modTime == info.ModTime().UnixNano())
+}
+
+// Record marks the file at path as finished
+// Each entry is written straight through so that it survives the process being killed
+func (c *Checkpoint) Record(path string, info os.FileInfo) error {
+	key := checkpointKey(path)
+	modTime := info.ModTime().UnixNano()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.done[key] = modTime
+	_, err := c.file.WriteString(key + "\t" + strconv.FormatInt(modTime, 10) + "\n")
+	return err
+}
+
+// Close closes the checkpoint file, keeping it for the next run
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
+
+// Remove closes and deletes the checkpoint file, for once a scan has finished
+func (c *Checkpoint) Remove() error {
+	c.file.Close()
+	return os.Remove(c.path)
+}
+
+// rewrite replaces the checkpoint file with one line for each file recorded
+func (c *Checkpoint) rewrite() error {
+	temp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := temp.Chmod(0644); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	writer := bufio.NewWriter(temp)
+	for key, modTime := range c.done {
+		writer.WriteString(key + "\t" + strconv.FormatInt(modTime, 10) + "\n")
+	}
+	if err := writer.Flush(); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), c.path)
+}
+
+// parseCheckpointLine splits a line of a checkpoint into its path and modification time
+// Checkpoints written before modification times were recorded only have the path
+func parseCheckpointLine(line string) (string, int64) {
+	if i := strings.LastIndex(line, "\t"); i >= 0 {
+		if modTime, err := strconv.ParseInt(line[i+1:], 10, 64); err == nil {
+			return line[:i], modTime
+		}
+	}
+	return line, 0
+}
+
+// checkpointKey makes paths comparable between runs started from different directories
+func checkpointKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,139 @@
+package mediaaudit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scan.checkpoint")
+	var files []string
+	infos := make(map[string]os.FileInfo)
+	for _, name := range []string{"a.mkv", "b.mkv", "c.mkv"} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+		infos[file] = info
+	}
+
+	checkpoint, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint() error = %v", err)
+	}
+	for _, file := range files[:2] {
+		if err := checkpoint.Record(file, infos[file]); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if !checkpoint.Done(files[0], infos[files[0]]) || checkpoint.Done(files[2], infos[files[2]]) {
+		t.Errorf("Done() doesn't match what was recorded")
+	}
+	if err := checkpoint.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file changed since the last run needs scanning again
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(files[1], later, later); err != nil {
+		t.Fatal(err)
+	}
+	modified, err := os.Stat(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resuming picks up what the last run recorded, however the paths are written
+	checkpoint, err = OpenCheckpoint(path)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint() error = %v", err)
+	}
+	if got := checkpoint.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	relative, err := filepath.Rel(wd, files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		path string
+		info os.FileInfo
+		want bool
+	}{
+		{"recorded", files[0], infos[files[0]], true},
+		{"relative path", relative, infos[files[0]], true},
+		{"unclean path", filepath.Join(dir, "sub", "..", "a.mkv"), infos[files[0]], true},
+		{"modified since", files[1], modified, false},
+		{"never recorded", files[2], infos[files[2]], false},
+	}
+	for _, test := range tests {
+		if got := checkpoint.Done(test.path, test.info); got != test.want {
+			t.Errorf("Done() of %s = %t, want %t", test.name, got, test.want)
+		}
+	}
+	for _, file := range files[1:] {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkpoint.Record(file, info); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if err := checkpoint.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the scan is done the checkpoint goes
+	checkpoint, err = OpenCheckpoint(path)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint() error = %v", err)
+	}
+	if got := checkpoint.Len(); got != 3 || !checkpoint.Done(files[1], modified) {
+		t.Errorf("Len() = %d, want 3 with the modified file recorded again", got)
+	}
+	if err := checkpoint.Remove(); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Remove() left the checkpoint behind")
+	}
+}
+
+func TestCheckpointWithoutTimes(t *testing.T) {
+	// Checkpoints written before modification times were recorded only have paths, and still count
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.mkv")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "scan.checkpoint")
+	if err := os.WriteFile(path, []byte(file+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint() error = %v", err)
+	}
+	defer checkpoint.Close()
+	if !checkpoint.Done(file, info) {
+		t.Errorf("Done() = false for a path without a time")
+	}
+}
@@ -0,0 +1,142 @@
+package mediaaudit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Commercial breaks are found where the picture goes black and the sound goes quiet at the same time,
+// between every ad and at either end of the break
+const (
+	// maxAdSeconds is the longest gap between two break points that can still be an ad, most are 15, 30 or 60 seconds
+	maxAdSeconds = 90
+	// minBreakPoints is how many break points in a row make a commercial break, rather than a scene change
+	minBreakPoints = 3
+	// The filters find every black stretch of at least a tenth of a second, and every silence of at least a third
+	blackFilter   string = "blackdetect=d=0.1:pix_th=0.1"
+	silenceFilter string = "silencedetect=n=-50dB:d=0.3"
+)
+
+// Matches ffmpeg's blackdetect and silencedetect output, e.g.
+// "black_start:12.3 black_end:13 black_duration:0.7", "silence_start: 12.2" and "silence_end: 13.1 | silence_duration: 0.9"
+var (
+	blackRegex        *regexp.Regexp = regexp.MustCompile(`black_start:\s*([\d.]+)\s+black_end:\s*([\d.]+)`)
+	silenceStartRegex *regexp.Regexp = regexp.MustCompile(`silence_start:\s*(-?[\d.]+)`)
+	silenceEndRegex   *regexp.Regexp = regexp.MustCompile(`silence_end:\s*([\d.]+)`)
+)
+
+// interval is a stretch of a recording, in seconds from the start
+type interval struct {
+	start, end float64
+}
+
+// within is how many seconds of the interval fall between the start and length
+func (i interval) within(length float64) float64 {
+	return math.Max(math.Min(i.end, length)-math.Max(i.start, 0), 0)
+}
+
+// parseBlack finds the black stretches in blackdetect's output
+func parseBlack(output string) []interval {
+	var intervals []interval
+	for _, match := range blackRegex.FindAllStringSubmatch(output, -1) {
+		start, startErr := strconv.ParseFloat(match[1], 64)
+		end, endErr := strconv.ParseFloat(match[2], 64)
+		if startErr == nil && endErr == nil {
+			intervals = append(intervals, interval{start: start, end: end})
+		}
+	}
+	return intervals
+}
+
+// parseIntervals finds the stretches in the output of a filter that reports starts and ends separately,
+// like silencedetect and freezedetect
+// A stretch that's still going at the end has no end, so it runs to duration
+func parseIntervals(output string, startRegex, endRegex *regexp.Regexp, duration float64) []interval {
+	starts := startRegex.FindAllStringSubmatch(output, -1)
+	ends := endRegex.FindAllStringSubmatch(output, -1)
+	var intervals []interval
+	for i, match := range starts {
+		start, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			continue
+		}
+		end := duration
+		if i < len(ends) {
+			if end, err = strconv.ParseFloat(ends[i][1], 64); err != nil {
+				continue
+			}
+		}
+		intervals = append(intervals, interval{start: start, end: end})
+	}
+	return intervals
+}
+
+// breakPoints are the middles of the black stretches that are also silent
+func breakPoints(blacks, silences []interval) []float64 {
+	var points []float64
+	for _, black := range blacks {
+		for _, silence := range silences {
+			if black.start < silence.end && silence.start < black.end {
+				points = append(points, (black.start+black.end)/2)
+				break
+			}
+		}
+	}
+	sort.Float64s(points)
+	return points
+}
+
+// commercialSeconds adds up the runs of break points close enough together to be ads
+func commercialSeconds(points []float64) float64 {
+	total := 0.0
+	first := 0
+	for i := 1; i <= len(points); i++ {
+		if i < len(points) && points[i]-points[i-1] <= maxAdSeconds {
+			continue
+		}
+		if i-first >= minBreakPoints {
+			total += points[i-1] - points[first]
+		}
+		first = i
+	}
+	return total
+}
+
+// estimateCommercials decodes the file at path and estimates what percentage of it is commercials
+// It's only as good as the broadcaster's habit of fading to black between ads, but that's enough to
+// tell a recording that's mostly ads from one with a couple of breaks
+func estimateCommercials(ctx context.Context, path string, duration float64) (float64, error) {
+	if duration <= 0 {
+		return 0, fmt.Errorf("Unknown duration for %q", path)
+	}
+
+	// Black frames don't need the full resolution to be found
+	video := "fps=5,scale=160:-2," + blackFilter
+	output, err := runFFmpegFilter(ctx, "-i", path, "-map", "0:v:0", "-map", "0:a:0", "-vf", video, "-af", silenceFilter)
+	if err != nil {
+		return 0, err
+	}
+
+	seconds := commercialSeconds(breakPoints(parseBlack(output), parseIntervals(output, silenceStartRegex, silenceEndRegex, duration)))
+	return math.Min(seconds/duration*100, 100), nil
+}
+
+// estimateCommercials fills in how much of the file at path is commercials, waiting its turn in the heavy work queue
+func (s *Scanner) estimateCommercials(ctx context.Context, report *Report, path string) {
+	if err := s.qualitySem.Acquire(ctx, 1); err != nil {
+		return
+	}
+	defer s.qualitySem.Release(1)
+
+	s.logf(LevelDebug, path, "Looking for commercials in %q", path)
+	percent, err := estimateCommercials(ctx, path, report.DurationSeconds)
+	if err != nil {
+		s.logf(LevelWarn, path, "Failed to look for commercials in %q: %s", path, err.Error())
+		return
+	}
+	report.CommercialPercent = fmt.Sprintf("%.1f", percent)
+}
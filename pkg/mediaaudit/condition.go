@@ -0,0 +1,137 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Matches an aggregate compared to a number, the argument is greedy so it can contain parentheses of its own
+var conditionRegex *regexp.Regexp = regexp.MustCompile(`^\s*(count|percent|sum|avg|min|max)\s*\((.*)\)\s*(==|!=|<=|>=|<|>)\s*(-?[0-9]+(?:\.[0-9]+)?)\s*$`)
+
+// Condition is an aggregate over every report in a scan compared to a number, e.g.
+//
+//	count(BitrateMbps < 1) > 0
+//	percent(Codec != "HEVC") > 50
+//	avg(BitrateMbps) < 4
+//
+// count and percent take a filter expression, or nothing to count every report,
+// sum, avg, min and max take a numeric column
+type Condition struct {
+	expression   string
+	aggregate    string
+	filter       *Filter  // For count and percent
+	column       int      // For the other aggregates, the column's index in the row
+	extraColumns []string // The columns after ReportHeaders in each report's row
+	operator     string
+	threshold    float64
+
+	reports int
+	matched int
+	values  int // How many reports had a number in column
+	sum     float64
+	min     float64
+	max     float64
+}
+
+// ParseCondition compiles expression, checking that every column it uses is
+// either in ReportHeaders or in extraColumns, ignoring case
+func ParseCondition(expression string, extraColumns []string) (*Condition, error) {
+	match := conditionRegex.FindStringSubmatch(expression)
+	if match == nil {
+		return nil, fmt.Errorf("Invalid condition %q, expected e.g. 'count(BitrateMbps < 1) > 0'", expression)
+	}
+
+	c := &Condition{expression: expression, aggregate: match[1], extraColumns: extraColumns, column: -1, operator: match[3], min: math.Inf(1), max: math.Inf(-1)}
+	c.threshold, _ = strconv.ParseFloat(match[4], 64)
+	argument := strings.TrimSpace(match[2])
+
+	switch c.aggregate {
+	case "count", "percent":
+		if argument != "" && argument != "*" {
+			filter, err := ParseFilter(argument, extraColumns)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid condition %q: %w", expression, err)
+			}
+			c.filter = filter
+		}
+	default:
+		columns, err := columnIndexes(extraColumns, []string{argument})
+		if err != nil {
+			return nil, fmt.Errorf("Invalid condition %q: unknown column %q", expression, argument)
+		}
+		c.column = columns[0]
+	}
+	return c, nil
+}
+
+// String returns the expression the condition was parsed from
+func (c *Condition) String() string {
+	return c.expression
+}
+
+// Add counts report towards the aggregate
+func (c *Condition) Add(report *Report) {
+	c.reports++
+	row := report.Row(c.extraColumns)
+	if c.filter == nil || c.filter.root.eval(row) {
+		c.matched++
+	}
+	if c.column < 0 {
+		return
+	}
+	if value, err := strconv.ParseFloat(row[c.column], 64); err == nil {
+		c.values++
+		c.sum += value
+		c.min = math.Min(c.min, value)
+		c.max = math.Max(c.max, value)
+	}
+}
+
+// Value is the aggregate over every report added so far
+// Averages, minimums and maximums of no values at all are 0
+func (c *Condition) Value() float64 {
+	switch c.aggregate {
+	case "count":
+		return float64(c.matched)
+	case "percent":
+		if c.reports == 0 {
+			return 0
+		}
+		return float64(c.matched) / float64(c.reports) * 100
+	case "sum":
+		return c.sum
+	}
+	if c.values == 0 {
+		return 0
+	}
+	switch c.aggregate {
+	case "avg":
+		return c.sum / float64(c.values)
+	case "min":
+		return c.min
+	default:
+		return c.max
+	}
+}
+
+// Met reports whether the aggregate satisfies the comparison
+func (c *Condition) Met() bool {
+	value := c.Value()
+	switch c.operator {
+	case "==":
+		return value == c.threshold
+	case "!=":
+		return value != c.threshold
+	case "<":
+		return value < c.threshold
+	case "<=":
+		return value <= c.threshold
+	case ">":
+		return value > c.threshold
+	default:
+		return value >= c.threshold
+	}
+}
@@ -0,0 +1,123 @@
+package mediaaudit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// decodeSegment is a span of the file to decode, in seconds
+type decodeSegment struct {
+	start, length float64
+}
+
+func (s decodeSegment) String() string {
+	return fmt.Sprintf("%s-%s", formatSeconds(s.start), formatSeconds(s.start+s.length))
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
+
+// decodeSegments spreads count segments of length evenly across a file of the given duration,
+// always including the head and tail once there's more than one segment
+// A count of 0, or segments that would cover the whole file anyway, mean decoding everything
+func decodeSegments(duration float64, count int, length time.Duration) []decodeSegment {
+	segmentLength := length.Seconds()
+	if count <= 0 || duration <= 0 || float64(count)*segmentLength >= duration {
+		return nil
+	}
+	if count == 1 {
+		return []decodeSegment{{start: (duration - segmentLength) / 2, length: segmentLength}}
+	}
+
+	segments := make([]decodeSegment, count)
+	step := (duration - segmentLength) / float64(count-1)
+	for i := range segments {
+		segments[i] = decodeSegment{start: float64(int(step*float64(i)*1000)) / 1000, length: segmentLength}
+	}
+	return segments
+}
+
+// verifyDecode decodes the file with ffmpeg, either fully or just the given segments,
+// and returns the problems ffmpeg reported along with what was covered
+func verifyDecode(ctx context.Context, path string, segments []decodeSegment) (result string, coverage string, err error) {
+	if len(segments) == 0 {
+		problems, err := runDecode(ctx, path, nil)
+		if err != nil {
+			return "", "", err
+		}
+		return summarizeDecode(problems), "all", nil
+	}
+
+	var problems []string
+	var covered []string
+	for _, segment := range segments {
+		segmentProblems, err := runDecode(ctx, path, &segment)
+		if err != nil {
+			return "", "", err
+		}
+		for _, problem := range segmentProblems {
+			problems = append(problems, fmt.Sprintf("%s: %s", segment, problem))
+		}
+		covered = append(covered, segment.String())
+	}
+	return summarizeDecode(problems), strings.Join(covered, ","), nil
+}
+
+// verifyDecode fills in the decode check for the file at path, waiting its turn in the heavy work queue
+func (s *Scanner) verifyDecode(ctx context.Context, report *Report, path string) {
+	if err := s.qualitySem.Acquire(ctx, 1); err != nil {
+		return
+	}
+	defer s.qualitySem.Release(1)
+
+	segments := decodeSegments(report.DurationSeconds, s.DecodeSegments, s.DecodeSegmentLength)
+	var err error
+	report.Decode, report.DecodeSegments, err = verifyDecode(ctx, path, segments)
+	if err != nil {
+		s.logf(LevelWarn, path, "Failed to decode %q: %s", path, err.Error())
+	}
+}
+
+// runDecode decodes the file, or one segment of it, throwing the output away
+// ffmpeg only logs at the error level when something is actually wrong with the stream
+func runDecode(ctx context.Context, path string, segment *decodeSegment) ([]string, error) {
+	args := []string{"-hide_banner", "-nostdin", "-v", "error"}
+	if segment != nil {
+		// Seeking before the input is fast, and ffmpeg decodes from the preceding keyframe
+		args = append(args, "-ss", formatSeconds(segment.start), "-t", formatSeconds(segment.length))
+	}
+	args = append(args, "-i", path, "-map", "0:v?", "-map", "0:a?", "-f", "null", "-")
+
+	var stderr bytes.Buffer
+	cmd := toolCommand(ctx, "ffmpeg", args...)
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	var problems []string
+	for _, line := range strings.Split(stderr.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			problems = append(problems, line)
+		}
+	}
+	if runErr != nil && len(problems) == 0 {
+		// ffmpeg failed without telling us why, so it's more likely our problem than the file's
+		return nil, runErr
+	}
+	return problems, nil
+}
+
+// summarizeDecode keeps the column readable, a corrupt file can produce thousands of errors
+func summarizeDecode(problems []string) string {
+	switch len(problems) {
+	case 0:
+		return "ok"
+	case 1:
+		return problems[0]
+	}
+	return fmt.Sprintf("%s (and %d more)", problems[0], len(problems)-1)
+}
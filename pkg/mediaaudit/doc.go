@@ -0,0 +1,6 @@
+// Package mediaaudit builds reports on the quality of a directory of video files.
+//
+// A Scanner walks a directory tree, hands each video file to a Backend such as
+// MediaInfo, runs the configured audits over the result and sends the finished
+// Report to a Writer.
+package mediaaudit
@@ -0,0 +1,81 @@
+package mediaaudit
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// A dropout is near digital silence for at least dropoutSeconds, far quieter than any quiet scene's room tone
+	dropoutSeconds = 2
+	dropoutFilter  = "silencedetect=n=-80dB:d=2"
+	// Silence this close to the start or end of the file is a lead-in or run-out, not a dropout
+	dropoutEdgeSeconds = 5
+)
+
+// detectDropouts decodes the first video and audio tracks of the file at path and finds the stretches where the audio
+// drops out while the picture carries on
+// Silence over a fade to black is a scene change, so only silence with no black frames during it counts
+func detectDropouts(ctx context.Context, path string, duration float64) ([]interval, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("Unknown duration for %q", path)
+	}
+
+	// Black frames don't need the full resolution to be found
+	video := "fps=5,scale=160:-2," + blackFilter
+	output, err := runFFmpegFilter(ctx, "-i", path, "-map", "0:v:0", "-map", "0:a:0", "-vf", video, "-af", dropoutFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	blacks := parseBlack(output)
+	var dropouts []interval
+	for _, silence := range parseIntervals(output, silenceStartRegex, silenceEndRegex, duration) {
+		if silence.end-silence.start < dropoutSeconds || silence.start < dropoutEdgeSeconds || silence.end > duration-dropoutEdgeSeconds {
+			continue
+		}
+		sceneChange := false
+		for _, black := range blacks {
+			sceneChange = sceneChange || (black.start < silence.end && silence.start < black.end)
+		}
+		if !sceneChange {
+			dropouts = append(dropouts, silence)
+		}
+	}
+	return dropouts, nil
+}
+
+// summarizeDropouts describes the dropouts found, or returns ok if there are none
+func summarizeDropouts(dropouts []interval) string {
+	if len(dropouts) == 0 {
+		return "ok"
+	}
+	longest := dropouts[0]
+	for _, dropout := range dropouts {
+		if dropout.end-dropout.start > longest.end-longest.start {
+			longest = dropout
+		}
+	}
+	at := (time.Duration(longest.start) * time.Second).String()
+	if len(dropouts) == 1 {
+		return fmt.Sprintf("%.1fs dropout at %s", longest.end-longest.start, at)
+	}
+	return fmt.Sprintf("%d dropouts, longest %.1fs at %s", len(dropouts), longest.end-longest.start, at)
+}
+
+// detectDropouts fills in the audio dropout check for the file at path, waiting its turn in the heavy work queue
+func (s *Scanner) detectDropouts(ctx context.Context, report *Report, path string) {
+	if err := s.qualitySem.Acquire(ctx, 1); err != nil {
+		return
+	}
+	defer s.qualitySem.Release(1)
+
+	s.logf(LevelDebug, path, "Looking for audio dropouts in %q", path)
+	dropouts, err := detectDropouts(ctx, path, report.DurationSeconds)
+	if err != nil {
+		s.logf(LevelWarn, path, "Failed to look for audio dropouts in %q: %s", path, err.Error())
+		return
+	}
+	report.AudioDropouts = summarizeDropouts(dropouts)
+}
@@ -0,0 +1,85 @@
+package mediaaudit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Extension adds custom columns to each report
+// Register extensions by adding them to Scanner.Extensions
+type Extension interface {
+	// Columns names the columns this extension fills in, it must not change during a scan
+	Columns() []string
+	// Extend returns values for the extension's columns, keyed by column name
+	// It may be called concurrently for different reports
+	Extend(ctx context.Context, report *Report) (map[string]string, error)
+}
+
+// ExecExtension is an Extension backed by an external program
+//
+// The program is run once as `program columns` and should print the names
+// of its columns, one per line. For each file it's then run as
+// `program report` with the report as JSON on stdin, and should print
+// `Column=value` lines for any columns it wants to fill in.
+type ExecExtension struct {
+	path    string
+	columns []string
+}
+
+// NewExecExtension asks the program at path for its columns
+func NewExecExtension(ctx context.Context, path string) (*ExecExtension, error) {
+	output, err := exec.CommandContext(ctx, path, "columns").Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get columns from plugin %q: %w", path, err)
+	}
+
+	e := &ExecExtension{path: path}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if column := strings.TrimSpace(scanner.Text()); column != "" {
+			e.columns = append(e.columns, column)
+		}
+	}
+	return e, scanner.Err()
+}
+
+func (e *ExecExtension) Columns() []string {
+	return e.columns
+}
+
+func (e *ExecExtension) Extend(ctx context.Context, report *Report) (map[string]string, error) {
+	input, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, e.path, "report")
+	cmd.Stdin = bytes.NewReader(input)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Plugin %q failed: %w", e.path, err)
+	}
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		column, value, ok := cut(scanner.Text(), "=")
+		if ok {
+			values[strings.TrimSpace(column)] = value
+		}
+	}
+	return values, scanner.Err()
+}
+
+// cut slices s around the first instance of sep, like strings.Cut in newer Go releases
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,73 @@
+package mediaaudit
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// Headers for Failure.ToSlice
+var FailureHeaders []string = []string{"ID", "Name", "Status", "Reason"}
+
+// Failure statuses
+const (
+	FailureError   string = "error"   // The probe failed outright
+	FailureTimeout string = "timeout" // The probe was killed after Scanner.ProbeTimeout
+	FailureParse   string = "parse"   // Parsing the file or a tool's output hit a bug, see ParseError
+	FailureInUse   string = "in-use"  // The file was still being written, see Scanner.SettleTime
+	FailureLocked  string = "locked"  // Another program still had the file locked, see Scanner.DeferLocked
+)
+
+// ParseError is a panic recovered while probing a single file, so one malformed file can't crash a scan
+type ParseError struct {
+	Path  string
+	Value interface{} // What was passed to panic
+	Stack []byte
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Unexpected failure parsing %q: %v", e.Path, e.Value)
+}
+
+// Failure is a file that couldn't be probed, and so has no Report
+type Failure struct {
+	ID     string
+	Path   string
+	Name   string // Path formatted for output, see Scanner.PathStyle
+	Status string // FailureError, FailureTimeout, FailureParse, FailureInUse or FailureLocked
+	Reason string
+}
+
+// ToSlice formats the failure as a row matching FailureHeaders
+func (f *Failure) ToSlice() []string {
+	return []string{f.ID, f.Name, f.Status, f.Reason}
+}
+
+// FailureWriter receives files that couldn't be probed
+// Like Writer, implementations don't need to be safe for concurrent use
+type FailureWriter interface {
+	WriteFailure(failure *Failure) error
+}
+
+// CSVFailureWriter streams each failure straight out as a CSV row
+type CSVFailureWriter struct {
+	writer *csv.Writer
+}
+
+// NewCSVFailureWriter returns a CSVFailureWriter that has already written the header row to w
+func NewCSVFailureWriter(w io.Writer) *CSVFailureWriter {
+	c := &CSVFailureWriter{writer: csv.NewWriter(w)}
+	c.writer.Write(FailureHeaders)
+	return c
+}
+
+func (c *CSVFailureWriter) WriteFailure(failure *Failure) error {
+	c.writer.Write(failure.ToSlice())
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *CSVFailureWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
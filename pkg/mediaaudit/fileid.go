@@ -0,0 +1,28 @@
+package mediaaudit
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fileID returns a short, stable identifier for a file
+// Where the platform gives us one we hash the device and inode, which survives renames,
+// otherwise we fall back to hashing the normalized absolute path
+func fileID(path string, info os.FileInfo) string {
+	var key string
+	if dev, ino, ok := fileIdentity(info); ok {
+		key = fmt.Sprintf("inode:%d:%d", dev, ino)
+	} else {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			abs = path
+		}
+		key = "path:" + filepath.ToSlash(filepath.Clean(abs))
+	}
+
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package mediaaudit
+
+import "os"
+
+// fileIdentity isn't available from a plain os.FileInfo here
+func fileIdentity(info os.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
+
+// linkCount isn't available from a plain os.FileInfo here
+func linkCount(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,374 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filter is a boolean expression evaluated against each report, e.g.
+//
+//	Height >= 1080 && BitrateMbps < 3 && Codec != "HEVC"
+//
+// Columns are referred to by their header name, in any case. Comparisons are numeric when
+// both sides are numbers and textual otherwise, =~ and !~ match a regular
+// expression, and a bare column is true if it's "true" or a non-zero number.
+// Expressions can be combined with &&, || and !, and grouped with parentheses.
+type Filter struct {
+	expression   string
+	extraColumns []string
+	root         filterNode
+}
+
+// ParseFilter compiles expression, checking that every column it uses is
+// either in ReportHeaders or in extraColumns, ignoring case
+func ParseFilter(expression string, extraColumns []string) (*Filter, error) {
+	tokens, err := lexFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens, extraColumns: extraColumns}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid filter %q: %w", expression, err)
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("Invalid filter %q: unexpected %q", expression, p.peek().text)
+	}
+	return &Filter{expression: expression, extraColumns: extraColumns, root: root}, nil
+}
+
+// String returns the expression the filter was parsed from
+func (f *Filter) String() string {
+	return f.expression
+}
+
+// Match reports whether report satisfies the filter
+func (f *Filter) Match(report *Report) bool {
+	return f.root.eval(report.Row(f.extraColumns))
+}
+
+type filterTokenKind int
+
+const (
+	tokenIdent filterTokenKind = iota
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+}
+
+// The operators we understand, longest first so that <= isn't read as <
+var filterOperators []string = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"}
+
+func lexFilter(expression string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '"' || r == '\'':
+			// Quoted strings, with backslash escapes for the quote itself
+			var value strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				value.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("Unterminated string in filter %q", expression)
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: value.String()})
+			i = j + 1
+
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: tokenNumber, text: string(runes[i:j])})
+			i = j
+
+		case unicode.IsLetter(r) || r == '_':
+			// Extra columns look like Video.Encoded_Library_Settings
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.' || runes[j] == '/') {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: tokenIdent, text: string(runes[i:j])})
+			i = j
+
+		default:
+			matched := false
+			for _, operator := range filterOperators {
+				if hasRunePrefix(runes[i:], operator) {
+					tokens = append(tokens, filterToken{kind: tokenOperator, text: operator})
+					i += len([]rune(operator))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("Unexpected %q in filter %q", r, expression)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// hasRunePrefix reports whether runes begins with prefix, without copying the rest of the expression
+func hasRunePrefix(runes []rune, prefix string) bool {
+	i := 0
+	for _, r := range prefix {
+		if i >= len(runes) || runes[i] != r {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+type filterParser struct {
+	tokens       []filterToken
+	pos          int
+	extraColumns []string
+}
+
+func (p *filterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.done() {
+		return filterToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+// accept consumes the next token if it's the given operator
+func (p *filterParser) accept(operator string) bool {
+	if !p.done() && p.peek().kind == tokenOperator && p.peek().text == operator {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+	if p.accept("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, operator := range []string{"==", "!=", "<=", ">=", "<", ">", "=~", "!~"} {
+		if !p.accept(operator) {
+			continue
+		}
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		if operator == "=~" || operator == "!~" {
+			literal, ok := right.(literalOperand)
+			if !ok {
+				return nil, fmt.Errorf("%s needs a literal regular expression on the right", operator)
+			}
+			pattern, err := regexp.Compile(string(literal))
+			if err != nil {
+				return nil, err
+			}
+			return matchNode{left: left, pattern: pattern, negate: operator == "!~"}, nil
+		}
+		return comparisonNode{operator: operator, left: left, right: right}, nil
+	}
+
+	return truthyNode{left}, nil
+}
+
+func (p *filterParser) parseOperand() (operand, error) {
+	if p.done() {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+
+	switch token.kind {
+	case tokenString, tokenNumber:
+		return literalOperand(token.text), nil
+	case tokenIdent:
+		if token.text == "true" || token.text == "false" {
+			return literalOperand(token.text), nil
+		}
+		columns, err := columnIndexes(p.extraColumns, []string{token.text})
+		if err != nil {
+			return nil, fmt.Errorf("unknown column %q", token.text)
+		}
+		return columnOperand(columns[0]), nil
+	}
+	return nil, fmt.Errorf("unexpected %q", token.text)
+}
+
+// filterNode is evaluated against a report's row, formatted once for the whole expression
+type filterNode interface {
+	eval(row []string) bool
+}
+
+// operand is either side of a comparison
+type operand interface {
+	value(row []string) string
+}
+
+type literalOperand string
+
+func (l literalOperand) value(row []string) string {
+	return string(l)
+}
+
+// columnOperand is the index of a column in the row
+type columnOperand int
+
+func (c columnOperand) value(row []string) string {
+	return row[c]
+}
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) eval(row []string) bool {
+	return n.left.eval(row) && n.right.eval(row)
+}
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) eval(row []string) bool {
+	return n.left.eval(row) || n.right.eval(row)
+}
+
+type notNode struct{ operand filterNode }
+
+func (n notNode) eval(row []string) bool {
+	return !n.operand.eval(row)
+}
+
+type truthyNode struct{ operand operand }
+
+func (n truthyNode) eval(row []string) bool {
+	value := n.operand.value(row)
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return number != 0
+	}
+	return value == "true"
+}
+
+type matchNode struct {
+	left    operand
+	pattern *regexp.Regexp
+	negate  bool
+}
+
+func (n matchNode) eval(row []string) bool {
+	return n.pattern.MatchString(n.left.value(row)) != n.negate
+}
+
+type comparisonNode struct {
+	operator    string
+	left, right operand
+}
+
+func (n comparisonNode) eval(row []string) bool {
+	left, right := n.left.value(row), n.right.value(row)
+
+	// Compare as numbers where we can, so that 720 < 1080
+	var cmp int
+	leftNumber, leftErr := strconv.ParseFloat(left, 64)
+	rightNumber, rightErr := strconv.ParseFloat(right, 64)
+	switch {
+	case leftErr == nil && rightErr == nil && leftNumber < rightNumber:
+		cmp = -1
+	case leftErr == nil && rightErr == nil && leftNumber > rightNumber:
+		cmp = 1
+	case leftErr == nil && rightErr == nil:
+		cmp = 0
+	default:
+		cmp = strings.Compare(left, right)
+	}
+
+	switch n.operator {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package mediaaudit
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	extraColumns := []string{"Video.Encoded_Library_Settings"}
+	report := &Report{Name: "Movie (2010).mkv", Codec: "AVC", Height: 1080, BitrateMbps: 2.5, Extra: map[string]string{"Video.Encoded_Library_Settings": "cabac=1 / ref=4"}}
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{`Height >= 1080 && BitrateMbps < 3 && Codec != "HEVC"`, true},
+		{`height >= 1080 && BITRATEMBPS < 3 && codec != "HEVC"`, true},
+		{`Height > 1080 || Codec == "HEVC"`, false},
+		{`!(Height < 720)`, true},
+		{`Video.Encoded_Library_Settings =~ 'ref=4'`, true},
+		{`video.encoded_library_settings !~ "ref=4"`, false},
+		{`ExtensionMismatch`, false},
+		{`Name == 'Movie (2010).mkv'`, true},
+	}
+	for _, test := range tests {
+		filter, err := ParseFilter(test.expression, extraColumns)
+		if err != nil {
+			t.Errorf("ParseFilter(%q) error = %v", test.expression, err)
+			continue
+		}
+		if got := filter.Match(report); got != test.want {
+			t.Errorf("ParseFilter(%q).Match() = %t, want %t", test.expression, got, test.want)
+		}
+	}
+
+	for _, expression := range []string{`Heigth > 1`, `Height >`, `(Height > 1`, `Name =~ Codec`, `"unterminated`} {
+		if _, err := ParseFilter(expression, extraColumns); err == nil {
+			t.Errorf("ParseFilter(%q) succeeded", expression)
+		}
+	}
+}
+
+func TestCondition(t *testing.T) {
+	reports := []*Report{
+		{Codec: "AVC", BitrateMbps: 2},
+		{Codec: "HEVC", BitrateMbps: 6},
+		{Codec: "AVC", BitrateMbps: 0.5},
+	}
+	tests := []struct {
+		expression string
+		value      float64
+		met        bool
+	}{
+		{`count(BitrateMbps < 1) > 0`, 1, true},
+		{`count() == 3`, 3, true},
+		{`percent(codec != "HEVC") > 50`, 2.0 / 3 * 100, true},
+		{`avg(bitratembps) < 2`, 8.5 / 3, false},
+		{`min(BitrateMbps) <= 0.5`, 0.5, true},
+		{`max(BitrateMbps) != 6`, 6, false},
+		{`sum(BITRATEMBPS) >= 8.5`, 8.5, true},
+	}
+	for _, test := range tests {
+		condition, err := ParseCondition(test.expression, nil)
+		if err != nil {
+			t.Errorf("ParseCondition(%q) error = %v", test.expression, err)
+			continue
+		}
+		for _, report := range reports {
+			condition.Add(report)
+		}
+		if value := condition.Value(); math.Abs(value-test.value) > 1e-9 {
+			t.Errorf("ParseCondition(%q).Value() = %g, want %g", test.expression, value, test.value)
+		}
+		if met := condition.Met(); met != test.met {
+			t.Errorf("ParseCondition(%q).Met() = %t, want %t", test.expression, met, test.met)
+		}
+	}
+}
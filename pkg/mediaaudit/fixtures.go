@@ -0,0 +1,144 @@
+package mediaaudit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fixture is a small synthetic media file covering a codec, container or edge case
+type Fixture struct {
+	Name        string // File name, the extension doesn't always match the container on purpose
+	Description string
+
+	args    []string // ffmpeg output options, after the test inputs
+	audio   int      // How many sine wave audio inputs to add
+	chapter bool     // Add chapters from a metadata input
+	after   func(path string) error
+}
+
+// Fixtures are the files GenerateFixtures writes
+var Fixtures []Fixture = []Fixture{
+	{Name: "h264_aac.mp4", Description: "H.264 and AAC in MP4, the common case", audio: 1,
+		args: []string{"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac", "-metadata:s:a:0", "language=eng"}},
+	{Name: "h264_faststart.mp4", Description: "H.264 in MP4 with the index before the media data", audio: 1,
+		args: []string{"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac", "-movflags", "+faststart"}},
+	{Name: "hevc_10bit.mkv", Description: "10-bit HEVC in Matroska", audio: 1,
+		args: []string{"-c:v", "libx265", "-pix_fmt", "yuv420p10le", "-c:a", "aac"}},
+	{Name: "hevc_hdr10.mkv", Description: "HEVC tagged as BT.2020 PQ", audio: 1,
+		args: []string{"-c:v", "libx265", "-pix_fmt", "yuv420p10le", "-color_primaries", "bt2020", "-color_trc", "smpte2084", "-colorspace", "bt2020nc", "-c:a", "aac"}},
+	{Name: "vp9_opus.webm", Description: "VP9 and Opus in WebM", audio: 1,
+		args: []string{"-c:v", "libvpx-vp9", "-deadline", "realtime", "-c:a", "libopus"}},
+	{Name: "av1.mkv", Description: "AV1 in Matroska", audio: 1,
+		args: []string{"-c:v", "libaom-av1", "-cpu-used", "8", "-row-mt", "1", "-c:a", "libopus"}},
+	{Name: "mpeg4_mp3.avi", Description: "MPEG-4 Visual and MP3 in AVI", audio: 1,
+		args: []string{"-c:v", "mpeg4", "-c:a", "libmp3lame"}},
+	{Name: "mpeg2.ts", Description: "MPEG-2 video in an MPEG transport stream", audio: 1,
+		args: []string{"-c:v", "mpeg2video", "-c:a", "mp2", "-f", "mpegts"}},
+	{Name: "interlaced.mkv", Description: "Interlaced H.264, top field first", audio: 1,
+		args: []string{"-c:v", "libx264", "-pix_fmt", "yuv420p", "-flags", "+ildct+ilme", "-x264opts", "tff=1", "-c:a", "aac"}},
+	{Name: "multi_audio.mkv", Description: "English and Japanese audio tracks plus an untagged one", audio: 3,
+		args: []string{"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac", "-metadata:s:a:0", "language=eng", "-metadata:s:a:1", "language=jpn"}},
+	{Name: "chapters.mkv", Description: "Three chapters", audio: 1, chapter: true,
+		args: []string{"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac"}},
+	{Name: "matroska_named.mp4", Description: "Matroska with an .mp4 extension", audio: 1,
+		args: []string{"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac", "-f", "matroska"}},
+	{Name: "audio_only.mkv", Description: "No video stream at all", audio: 1,
+		args: []string{"-vn", "-c:a", "aac"}},
+	{Name: "truncated.mp4", Description: "H.264 in MP4 cut off halfway through", audio: 1,
+		args:  []string{"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac"},
+		after: func(path string) error { return truncateFile(path, 2) }},
+}
+
+// truncateFile cuts the file at path down to 1/divisor of its size
+func truncateFile(path string, divisor int64) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.Truncate(path, info.Size()/divisor)
+}
+
+// GenerateFixtures writes every fixture to dir using ffmpeg, each lasting duration
+// Fixtures whose encoder isn't built into the local ffmpeg are skipped, and reported in the returned error
+// along with any other failures, the paths written are returned either way
+func GenerateFixtures(ctx context.Context, dir string, duration time.Duration) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	seconds := strconv.FormatFloat(duration.Seconds(), 'f', 3, 64)
+	chapters, err := writeChapterMetadata(dir, duration)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(chapters)
+
+	var written []string
+	var failed []string
+	for _, fixture := range Fixtures {
+		path := filepath.Join(dir, fixture.Name)
+		if err := generateFixture(ctx, fixture, path, seconds, chapters); err != nil {
+			os.Remove(path)
+			failed = append(failed, fmt.Sprintf("%s: %s", fixture.Name, err.Error()))
+			continue
+		}
+		written = append(written, path)
+	}
+
+	if len(failed) > 0 {
+		return written, fmt.Errorf("Failed to generate %d of %d fixtures:\n%s", len(failed), len(Fixtures), strings.Join(failed, "\n"))
+	}
+	return written, nil
+}
+
+// generateFixture runs ffmpeg to write a single fixture to path
+func generateFixture(ctx context.Context, fixture Fixture, path, seconds, chapters string) error {
+	args := []string{"-v", "error", "-y",
+		"-f", "lavfi", "-i", "testsrc2=size=320x240:rate=25:duration=" + seconds}
+	for i := 0; i < fixture.audio; i++ {
+		args = append(args, "-f", "lavfi", "-i", fmt.Sprintf("sine=frequency=%d:duration=%s", 440*(i+1), seconds))
+	}
+	if fixture.chapter {
+		args = append(args, "-f", "ffmetadata", "-i", chapters, "-map_chapters", strconv.Itoa(fixture.audio+1))
+	}
+	for i := 0; i <= fixture.audio; i++ {
+		args = append(args, "-map", strconv.Itoa(i))
+	}
+	args = append(args, fixture.args...)
+	args = append(args, path)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return fmt.Errorf("%w: %s", err, message)
+		}
+		return err
+	}
+
+	if fixture.after != nil {
+		return fixture.after(path)
+	}
+	return nil
+}
+
+// writeChapterMetadata writes an ffmetadata file splitting duration into three chapters
+func writeChapterMetadata(dir string, duration time.Duration) (string, error) {
+	file, err := os.CreateTemp(dir, "chapters-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	length := duration.Milliseconds() / 3
+	fmt.Fprintln(file, ";FFMETADATA1")
+	for i := int64(0); i < 3; i++ {
+		fmt.Fprintf(file, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=Chapter %d\n", i*length, (i+1)*length, i+1)
+	}
+	return file.Name(), file.Close()
+}
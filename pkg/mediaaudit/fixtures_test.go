@@ -0,0 +1,161 @@
+package mediaaudit
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// generateTestFixtures writes the fixtures to a temporary directory, skipping the test without ffmpeg
+// Fixtures the local ffmpeg has no encoder for are left out, so only the names returned should be checked
+func generateTestFixtures(t *testing.T) (string, map[string]bool) {
+	t.Helper()
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg isn't on the PATH")
+	}
+	dir := t.TempDir()
+	written, err := GenerateFixtures(context.Background(), dir, 2*time.Second)
+	if err != nil {
+		t.Log(err)
+	}
+	names := make(map[string]bool)
+	for _, path := range written {
+		names[filepath.Base(path)] = true
+	}
+	return dir, names
+}
+
+func TestFixtureStructure(t *testing.T) {
+	dir, names := generateTestFixtures(t)
+	for _, fixture := range Fixtures {
+		if !names[fixture.Name] {
+			continue
+		}
+		t.Run(fixture.Name, func(t *testing.T) {
+			check, err := checkStructure(filepath.Join(dir, fixture.Name))
+			switch fixture.Name {
+			case "mpeg2.ts":
+				if !errors.Is(err, errUnsupportedContainer) {
+					t.Errorf("checkStructure() error = %v, want %v", err, errUnsupportedContainer)
+				}
+			case "truncated.mp4":
+				if err != nil {
+					t.Fatalf("checkStructure() error = %v", err)
+				}
+				if check.String() == "ok" {
+					t.Errorf("checkStructure() = ok for a file cut off halfway through")
+				}
+			default:
+				if err != nil {
+					t.Fatalf("checkStructure() error = %v", err)
+				}
+				if check.String() != "ok" || check.trailingBytes() != 0 {
+					t.Errorf("checkStructure() = %q with %d trailing bytes, want ok with none", check.String(), check.trailingBytes())
+				}
+			}
+		})
+	}
+}
+
+// collectingWriter keeps every report and failure by name, the scanner serialises the writes
+type collectingWriter struct {
+	reports  map[string]*Report
+	failures map[string]*Failure
+}
+
+func (w *collectingWriter) Write(report *Report) error {
+	w.reports[report.Name] = report
+	return nil
+}
+
+func (w *collectingWriter) WriteFailure(failure *Failure) error {
+	w.failures[failure.Name] = failure
+	return nil
+}
+
+func (w *collectingWriter) Close() error {
+	return nil
+}
+
+func TestFixtureProbe(t *testing.T) {
+	if _, err := exec.LookPath("mediainfo"); err != nil {
+		t.Skip("mediainfo isn't on the PATH")
+	}
+	dir, names := generateTestFixtures(t)
+
+	backend, err := NewMediaInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	w := &collectingWriter{reports: make(map[string]*Report), failures: make(map[string]*Failure)}
+	scanner := &Scanner{
+		Backend:         backend,
+		VideoExtensions: append(append([]string{}, DefaultVideoExtensions...), "webm"),
+		Verify:          VerifyStructure,
+		Failures:        w,
+	}
+	if err := scanner.Scan(context.Background(), dir, w); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name              string
+		container         string
+		codec             string
+		transfer          string // Only checked if set
+		extensionMismatch bool
+		structure         string
+	}{
+		{name: "h264_aac.mp4", container: "MPEG-4", codec: "AVC", structure: "ok"},
+		{name: "h264_faststart.mp4", container: "MPEG-4", codec: "AVC", structure: "ok"},
+		{name: "hevc_10bit.mkv", container: "Matroska", codec: "HEVC", structure: "ok"},
+		{name: "hevc_hdr10.mkv", container: "Matroska", codec: "HEVC", transfer: "PQ", structure: "ok"},
+		{name: "vp9_opus.webm", container: "WebM", codec: "VP9", structure: "ok"},
+		{name: "av1.mkv", container: "Matroska", codec: "AV1", structure: "ok"},
+		{name: "mpeg4_mp3.avi", container: "AVI", codec: "MPEG-4 Visual", structure: "ok"},
+		{name: "mpeg2.ts", container: "MPEG-TS", codec: "MPEG Video", structure: ""},
+		{name: "interlaced.mkv", container: "Matroska", codec: "AVC", structure: "ok"},
+		{name: "multi_audio.mkv", container: "Matroska", codec: "AVC", structure: "ok"},
+		{name: "chapters.mkv", container: "Matroska", codec: "AVC", structure: "ok"},
+		{name: "matroska_named.mp4", container: "Matroska", codec: "AVC", extensionMismatch: true, structure: "ok"},
+	}
+	for _, test := range tests {
+		if !names[test.name] {
+			continue
+		}
+		t.Run(test.name, func(t *testing.T) {
+			report, ok := w.reports[test.name]
+			if !ok {
+				t.Fatalf("No report, failure: %+v", w.failures[test.name])
+			}
+			if report.Container != test.container || report.Codec != test.codec {
+				t.Errorf("Got %s in %s, want %s in %s", report.Codec, report.Container, test.codec, test.container)
+			}
+			if test.transfer != "" && report.TransferCharacteristics != test.transfer {
+				t.Errorf("TransferCharacteristics = %q, want %q", report.TransferCharacteristics, test.transfer)
+			}
+			if report.ExtensionMismatch != test.extensionMismatch {
+				t.Errorf("ExtensionMismatch = %t, want %t", report.ExtensionMismatch, test.extensionMismatch)
+			}
+			if report.Structure != test.structure {
+				t.Errorf("Structure = %q, want %q", report.Structure, test.structure)
+			}
+		})
+	}
+
+	// Neither of these should pass an audit
+	if names["audio_only.mkv"] {
+		if _, ok := w.failures["audio_only.mkv"]; !ok {
+			t.Errorf("audio_only.mkv wasn't recorded as a failure")
+		}
+	}
+	if names["truncated.mp4"] {
+		if report, ok := w.reports["truncated.mp4"]; ok && report.Structure == "ok" {
+			t.Errorf("truncated.mp4 has a sound structure")
+		}
+	}
+}
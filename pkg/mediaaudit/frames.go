@@ -0,0 +1,128 @@
+package mediaaudit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// Frames are sampled from this many stretches of each file, spread like -decode-segments, each this long
+	frameSamples      = 5
+	frameSampleLength = 20 * time.Second
+	// Black and frozen frames don't need the full resolution to be found, a frame unchanged for half a second is frozen
+	frameFilter string = "scale=320:-2," + blackFilter + ",freezedetect=n=-60dB:d=0.5"
+	// defaultFrameRate is assumed when the frame rate isn't known, to turn seconds into frames
+	defaultFrameRate float64 = 25
+
+	// A file with more than these percentages of its sampled frames black, frozen or corrupt is unwatchable
+	maxBlackPercent   float64 = 25
+	maxFrozenPercent  float64 = 25
+	maxCorruptPercent float64 = 5
+)
+
+// Matches freezedetect's output, e.g. "lavfi.freezedetect.freeze_start: 12.3" and "lavfi.freezedetect.freeze_end: 15"
+var (
+	freezeStartRegex *regexp.Regexp = regexp.MustCompile(`freeze_start:\s*([\d.]+)`)
+	freezeEndRegex   *regexp.Regexp = regexp.MustCompile(`freeze_end:\s*([\d.]+)`)
+)
+
+// frameSample is what was found in one sampled stretch of a file
+type frameSample struct {
+	seconds       float64
+	blackSeconds  float64
+	frozenSeconds float64
+	corruptFrames int
+}
+
+// sampleFrames decodes one stretch of the file at path, counting how much of it is black, frozen or failed to decode
+// Decoders log every error in a frame at the error level, so corruptFrames is an upper bound
+func sampleFrames(ctx context.Context, path string, segment decodeSegment) (frameSample, error) {
+	// The error level prefix tells decoding errors apart from the filters' own output
+	output, err := runFFmpegFilter(ctx, "-loglevel", "level+info", "-ss", formatSeconds(segment.start), "-t", formatSeconds(segment.length), "-i", path, "-map", "0:v:0", "-vf", frameFilter)
+	if err != nil {
+		return frameSample{}, err
+	}
+
+	sample := frameSample{seconds: segment.length}
+	for _, black := range parseBlack(output) {
+		sample.blackSeconds += black.within(segment.length)
+	}
+	for _, freeze := range parseIntervals(output, freezeStartRegex, freezeEndRegex, segment.length) {
+		sample.frozenSeconds += freeze.within(segment.length)
+	}
+	sample.corruptFrames = strings.Count(output, "[error]")
+	return sample, nil
+}
+
+// checkFrames samples the file at path, filling in the percentages of black, frozen and corrupt frames,
+// and returns ok, or which of them are too high to watch
+func checkFrames(ctx context.Context, report *Report, path string) (string, error) {
+	if report.DurationSeconds <= 0 {
+		return "", fmt.Errorf("Unknown duration for %q", path)
+	}
+	segments := decodeSegments(report.DurationSeconds, frameSamples, frameSampleLength)
+	if segments == nil {
+		segments = []decodeSegment{{start: 0, length: report.DurationSeconds}}
+	}
+
+	var total frameSample
+	for _, segment := range segments {
+		sample, err := sampleFrames(ctx, path, segment)
+		if err != nil {
+			return "", err
+		}
+		total.seconds += sample.seconds
+		total.blackSeconds += sample.blackSeconds
+		total.frozenSeconds += sample.frozenSeconds
+		total.corruptFrames += sample.corruptFrames
+	}
+
+	frameRate := report.FrameRate
+	if frameRate <= 0 {
+		frameRate = defaultFrameRate
+	}
+	black := math.Min(percentOf(total.blackSeconds, total.seconds), 100)
+	frozen := math.Min(percentOf(total.frozenSeconds, total.seconds), 100)
+	corrupt := math.Min(percentOf(float64(total.corruptFrames), total.seconds*frameRate), 100)
+	report.BlackPercent = fmt.Sprintf("%.1f", black)
+	report.FrozenPercent = fmt.Sprintf("%.1f", frozen)
+	report.CorruptPercent = fmt.Sprintf("%.1f", corrupt)
+
+	var problems []string
+	for _, check := range []struct {
+		name           string
+		percent, limit float64
+	}{
+		{"black", black, maxBlackPercent},
+		{"frozen", frozen, maxFrozenPercent},
+		{"corrupt", corrupt, maxCorruptPercent},
+	} {
+		if check.percent > check.limit {
+			problems = append(problems, fmt.Sprintf("%.0f%% %s", check.percent, check.name))
+		}
+	}
+	if len(problems) == 0 {
+		return "ok", nil
+	}
+	return strings.Join(problems, ", "), nil
+}
+
+// checkFrames fills in the frame check for the file at path, waiting its turn in the heavy work queue
+func (s *Scanner) checkFrames(ctx context.Context, report *Report, path string) {
+	if err := s.qualitySem.Acquire(ctx, 1); err != nil {
+		return
+	}
+	defer s.qualitySem.Release(1)
+
+	s.logf(LevelDebug, path, "Sampling frames of %q", path)
+	result, err := checkFrames(ctx, report, path)
+	if err != nil {
+		s.logf(LevelWarn, path, "Failed to sample the frames of %q: %s", path, err.Error())
+		return
+	}
+	report.Frames = result
+}
@@ -0,0 +1,88 @@
+//go:build go1.18
+// +build go1.18
+
+package mediaaudit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// The parsers below all read files or output we don't control, so none of them should panic whatever they're given
+
+func FuzzCheckStructure(f *testing.F) {
+	for _, seed := range [][]byte{testMP4(), testMKV(), testAVI()} {
+		f.Add(seed)
+		f.Add(seed[:len(seed)/2])
+		f.Add(append(append([]byte{}, seed...), "junk"...))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		size := int64(len(data))
+		check, err := walkStructure(bytes.NewReader(data), size)
+		if err != nil {
+			return
+		}
+		if trailing := check.trailingBytes(); trailing < 0 || trailing > size {
+			t.Errorf("trailingBytes() = %d for a file of %d bytes", trailing, size)
+		}
+		bmffEnd(bytes.NewReader(data), size)
+		matroskaEnd(bytes.NewReader(data), size)
+	})
+}
+
+func FuzzParseMediaInfo(f *testing.F) {
+	sections := make(map[string]mediainfoSection)
+	for _, section := range mediainfoSections {
+		sections[section.name] = section
+	}
+	extra := ExtraField{Column: "Video.Encoded_Library_Settings", Section: "Video", Expression: "%Encoded_Library_Settings%"}
+	video := sections["Video"]
+	video.extra = []ExtraField{extra}
+	sections["Video"] = video
+
+	seed := func(lines ...string) string {
+		return strings.ReplaceAll(strings.Join(lines, "\n"), "|", mediainfoSeparator)
+	}
+	f.Add(seed("General|5000000|Matroska|1320000.000|||",
+		"Video|AVC|1920|1080||4000000||Progressive|8|BT.709|BT.709|4:2:0|1.778|1.000|23.976|High||||||cabac=1",
+		"Audio|eng|2|",
+		"Other|Time code|01:00:00:00|A001 C002"))
+	f.Add(seed("General|||\r", "Menu|00:00:00.000|"))
+	f.Add("Video")
+	f.Fuzz(func(t *testing.T, output string) {
+		streams, _, err := parseMediaInfo(output, sections, "fuzz.mkv")
+		if err != nil {
+			return
+		}
+		for name, values := range streams {
+			for _, stream := range values {
+				if len(stream) != len(sections[name].fields) {
+					t.Errorf("%s stream has %d values, want %d", name, len(stream), len(sections[name].fields))
+				}
+			}
+		}
+	})
+}
+
+func FuzzParseFilter(f *testing.F) {
+	f.Add(`Height >= 1080 && BitrateMbps < 3 && Codec != "HEVC"`)
+	f.Add(`!(Name =~ '^The \'.*') || Video.Encoded_Library_Settings !~ "x26[45]"`)
+	f.Add(`-1.5 < Width`)
+	f.Add(`count(BitrateMbps < 1) > 0`)
+	f.Add(`avg(BitrateMbps) <= 4.5`)
+	f.Fuzz(func(t *testing.T, expression string) {
+		extraColumns := []string{"Video.Encoded_Library_Settings"}
+		report := &Report{Name: "fuzz.mkv", Extra: map[string]string{"Video.Encoded_Library_Settings": "cabac=1"}}
+		if filter, err := ParseFilter(expression, extraColumns); err == nil {
+			filter.Match(report)
+		}
+		if condition, err := ParseCondition(expression, extraColumns); err == nil {
+			condition.Add(report)
+			condition.Met()
+			if !strings.Contains(condition.String(), "(") {
+				t.Errorf("Condition %q has no aggregate", condition.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package mediaaudit
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// The number of frames we hand to idet, enough to get a confident answer without decoding the whole file
+const idetFrames string = "500"
+
+// Matches ffmpeg's summary line, e.g. "Multi frame detection: TFF:  0 BFF:  0 Progressive:  498 Undetermined:  2"
+var idetSummaryRegex *regexp.Regexp = regexp.MustCompile(`Multi frame detection:\s*TFF:\s*(\d+)\s*BFF:\s*(\d+)\s*Progressive:\s*(\d+)`)
+
+// ambiguousScanType reports whether the scan type from mediainfo is worth a second look
+func ambiguousScanType(scanType string) bool {
+	switch scanType {
+	case "", "MBAFF", "Mixed":
+		return true
+	}
+	return false
+}
+
+// detectScanType decodes the start of the file with ffmpeg's idet filter
+// and classifies it based on the majority of the frames
+func detectScanType(ctx context.Context, path string) (string, error) {
+	cmd := toolCommand(ctx, "ffmpeg", "-hide_banner", "-nostats", "-i", path, "-an", "-sn", "-vf", "idet", "-frames:v", idetFrames, "-f", "null", "-")
+	// ffmpeg writes filter stats to stderr
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", err
+	}
+
+	matches := idetSummaryRegex.FindAllStringSubmatch(string(output), -1)
+	if len(matches) == 0 {
+		return "", fmt.Errorf("No idet summary in ffmpeg output for %q", path)
+	}
+	// Only the last summary covers the full run
+	summary := matches[len(matches)-1]
+
+	var counts [3]int
+	for i := range counts {
+		counts[i], err = strconv.Atoi(summary[i+1])
+		if err != nil {
+			return "", err
+		}
+	}
+	tff, bff, progressive := counts[0], counts[1], counts[2]
+
+	if tff+bff > progressive {
+		return "Interlaced (idet)", nil
+	}
+	return "Progressive (idet)", nil
+}
@@ -0,0 +1,176 @@
+package mediaaudit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line protocol measurements written by LineProtocolWriter
+const (
+	measurementScan  string = "mediaaudit_scan"
+	measurementCodec string = "mediaaudit_codec"
+	measurementFile  string = "mediaaudit_file"
+)
+
+var (
+	lineProtocolTagEscaper    *strings.Replacer = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+	lineProtocolStringEscaper *strings.Replacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// LineProtocolWriter pushes scan aggregates, and optionally a point per file, to InfluxDB
+// or anything else accepting line protocol over HTTP
+// Points are buffered and sent in one request on Close, all timestamped with when the writer was created
+type LineProtocolWriter struct {
+	url   string // The full write URL, e.g. http://localhost:8086/api/v2/write?org=home&bucket=media
+	token string // Sent as an InfluxDB API token, if set
+	tags  string // Escaped tags added to every point
+	files bool   // Write a point per file as well as the aggregates
+
+	client    *http.Client
+	timestamp int64
+	points    bytes.Buffer
+
+	count            int
+	sizeMB           float64
+	uniqueSizeMB     float64 // Counting hardlinked files once
+	seen             map[string]bool
+	bitrateMbps      float64
+	interlaced       int
+	mismatched       int
+	missingAudio     int
+	missingSubtitles int
+	codecs           map[string]int
+	codecSizeMB      map[string]float64
+}
+
+// NewLineProtocolWriter returns a LineProtocolWriter for url, tagging every point with root
+// so scans of different libraries can share a bucket
+func NewLineProtocolWriter(url, token, root string, files bool) *LineProtocolWriter {
+	return &LineProtocolWriter{
+		url:         url,
+		token:       token,
+		tags:        ",root=" + lineProtocolTagEscaper.Replace(root),
+		files:       files,
+		client:      &http.Client{Timeout: time.Minute},
+		timestamp:   time.Now().UnixNano(),
+		seen:        make(map[string]bool),
+		codecs:      make(map[string]int),
+		codecSizeMB: make(map[string]float64),
+	}
+}
+
+// lineProtocolTag formats a tag, dropping it if it's empty since line protocol doesn't allow empty tag values
+func lineProtocolTag(key, value string) string {
+	if value == "" {
+		return ""
+	}
+	return "," + key + "=" + lineProtocolTagEscaper.Replace(value)
+}
+
+func lineProtocolString(value string) string {
+	return `"` + lineProtocolStringEscaper.Replace(value) + `"`
+}
+
+func lineProtocolFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (l *LineProtocolWriter) point(measurement, tags string, fields []string) {
+	fmt.Fprintf(&l.points, "%s%s%s %s %d\n", measurement, l.tags, tags, strings.Join(fields, ","), l.timestamp)
+}
+
+func (l *LineProtocolWriter) Write(report *Report) error {
+	l.count++
+	l.sizeMB += report.SizeMB
+	if !l.seen[report.ID] {
+		l.seen[report.ID] = true
+		l.uniqueSizeMB += report.SizeMB
+	}
+	l.bitrateMbps += report.BitrateMbps
+	if strings.HasPrefix(report.ScanType, "Interlaced") || report.ScanType == "MBAFF" {
+		l.interlaced++
+	}
+	if report.ExtensionMismatch {
+		l.mismatched++
+	}
+	if len(report.MissingAudioLanguages) > 0 {
+		l.missingAudio++
+	}
+	if len(report.MissingSubtitleLanguages) > 0 {
+		l.missingSubtitles++
+	}
+	l.codecs[report.Codec]++
+	l.codecSizeMB[report.Codec] += report.SizeMB
+
+	if l.files {
+		l.point(measurementFile, lineProtocolTag("id", report.ID)+lineProtocolTag("codec", report.Codec)+lineProtocolTag("container", report.Container), []string{
+			"name=" + lineProtocolString(report.Name),
+			"size_mb=" + lineProtocolFloat(report.SizeMB),
+			fmt.Sprintf("hardlinks=%di", report.Hardlinks),
+			"bitrate_mbps=" + lineProtocolFloat(report.BitrateMbps),
+			fmt.Sprintf("width=%di", report.Width),
+			fmt.Sprintf("height=%di", report.Height),
+			"duration_seconds=" + lineProtocolFloat(report.DurationSeconds),
+		})
+	}
+	return nil
+}
+
+// Close adds the aggregate points and sends everything
+func (l *LineProtocolWriter) Close() error {
+	meanBitrate := 0.0
+	if l.count > 0 {
+		meanBitrate = l.bitrateMbps / float64(l.count)
+	}
+	l.point(measurementScan, "", []string{
+		fmt.Sprintf("files=%di", l.count),
+		"size_mb=" + lineProtocolFloat(l.sizeMB),
+		"unique_size_mb=" + lineProtocolFloat(l.uniqueSizeMB),
+		"mean_bitrate_mbps=" + lineProtocolFloat(meanBitrate),
+		fmt.Sprintf("interlaced=%di", l.interlaced),
+		fmt.Sprintf("extension_mismatch=%di", l.mismatched),
+		fmt.Sprintf("missing_audio_languages=%di", l.missingAudio),
+		fmt.Sprintf("missing_subtitle_languages=%di", l.missingSubtitles),
+	})
+
+	codecs := make([]string, 0, len(l.codecs))
+	for codec := range l.codecs {
+		codecs = append(codecs, codec)
+	}
+	sort.Strings(codecs)
+	for _, codec := range codecs {
+		name := codec
+		if name == "" {
+			name = "unknown"
+		}
+		l.point(measurementCodec, lineProtocolTag("codec", name), []string{
+			fmt.Sprintf("files=%di", l.codecs[codec]),
+			"size_mb=" + lineProtocolFloat(l.codecSizeMB[codec]),
+		})
+	}
+
+	request, err := http.NewRequest(http.MethodPost, l.url, &l.points)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if l.token != "" {
+		request.Header.Set("Authorization", "Token "+l.token)
+	}
+	response, err := l.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("Failed to send metrics: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("Failed to send metrics, %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Codec licensing families
+// These are a starting point for a legal review, not legal advice: pools, terms and patent terms vary by country
+const (
+	LicensingRoyaltyBearing string = "royalty-bearing" // Covered by active patent pools, e.g. AVC and HEVC
+	LicensingRoyaltyFree    string = "royalty-free"    // Offered royalty-free by their developers, e.g. AV1 and VP9
+	LicensingExpired        string = "expired"         // The essential patents have expired in most countries, e.g. MPEG-2
+	LicensingProprietary    string = "proprietary"     // Licensed directly by a single vendor, e.g. ProRes
+	LicensingUnknown        string = "unknown"
+)
+
+// codecLicensing maps the codecs mediainfo reports to their licensing family
+var codecLicensing map[string]string = map[string]string{
+	"AVC":           LicensingRoyaltyBearing,
+	"HEVC":          LicensingRoyaltyBearing,
+	"VVC":           LicensingRoyaltyBearing,
+	"VC-1":          LicensingRoyaltyBearing,
+	"MPEG-4 Visual": LicensingRoyaltyBearing,
+	"AV1":           LicensingRoyaltyFree,
+	"VP8":           LicensingRoyaltyFree,
+	"VP9":           LicensingRoyaltyFree,
+	"Theora":        LicensingRoyaltyFree,
+	"JPEG 2000":     LicensingRoyaltyFree,
+	"CineForm":      LicensingRoyaltyFree,
+	"MPEG Video":    LicensingExpired,
+	"JPEG":          LicensingExpired,
+	"ProRes":        LicensingProprietary,
+	"VC-3":          LicensingProprietary,
+}
+
+// CodecLicensing returns the licensing family of a video codec, as named by mediainfo, LicensingUnknown if we don't know it
+func CodecLicensing(codec string) string {
+	if family, ok := codecLicensing[codec]; ok {
+		return family
+	}
+	return LicensingUnknown
+}
+
+// licensingTotal is what a LicensingWriter has seen of one family
+type licensingTotal struct {
+	files  int
+	sizeMB float64
+	codecs map[string]bool
+}
+
+// LicensingWriter is a Writer that tallies files and sizes by codec licensing family,
+// and prints the breakdown when closed
+// Hardlinked files are only counted once
+type LicensingWriter struct {
+	out    io.Writer
+	totals map[string]*licensingTotal
+	seen   map[string]bool
+}
+
+// NewLicensingWriter returns a LicensingWriter that prints to out
+func NewLicensingWriter(out io.Writer) *LicensingWriter {
+	return &LicensingWriter{out: out, totals: make(map[string]*licensingTotal), seen: make(map[string]bool)}
+}
+
+func (l *LicensingWriter) Write(report *Report) error {
+	if l.seen[report.ID] {
+		return nil
+	}
+	l.seen[report.ID] = true
+
+	family := CodecLicensing(report.Codec)
+	total, ok := l.totals[family]
+	if !ok {
+		total = &licensingTotal{codecs: make(map[string]bool)}
+		l.totals[family] = total
+	}
+	total.files++
+	total.sizeMB += report.SizeMB
+	total.codecs[report.Codec] = true
+	return nil
+}
+
+// Close prints each family's share of files and of size, largest first, with the codecs seen in it
+func (l *LicensingWriter) Close() error {
+	files, sizeMB := 0, 0.0
+	var families []string
+	for family, total := range l.totals {
+		families = append(families, family)
+		files += total.files
+		sizeMB += total.sizeMB
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return l.totals[families[i]].sizeMB > l.totals[families[j]].sizeMB
+	})
+
+	fmt.Fprintf(l.out, "Codec licensing for %d files, %.2f GiB:\n", files, sizeMB/1024)
+	table := tabwriter.NewWriter(l.out, 0, 8, 2, ' ', 0)
+	for _, family := range families {
+		total := l.totals[family]
+		var codecs []string
+		for codec := range total.codecs {
+			codecs = append(codecs, codec)
+		}
+		sort.Strings(codecs)
+		fmt.Fprintf(table, "%s\t%d files\t%.1f%%\t%.2f GiB\t%.1f%%\t%s\n", family, total.files, percentOf(float64(total.files), float64(files)), total.sizeMB/1024, percentOf(total.sizeMB, sizeMB), strings.Join(codecs, ", "))
+	}
+	return table.Flush()
+}
+
+// percentOf is value as a percentage of total, or 0 if total is 0
+func percentOf(value, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return value / total * 100
+}
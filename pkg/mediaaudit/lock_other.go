@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !windows
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!windows
+
+package mediaaudit
+
+// fileLocked can't tell here, so nothing is ever locked
+func fileLocked(path string) bool {
+	return false
+}
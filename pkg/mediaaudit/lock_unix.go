@@ -0,0 +1,26 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package mediaaudit
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileLocked reports whether another process holds an exclusive lock on the file at path
+// Locks are advisory here, so this only catches programs that take one, and not every network filesystem supports them
+func fileLocked(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	fd := int(file.Fd())
+	err = syscall.Flock(fd, syscall.LOCK_SH|syscall.LOCK_NB)
+	if err == nil {
+		syscall.Flock(fd, syscall.LOCK_UN)
+	}
+	return err == syscall.EWOULDBLOCK
+}
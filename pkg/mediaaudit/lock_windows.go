@@ -0,0 +1,25 @@
+package mediaaudit
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Windows error codes for a file another process opened without sharing it
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// fileLocked reports whether another process has the file at path open without letting others read it,
+// as download clients and transcoders often do while writing
+func fileLocked(path string) bool {
+	file, err := os.Open(path)
+	if err == nil {
+		file.Close()
+		return false
+	}
+	var errno syscall.Errno
+	return errors.As(err, &errno) && (errno == errorSharingViolation || errno == errorLockViolation)
+}
@@ -0,0 +1,43 @@
+package mediaaudit
+
+import "log"
+
+// LogLevel is how important a log message is
+type LogLevel int
+
+// Log levels, from least to most important
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	}
+	return "error"
+}
+
+// Logger receives log messages from a scan
+// path is the file the message is about, empty if it isn't about a particular file
+// It may be called concurrently
+type Logger interface {
+	Log(level LogLevel, path string, message string)
+}
+
+// stdLogger sends everything but debug messages to the standard library's logger
+// It's what a Scanner uses when no Logger is set
+type stdLogger struct{}
+
+func (stdLogger) Log(level LogLevel, path string, message string) {
+	if level > LevelDebug {
+		log.Println(message)
+	}
+}
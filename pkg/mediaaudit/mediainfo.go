@@ -0,0 +1,422 @@
+package mediaaudit
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The fields we need from each mediainfo section, in the order they're parsed below
+var mediainfoSections []mediainfoSection = []mediainfoSection{
+	{name: "General", fields: []string{"%OverallBitRate%", "%Format%", "%Duration%", "%Encoded_Hardware_CompanyName%", "%Encoded_Hardware_Model_Name%", "%Encoded_Hardware_Name%"}},
+	{name: "Video", fields: []string{"%Format%", "%Width%", "%Height%", "%BitRate_Maximum%", "%BitRate%", "%BitRate_Nominal%", "%ScanType%", "%BitDepth%", "%colour_primaries%", "%transfer_characteristics%", "%ChromaSubsampling%", "%DisplayAspectRatio%", "%PixelAspectRatio%", "%FrameRate%", "%Format_Profile%", "%Format_Commercial_IfAny%", "%TimeCode_FirstFrame%", "%ID%", "%MenuID%", "%HDR_Format%"}},
+	{name: "Audio", fields: []string{"%Language/String3%", "%Channel(s)%", "%MenuID%"}},
+	{name: "Text", fields: []string{"%Language/String3%", "%Format%", "%MenuID%"}},
+	{name: "Menu", fields: []string{"%Chapters_Pos_Begin%", "%Chapters_Pos_End%"}},
+	{name: "Other", fields: []string{"%Type%", "%TimeCode_FirstFrame%", "%Title%"}},
+}
+
+// Fields are separated with the ASCII unit separator, which unlike commas or pipes won't turn up in
+// titles, encoder settings or a reel name typed in on set
+const mediainfoSeparator = "\x1f"
+
+// Every kind of stream mediainfo knows about, and so can be used in a template
+var mediainfoStreamKinds map[string]bool = map[string]bool{
+	"General": true, "Video": true, "Audio": true, "Text": true, "Other": true, "Image": true, "Menu": true,
+}
+
+type mediainfoSection struct {
+	name   string
+	fields []string
+	extra  []ExtraField
+}
+
+// ExtraField is an additional mediainfo parameter to capture as its own column
+type ExtraField struct {
+	Column     string // e.g. Video.Encoded_Library_Settings
+	Section    string // e.g. Video
+	Expression string // e.g. %Encoded_Library_Settings%
+}
+
+// ParseExtraField parses a field in mediainfo's template syntax, e.g. Video;%Encoded_Library_Settings%
+func ParseExtraField(field string) (ExtraField, error) {
+	section, expression, ok := cut(field, ";")
+	if !ok || !mediainfoStreamKinds[section] || expression == "" {
+		return ExtraField{}, fmt.Errorf("Invalid mediainfo field %q, expected something like Video;%%Encoded_Library_Settings%%", field)
+	}
+	if strings.ContainsAny(expression, mediainfoSeparator+"\n") || strings.Contains(expression, `\n`) {
+		return ExtraField{}, fmt.Errorf("Invalid mediainfo field %q, it can't contain newlines", field)
+	}
+	return ExtraField{
+		Column:     section + "." + strings.ReplaceAll(expression, "%", ""),
+		Section:    section,
+		Expression: expression,
+	}, nil
+}
+
+// MediaInfo is a Backend that shells out to the mediainfo CLI
+type MediaInfo struct {
+	Program int // For transport streams with more than one program, e.g. from a DVR, the program number to report, the first if 0
+	PID     int // For transport streams, the PID of the video stream to report, overrides Program
+
+	templatePath string
+	sections     map[string]mediainfoSection
+	extraColumns []string
+}
+
+// NewMediaInfo prepares a MediaInfo backend, call Close once done with it
+// Any extra fields are captured in Report.Extra
+func NewMediaInfo(extraFields ...ExtraField) (*MediaInfo, error) {
+	m := &MediaInfo{sections: make(map[string]mediainfoSection)}
+	var order []string
+	for _, section := range mediainfoSections {
+		m.sections[section.name] = section
+		order = append(order, section.name)
+	}
+	for _, field := range extraFields {
+		section, ok := m.sections[field.Section]
+		if !ok {
+			section = mediainfoSection{name: field.Section}
+			order = append(order, field.Section)
+		}
+		section.extra = append(section.extra, field)
+		m.sections[field.Section] = section
+		m.extraColumns = append(m.extraColumns, field.Column)
+	}
+
+	templatePath, err := writeMediaInfoTemplate(order, m.sections)
+	if err != nil {
+		return nil, err
+	}
+	m.templatePath = templatePath
+	return m, nil
+}
+
+// writeMediaInfoTemplate writes a template for sections, in order, to a temporary file and returns its path
+func writeMediaInfoTemplate(order []string, sections map[string]mediainfoSection) (string, error) {
+	// Every section writes one line per stream, prefixed with the section name so we can tell them apart
+	var template strings.Builder
+	for _, name := range order {
+		section := sections[name]
+		template.WriteString(name + ";" + name)
+		for _, field := range section.fields {
+			template.WriteString(mediainfoSeparator + field)
+		}
+		for _, field := range section.extra {
+			template.WriteString(mediainfoSeparator + field.Expression)
+		}
+		template.WriteString("\\n\n")
+	}
+
+	// Mediainfo cannot handle a template that grabs from more than one section as a commandline argument
+	// However, it supports multi-section templates when read in from a file
+	// Writing the template to file means we can avoid calling mediainfo
+	// more than once for a given file, so while this is gross, it's notably faster
+	templateTempFile, err := ioutil.TempFile("", "mediaauditTemplate")
+	if err != nil {
+		return "", err
+	}
+	defer templateTempFile.Close()
+
+	if _, err := templateTempFile.WriteString(template.String()); err != nil {
+		os.Remove(templateTempFile.Name())
+		return "", err
+	}
+	return templateTempFile.Name(), nil
+}
+
+// ExtraColumns names the columns added for extra fields, in order
+func (m *MediaInfo) ExtraColumns() []string {
+	return m.extraColumns
+}
+
+// Close removes the template file
+func (m *MediaInfo) Close() error {
+	return os.Remove(m.templatePath)
+}
+
+// Probe runs mediainfo against the file at path and parses the result
+func (m *MediaInfo) Probe(ctx context.Context, path string) (*Report, error) {
+	sections, extra, err := runMediaInfo(ctx, m.templatePath, m.sections, path)
+	if err != nil {
+		return &Report{}, err
+	}
+
+	// We only look at the first video stream, anything after that is usually cover art,
+	// unless it's a transport stream with more than one program
+	if len(sections["General"]) == 0 || len(sections["Video"]) == 0 {
+		return &Report{}, fmt.Errorf("Missing full info for file %q, %v", path, sections)
+	}
+	general := sections["General"][0]
+	video, program, err := m.selectVideo(sections["Video"])
+	if err != nil {
+		return &Report{}, fmt.Errorf("%s in %q", err.Error(), path)
+	}
+
+	container := general[1]
+	codec := video[0]
+
+	width, err := strconv.Atoi(video[1])
+	if err != nil {
+		return &Report{}, err
+	}
+
+	height, err := strconv.Atoi(video[2])
+	if err != nil {
+		return &Report{}, err
+	}
+
+	bitrateType := ""
+	bitrateString := "0"
+	if video[3] != "" {
+		bitrateType = "Variable"
+		bitrateString = video[3]
+	} else if video[4] != "" {
+		bitrateType = "Constant"
+		bitrateString = video[4]
+	} else if video[5] != "" {
+		bitrateType = "Nominal"
+		bitrateString = video[5]
+	} else if general[0] != "" {
+		bitrateType = "Overall"
+		bitrateString = general[0]
+	} else {
+		return &Report{}, fmt.Errorf("Unable to get bitrate for file %q: %v", path, sections)
+	}
+
+	bitrateInt, err := strconv.Atoi(bitrateString)
+	if err != nil {
+		return &Report{}, err
+	}
+
+	// Not every container records the bit depth, so leave it at zero rather than failing
+	bitDepth := 0
+	if video[7] != "" {
+		bitDepth, err = strconv.Atoi(video[7])
+		if err != nil {
+			return &Report{}, err
+		}
+	}
+
+	var audioLanguages []string
+	var audioChannels []int
+	for _, audio := range sections["Audio"] {
+		if !inProgram(audio[2], program) {
+			continue
+		}
+		language := audio[0]
+		if language == "" {
+			language = "und" // ISO 639-2 for undetermined
+		}
+		audioLanguages = append(audioLanguages, language)
+
+		channels, err := atoiOrZero(audio[1])
+		if err != nil {
+			return &Report{}, err
+		}
+		audioChannels = append(audioChannels, channels)
+	}
+
+	// Broadcast captions are carried in the video stream, but mediainfo lists them as text streams too
+	var subtitleLanguages, captions []string
+	for _, text := range sections["Text"] {
+		if !inProgram(text[2], program) {
+			continue
+		}
+		language := text[0]
+		if language == "" {
+			language = "und"
+		}
+		subtitleLanguages = append(subtitleLanguages, language)
+		if captionFormats[text[1]] {
+			captions = append(captions, text[1])
+		}
+	}
+
+	// Chapters are stored as a range of entries in the menu, so count them from the bounds
+	chapters := 0
+	for _, menu := range sections["Menu"] {
+		begin, beginErr := strconv.Atoi(menu[0])
+		end, endErr := strconv.Atoi(menu[1])
+		if beginErr == nil && endErr == nil && end > begin {
+			chapters += end - begin
+		}
+	}
+
+	// Either can be missing, the scanner works it out from the other
+	var aspectRatios [2]float64
+	for i, value := range video[11:13] {
+		if value != "" {
+			if aspectRatios[i], err = strconv.ParseFloat(value, 64); err != nil {
+				return &Report{}, err
+			}
+		}
+	}
+
+	// Cameras and editors write the start timecode and reel name to a timecode track,
+	// which mediainfo lists under Other, though it can also find the timecode in the video stream itself
+	startTimecode, reelName := video[16], ""
+	for _, other := range sections["Other"] {
+		if other[0] == "Time code" {
+			if startTimecode == "" {
+				startTimecode = other[1]
+			}
+			reelName = other[2]
+			break
+		}
+	}
+
+	// Missing for variable frame rate streams
+	frameRate := 0.0
+	if video[13] != "" {
+		if frameRate, err = strconv.ParseFloat(video[13], 64); err != nil {
+			return &Report{}, err
+		}
+	}
+
+	bitrateMbps := math.Round((float64(bitrateInt)/1048576)*1000) / 1000
+
+	// Duration is in milliseconds, and missing for some streams like still images
+	durationSeconds := 0.0
+	if general[2] != "" {
+		durationMs, err := strconv.ParseFloat(general[2], 64)
+		if err != nil {
+			return &Report{}, err
+		}
+		durationSeconds = math.Round(durationMs) / 1000
+	}
+
+	// With more than one stream in a section, list every stream's value like mediainfo does
+	var extraValues map[string]string
+	if len(m.extraColumns) > 0 {
+		extraValues = make(map[string]string)
+		for column, values := range extra {
+			extraValues[column] = strings.Join(values, " / ")
+		}
+	}
+
+	return &Report{
+		Container:   container,
+		Codec:       codec,
+		BitrateType: bitrateType,
+		BitrateMbps: bitrateMbps,
+		Width:       width,
+		Height:      height,
+		ScanType:    video[6],
+
+		BitDepth:                bitDepth,
+		ColorPrimaries:          video[8],
+		TransferCharacteristics: video[9],
+		ChromaSubsampling:       video[10],
+		HDR:                     video[19],
+
+		DisplayAspectRatio: aspectRatios[0],
+		PixelAspectRatio:   aspectRatios[1],
+		FrameRate:          frameRate,
+
+		CodecProfile:   video[14],
+		CommercialName: video[15],
+
+		StartTimecode: startTimecode,
+		ReelName:      reelName,
+		Camera:        cameraName(general[3], general[4], general[5]),
+
+		AudioLanguages:    audioLanguages,
+		AudioChannels:     audioChannels,
+		SubtitleLanguages: subtitleLanguages,
+		Captions:          captions,
+
+		Chapters:        chapters,
+		DurationSeconds: durationSeconds,
+
+		Extra: extraValues,
+	}, nil
+}
+
+// selectVideo picks the video stream to report from mediainfo's video streams, returning it along with
+// the program it belongs to, which is only set for transport streams
+// Streams are chosen by m.PID or m.Program, otherwise the first one wins
+func (m *MediaInfo) selectVideo(streams [][]string) ([]string, string, error) {
+	if m.PID == 0 && m.Program == 0 {
+		return streams[0], streams[0][18], nil
+	}
+
+	for _, video := range streams {
+		id, program := video[17], video[18]
+		// Only transport streams have programs, anything else has the one stream we'd report anyway
+		if id == "" || program == "" {
+			return video, "", nil
+		}
+		if m.PID != 0 && id == strconv.Itoa(m.PID) {
+			return video, program, nil
+		}
+		if m.PID == 0 && program == strconv.Itoa(m.Program) {
+			return video, program, nil
+		}
+	}
+	if m.PID != 0 {
+		return nil, "", fmt.Errorf("No video stream with PID %d", m.PID)
+	}
+	return nil, "", fmt.Errorf("No video stream in program %d", m.Program)
+}
+
+// runMediaInfo runs mediainfo against the file at path with the template for sections,
+// returning the values for each stream by section, and the values of any extra fields by column
+func runMediaInfo(ctx context.Context, templatePath string, sections map[string]mediainfoSection, path string) (map[string][][]string, map[string][]string, error) {
+	cmd := toolCommand(ctx, "mediainfo", `--output=file://`+templatePath, path)
+	bytes, err := cmd.Output()
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseMediaInfo(string(bytes), sections, path)
+}
+
+// parseMediaInfo splits the output of mediainfo run with the template for sections into the values for each stream
+// by section, and the values of any extra fields by column
+func parseMediaInfo(output string, sections map[string]mediainfoSection, path string) (map[string][][]string, map[string][]string, error) {
+	// Each stream is on its own line, tagged with the section it came from
+	// Our own fields come first, followed by any extra fields
+	streams := make(map[string][][]string)
+	extra := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, mediainfoSeparator)
+		section, ok := sections[fields[0]]
+		if !ok {
+			return nil, nil, fmt.Errorf("Unexpected mediainfo output for file %q: %q", path, line)
+		}
+		values := fields[1:]
+		if len(values) != len(section.fields)+len(section.extra) {
+			return nil, nil, fmt.Errorf("Unexpected mediainfo output for file %q: %q", path, line)
+		}
+		streams[section.name] = append(streams[section.name], values[:len(section.fields)])
+		for i, field := range section.extra {
+			if value := values[len(section.fields)+i]; value != "" {
+				extra[field.Column] = append(extra[field.Column], value)
+			}
+		}
+	}
+	return streams, extra, nil
+}
+
+// cameraName combines the maker and model of the camera a file was recorded with,
+// without repeating the maker if the model already starts with it
+func cameraName(company, model, name string) string {
+	if model == "" {
+		model = name
+	}
+	switch {
+	case model == "":
+		return company
+	case company == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(company)):
+		return model
+	}
+	return company + " " + model
+}
@@ -0,0 +1,52 @@
+package mediaaudit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMediaInfo(t *testing.T) {
+	other := mediainfoSection{name: "Other", fields: []string{"%Type%", "%TimeCode_FirstFrame%", "%Title%"}}
+	withExtra := other
+	withExtra.extra = []ExtraField{{Column: "Other.Format", Section: "Other", Expression: "%Format%"}}
+	audio := mediainfoSection{name: "Audio", fields: []string{"%Language/String3%", "%Channel(s)%"}}
+	video := mediainfoSection{name: "Video", fields: []string{"%Format%"}, extra: []ExtraField{{Column: "Video.Encoded_Library_Settings", Section: "Video", Expression: "%Encoded_Library_Settings%"}}}
+
+	tests := []struct {
+		name    string
+		section mediainfoSection
+		line    string
+		want    []string
+		extra   map[string][]string
+	}{
+		{"plain reel name", other, "Other\x1fTime code\x1f01:00:00:00\x1fA001C002", []string{"Time code", "01:00:00:00", "A001C002"}, map[string][]string{}},
+		{"pipes in the reel name", other, "Other\x1fTime code\x1f01:00:00:00\x1fA001|C002|take 3", []string{"Time code", "01:00:00:00", "A001|C002|take 3"}, map[string][]string{}},
+		{"empty reel name", other, "Other\x1fTime code\x1f01:00:00:00\x1f", []string{"Time code", "01:00:00:00", ""}, map[string][]string{}},
+		{"pipes in the reel name before an extra field", withExtra, "Other\x1fTime code\x1f01:00:00:00\x1fA001|C002\x1fQuickTime TC", []string{"Time code", "01:00:00:00", "A001|C002"}, map[string][]string{"Other.Format": {"QuickTime TC"}}},
+		{"pipes in an extra field", video, "Video\x1fAVC\x1fcabac=1 | ref=4", []string{"AVC"}, map[string][]string{"Video.Encoded_Library_Settings": {"cabac=1 | ref=4"}}},
+		{"no extra fields", audio, "Audio\x1feng\x1f2", []string{"eng", "2"}, map[string][]string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sections := map[string]mediainfoSection{test.section.name: test.section}
+			streams, extra, err := parseMediaInfo(test.line+"\n", sections, "test.mov")
+			if err != nil {
+				t.Fatalf("parseMediaInfo() error = %v", err)
+			}
+			if got := streams[test.section.name]; len(got) != 1 || !reflect.DeepEqual(got[0], test.want) {
+				t.Errorf("parseMediaInfo() = %q, want %q", got, test.want)
+			}
+			if !reflect.DeepEqual(extra, test.extra) {
+				t.Errorf("parseMediaInfo() extra = %q, want %q", extra, test.extra)
+			}
+		})
+	}
+
+	// Anything else is still output we don't understand
+	sections := map[string]mediainfoSection{"Audio": audio}
+	for _, line := range []string{"Audio\x1feng\x1f2\x1f6", "Audio\x1feng", "Audio|eng|2", "Video\x1fAVC"} {
+		if _, _, err := parseMediaInfo(line, sections, "test.mov"); err == nil {
+			t.Errorf("parseMediaInfo(%q) succeeded", line)
+		}
+	}
+}
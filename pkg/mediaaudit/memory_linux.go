@@ -0,0 +1,42 @@
+//go:build linux
+// +build linux
+
+package mediaaudit
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const memoryLimitSupported bool = true
+
+var (
+	prlimitOnce sync.Once
+	prlimitPath string
+)
+
+// limitedCommand wraps name and args in util-linux's prlimit, if it's installed, so that the limit is in place
+// before the tool runs any code, reporting false if it isn't
+func limitedCommand(limit uint64, name string, args []string) (string, []string, bool) {
+	prlimitOnce.Do(func() {
+		prlimitPath, _ = exec.LookPath("prlimit")
+	})
+	if prlimitPath == "" {
+		return name, args, false
+	}
+	return prlimitPath, append([]string{"--as=" + strconv.FormatUint(limit, 10), "--", name}, args...), true
+}
+
+// limitMemory caps the address space of the process pid with prlimit
+func limitMemory(pid int, limit uint64) error {
+	rlimit := syscall.Rlimit{Cur: limit, Max: limit}
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(syscall.RLIMIT_AS), uintptr(unsafe.Pointer(&rlimit)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("Failed to limit memory of process %d: %w", pid, errno)
+	}
+	return nil
+}
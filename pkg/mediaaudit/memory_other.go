@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package mediaaudit
+
+const memoryLimitSupported bool = false
+
+// limitedCommand leaves the command alone, memory can't be limited here
+func limitedCommand(limit uint64, name string, args []string) (string, []string, bool) {
+	return name, args, false
+}
+
+// limitMemory isn't available here, WithLimits refuses before we get this far
+func limitMemory(pid int, limit uint64) error {
+	return ErrMemoryLimitUnsupported
+}
@@ -0,0 +1,354 @@
+package mediaaudit
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"sync"
+)
+
+// DefaultAudioExtensions are the extensions, without the dot, of the files ScanAudio probes
+var DefaultAudioExtensions []string = []string{"flac", "mp3", "m4a", "aac", "opus", "ogg", "wav", "aiff", "wv", "ape", "wma"}
+
+// AudioReportHeaders names each column of AudioReport.ToSlice, in order
+var AudioReportHeaders []string = []string{"ID", "Name", "Container", "Codec", "Lossless", "SizeMB", "BitrateKbps", "BitrateMode", "SampleRate", "BitDepth", "Channels", "DurationSeconds", "LossyHint"}
+
+// The fields we need from each mediainfo section for an audio file, in the order they're parsed below
+var audioMediainfoSections []mediainfoSection = []mediainfoSection{
+	{name: "General", fields: []string{"%Format%", "%Duration%", "%OverallBitRate%"}},
+	{name: "Audio", fields: []string{"%Format%", "%Format_Profile%", "%Compression_Mode%", "%BitRate%", "%BitRate_Mode%", "%SamplingRate%", "%BitDepth%", "%Channel(s)%"}},
+}
+
+// losslessCodecs are the codecs we treat as lossless when mediainfo doesn't report a compression mode
+var losslessCodecs map[string]bool = map[string]bool{
+	"FLAC": true, "ALAC": true, "PCM": true, "WavPack": true, "Monkey's Audio": true, "TTA": true,
+}
+
+// Lossy hints
+const (
+	LossyHintNone   string = "ok"
+	LossyHint16kHz  string = "cutoff 16kHz"
+	LossyHint19kHz  string = "cutoff 19.5kHz"
+	lossyHintSilent        = -85.0 // dB, quieter than this above the cutoff is as good as nothing there
+)
+
+// e.g. "[Parsed_astats_2 @ 0x1] RMS level dB: -97.312345"
+var rmsLevelRegex *regexp.Regexp = regexp.MustCompile(`RMS level dB:\s*(-?[0-9.]+|-inf)`)
+
+// AudioReport holds everything we know about a single music file
+type AudioReport struct {
+	ID              string // Stable across scans, see fileID
+	Path            string // As found during the walk
+	Name            string // Path formatted for output, see Scanner.PathStyle
+	Container       string
+	Codec           string
+	Lossless        bool
+	SizeMB          float64
+	BitrateKbps     float64
+	BitrateMode     string // Constant or Variable, empty if the file doesn't say
+	SampleRate      int    // In Hz
+	BitDepth        int    // Zero for lossy codecs, which don't have one
+	Channels        int
+	DurationSeconds float64
+
+	// For lossless files, whether the spectrum stops short like it does after a lossy encode, empty if not checked
+	// A hint rather than proof, old recordings and quiet masters can have nothing up there either
+	LossyHint string
+}
+
+// ToSlice formats the report as a row matching AudioReportHeaders
+func (a *AudioReport) ToSlice() []string {
+	return []string{
+		a.ID,
+		a.Name,
+		a.Container,
+		a.Codec,
+		strconv.FormatBool(a.Lossless),
+		fmt.Sprintf("%.2f", a.SizeMB),
+		fmt.Sprintf("%.1f", a.BitrateKbps),
+		a.BitrateMode,
+		strconv.Itoa(a.SampleRate),
+		strconv.Itoa(a.BitDepth),
+		strconv.Itoa(a.Channels),
+		fmt.Sprintf("%.3f", a.DurationSeconds),
+		a.LossyHint,
+	}
+}
+
+// AudioWriter outputs audio reports as they're ready
+// Like Writer, implementations don't need to be safe for concurrent use
+type AudioWriter interface {
+	Write(report *AudioReport) error
+	Close() error
+}
+
+// CSVAudioWriter streams each audio report straight out as a CSV row
+type CSVAudioWriter struct {
+	writer *csv.Writer
+}
+
+// NewCSVAudioWriter returns a CSVAudioWriter that has already written the header row to w
+func NewCSVAudioWriter(w io.Writer) *CSVAudioWriter {
+	c := &CSVAudioWriter{writer: csv.NewWriter(w)}
+	c.writer.Write(AudioReportHeaders)
+	return c
+}
+
+func (c *CSVAudioWriter) Write(report *AudioReport) error {
+	c.writer.Write(report.ToSlice())
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *CSVAudioWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// AudioMediaInfo probes music files with the mediainfo CLI
+type AudioMediaInfo struct {
+	templatePath string
+	sections     map[string]mediainfoSection
+}
+
+// NewAudioMediaInfo prepares an AudioMediaInfo, call Close once done with it
+func NewAudioMediaInfo() (*AudioMediaInfo, error) {
+	m := &AudioMediaInfo{sections: make(map[string]mediainfoSection)}
+	var order []string
+	for _, section := range audioMediainfoSections {
+		m.sections[section.name] = section
+		order = append(order, section.name)
+	}
+
+	templatePath, err := writeMediaInfoTemplate(order, m.sections)
+	if err != nil {
+		return nil, err
+	}
+	m.templatePath = templatePath
+	return m, nil
+}
+
+// Close removes the template file
+func (m *AudioMediaInfo) Close() error {
+	return os.Remove(m.templatePath)
+}
+
+// Probe runs mediainfo against the file at path and parses the result
+func (m *AudioMediaInfo) Probe(ctx context.Context, path string) (*AudioReport, error) {
+	sections, _, err := runMediaInfo(ctx, m.templatePath, m.sections, path)
+	if err != nil {
+		return &AudioReport{}, err
+	}
+
+	// We only look at the first audio stream, music files rarely have more than one
+	if len(sections["General"]) == 0 || len(sections["Audio"]) == 0 {
+		return &AudioReport{}, fmt.Errorf("Missing full info for file %q, %v", path, sections)
+	}
+	general := sections["General"][0]
+	audio := sections["Audio"][0]
+
+	report := &AudioReport{
+		Container:   general[0],
+		Codec:       audio[0],
+		BitrateMode: normalize(normalBitrateTypes, audio[4]),
+	}
+	// mediainfo names MP3 after the standard it's part of, which nobody else does
+	if report.Codec == "MPEG Audio" && audio[1] == "Layer 3" {
+		report.Codec = "MP3"
+	}
+	switch audio[2] {
+	case "Lossless":
+		report.Lossless = true
+	case "":
+		report.Lossless = losslessCodecs[report.Codec]
+	}
+
+	// Lossless and VBR files often only have an overall bitrate, which for music is close enough
+	bitrateString := audio[3]
+	if bitrateString == "" {
+		bitrateString = general[2]
+	}
+	if bitrateString != "" {
+		bitrate, err := strconv.ParseFloat(bitrateString, 64)
+		if err != nil {
+			return &AudioReport{}, err
+		}
+		// Decimal kilobits, to match the nominal rates encoders are set with, e.g. 320
+		report.BitrateKbps = math.Round(bitrate/100) / 10
+	}
+
+	if report.SampleRate, err = atoiOrZero(audio[5]); err != nil {
+		return &AudioReport{}, err
+	}
+	if report.BitDepth, err = atoiOrZero(audio[6]); err != nil {
+		return &AudioReport{}, err
+	}
+	if report.Channels, err = atoiOrZero(audio[7]); err != nil {
+		return &AudioReport{}, err
+	}
+
+	// Duration is in milliseconds
+	if general[1] != "" {
+		durationMs, err := strconv.ParseFloat(general[1], 64)
+		if err != nil {
+			return &AudioReport{}, err
+		}
+		report.DurationSeconds = math.Round(durationMs) / 1000
+	}
+	return report, nil
+}
+
+// atoiOrZero is strconv.Atoi, but treats a missing value as zero
+// mediainfo lists some values twice for multi-layer streams like "2 / 6", so only the first is used
+func atoiOrZero(value string) (int, error) {
+	value, _, _ = cut(value, " / ")
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// lossyHint checks how much is left in the top of the spectrum of the file at path
+// Lossy encoders throw away everything above a cutoff, around 16kHz at low bitrates and 19-20kHz at high ones,
+// and decoding to a lossless format doesn't bring it back
+func lossyHint(ctx context.Context, path string, sampleRate int) (string, error) {
+	bands := []struct {
+		cutoff int
+		hint   string
+	}{
+		{16000, LossyHint16kHz},
+		{19500, LossyHint19kHz},
+	}
+	for _, band := range bands {
+		// Nothing to find above the Nyquist frequency
+		if sampleRate != 0 && band.cutoff >= sampleRate/2 {
+			break
+		}
+		level, err := highBandLevel(ctx, path, band.cutoff)
+		if err != nil {
+			return "", err
+		}
+		if level < lossyHintSilent {
+			return band.hint, nil
+		}
+	}
+	return LossyHintNone, nil
+}
+
+// highBandLevel measures the RMS level in dB of the first audio stream of the file at path above cutoff Hz
+// The high pass is applied twice for a steeper slope, so loud content just under the cutoff doesn't leak through
+func highBandLevel(ctx context.Context, path string, cutoff int) (float64, error) {
+	filter := fmt.Sprintf("highpass=f=%[1]d:poles=2,highpass=f=%[1]d:poles=2,astats=measure_perchannel=none:measure_overall=RMS_level", cutoff)
+	output, err := runFFmpegFilter(ctx, "-i", path, "-map", "0:a:0", "-af", filter)
+	if err != nil {
+		return 0, err
+	}
+	matches := rmsLevelRegex.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("No RMS level in ffmpeg output for %q", path)
+	}
+	level := matches[len(matches)-1][1]
+	if level == "-inf" {
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(level, 64)
+}
+
+// ScanAudio walks root like Scan, but probes music files with backend and writes an AudioReport for each to w
+// Every scanner setting that isn't specific to video applies, except Sniff, Sample and Filter
+// AudioExtensions is used in place of VideoExtensions
+func (s *Scanner) ScanAudio(ctx context.Context, root string, backend *AudioMediaInfo, w AudioWriter) error {
+	return s.runScan(ctx, root, s.audioWalk(root), nil, "non-audio", func(ctx context.Context, path string, info os.FileInfo, writeLock *sync.Mutex) bool {
+		report, err := s.safeProbeAudio(ctx, root, path, info, backend)
+		if err != nil {
+			s.logf(LevelError, path, "%s", err.Error())
+			writeLock.Lock()
+			s.writeFailure(root, path, info, failureStatus(err), err.Error())
+			writeLock.Unlock()
+			return false
+		}
+
+		writeLock.Lock()
+		err = w.Write(report)
+		writeLock.Unlock()
+		if err != nil {
+			s.logf(LevelError, path, "Failed to write output when checking %q: %s", info.Name(), err.Error())
+			return false
+		}
+		return true
+	})
+}
+
+// PlanAudio walks root the same way ScanAudio would, but only lists the files that would be probed
+func (s *Scanner) PlanAudio(ctx context.Context, root string) (*Plan, error) {
+	return s.plan(ctx, s.audioWalk(root), nil)
+}
+
+// audioWalk returns a walkFunc that walks root for music files with AudioExtensions
+func (s *Scanner) audioWalk(root string) walkFunc {
+	extensions := s.AudioExtensions
+	if len(extensions) == 0 {
+		extensions = DefaultAudioExtensions
+	}
+	return func(visit func(path string, info os.FileInfo) error, skip func(path string)) error {
+		return s.walkFiles(root, extensions, false, false, visit, skip)
+	}
+}
+
+// safeProbeAudio is probeAudio, but turns a panic into a ParseError so the rest of the scan carries on
+func (s *Scanner) safeProbeAudio(ctx context.Context, root, path string, info os.FileInfo, backend *AudioMediaInfo) (report *AudioReport, err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			parseErr := &ParseError{Path: path, Value: value, Stack: debug.Stack()}
+			s.logf(LevelDebug, path, "%s\n%s", parseErr.Error(), parseErr.Stack)
+			report, err = nil, parseErr
+		}
+	}()
+	return s.probeAudio(ctx, root, path, info, backend)
+}
+
+// probeAudio builds the full report for a single music file
+func (s *Scanner) probeAudio(ctx context.Context, root, path string, info os.FileInfo, backend *AudioMediaInfo) (*AudioReport, error) {
+	s.logf(LevelDebug, path, "Probing %q", path)
+
+	var report *AudioReport
+	err := s.probeWithRetries(ctx, path, func(ctx context.Context) (err error) {
+		report, err = backend.Probe(ctx, path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.ID = fileID(path, info)
+	report.Path = path
+	report.Name = displayPath(root, path, s.PathStyle)
+	report.SizeMB = math.Round((float64(info.Size())/1048576)*100) / 100
+
+	// Only worth checking lossless files, a lossy one is expected to have a cutoff
+	if s.LossyHints && report.Lossless {
+		s.lossyHint(ctx, report, path)
+	}
+	return report, nil
+}
+
+// lossyHint fills in the lossy hint for the music file at path, waiting its turn in the heavy work queue
+func (s *Scanner) lossyHint(ctx context.Context, report *AudioReport, path string) {
+	if err := s.qualitySem.Acquire(ctx, 1); err != nil {
+		return
+	}
+	defer s.qualitySem.Release(1)
+
+	hint, err := lossyHint(ctx, path, report.SampleRate)
+	if err != nil {
+		s.logf(LevelWarn, path, "Failed to check the spectrum of %q: %s", filepath.Base(path), err.Error())
+		return
+	}
+	report.LossyHint = hint
+}
@@ -0,0 +1,106 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// e.g. S01E02, or S01E02-E03 for a multi-episode file
+	episodeRegex *regexp.Regexp = regexp.MustCompile(`(?i)\bS(\d{1,2})E(\d{1,3})\b`)
+	// e.g. Movie (2010), allowing for an edition or ID tags after
+	movieYearRegex *regexp.Regexp = regexp.MustCompile(`^(.+?) \((\d{4})\)`)
+	// Looks like an episode number, but not in the form Plex and Jellyfin expect, e.g. 1x02 or Episode 2
+	looseEpisodeRegex *regexp.Regexp = regexp.MustCompile(`(?i)\b\d{1,2}x\d{1,3}\b|\bep(isode)?[ ._-]*\d+\b`)
+)
+
+// checkNaming checks the names of the file at path, and the folders it's in, against the Plex/Jellyfin conventions:
+// Movie (Year)/Movie (Year).ext for movies and Show/Season 01/Show - S01E01.ext for episodes
+// Returns ok, or what's wrong
+func checkNaming(root, path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	parent := filepath.Dir(path)
+
+	var problems []string
+	if seasonFolderRegex.MatchString(filepath.Base(parent)) || episodeRegex.MatchString(name) || looseEpisodeRegex.MatchString(name) {
+		problems = checkEpisodeNaming(root, name, parent)
+	} else {
+		problems = checkMovieNaming(root, name, parent)
+	}
+
+	if len(problems) == 0 {
+		return "ok"
+	}
+	return strings.Join(problems, ", ")
+}
+
+// checkEpisodeNaming checks an episode named name in the folder parent
+func checkEpisodeNaming(root, name, parent string) []string {
+	var problems []string
+
+	episode := episodeRegex.FindStringSubmatch(name)
+	if episode == nil {
+		problems = append(problems, "no SxxEyy episode number")
+	}
+
+	season := seasonFolderRegex.FindStringSubmatch(filepath.Base(parent))
+	show := filepath.Dir(parent)
+	switch {
+	case season == nil:
+		problems = append(problems, "not in a Season folder")
+		show = parent
+	case episode != nil && season[2] != "":
+		folderSeason, _ := strconv.Atoi(season[2])
+		fileSeason, _ := strconv.Atoi(episode[1])
+		if folderSeason != fileSeason {
+			problems = append(problems, fmt.Sprintf("season %d in Season %d folder", fileSeason, folderSeason))
+		}
+	}
+
+	if !insideRoot(root, show) {
+		problems = append(problems, "not in a show folder")
+	} else if showName := stripYear(filepath.Base(show)); !strings.HasPrefix(strings.ToLower(name), strings.ToLower(showName)) {
+		problems = append(problems, fmt.Sprintf("name doesn't start with %q", showName))
+	}
+	return problems
+}
+
+// checkMovieNaming checks a movie named name in the folder parent
+func checkMovieNaming(root, name, parent string) []string {
+	var problems []string
+
+	if !movieYearRegex.MatchString(name) {
+		problems = append(problems, "no (Year) in name")
+	}
+	if !insideRoot(root, parent) {
+		return append(problems, "not in its own folder")
+	}
+
+	folder := filepath.Base(parent)
+	if !movieYearRegex.MatchString(folder) {
+		problems = append(problems, "no (Year) in folder name")
+	}
+	// The file can add an edition or quality after the folder's name, e.g. Movie (2010) - 1080p
+	if !strings.HasPrefix(strings.ToLower(name), strings.ToLower(folder)) {
+		problems = append(problems, fmt.Sprintf("name doesn't start with folder name %q", folder))
+	}
+	return problems
+}
+
+// insideRoot reports whether dir is a folder below root, rather than root itself or above it
+func insideRoot(root, dir string) bool {
+	rel, err := filepath.Rel(root, dir)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// stripYear removes a trailing (Year) from a show name, Plex allows either Show or Show (Year) for the folder
+// but episode names usually leave it off
+func stripYear(name string) string {
+	if match := movieYearRegex.FindStringSubmatch(name); match != nil {
+		return match[1]
+	}
+	return name
+}
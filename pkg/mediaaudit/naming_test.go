@@ -0,0 +1,41 @@
+package mediaaudit
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckNaming(t *testing.T) {
+	root := filepath.FromSlash("/media")
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		// Movies
+		{"movie", "Movies/Movie (2010)/Movie (2010).mkv", "ok"},
+		{"movie with an edition", "Movies/Movie (2010)/Movie (2010) - Director's Cut.mkv", "ok"},
+		{"movie without a year", "Movies/Movie/Movie.mkv", "no (Year) in name, no (Year) in folder name"},
+		{"movie in the root", "Movie (2010).mkv", "not in its own folder"},
+		{"movie named after another folder", "Movies/Movie (2010)/Other (2011).mkv", `name doesn't start with folder name "Movie (2010)"`},
+
+		// Shows
+		{"episode", "TV/Show/Season 01/Show - S01E02.mkv", "ok"},
+		{"episode of a show with a year", "TV/Show (2010)/Season 1/Show - S01E02 - Title.mkv", "ok"},
+		{"multi-episode file", "TV/Show/Season 01/Show - S01E02-E03.mkv", "ok"},
+		{"special", "TV/Show/Specials/Show - S00E01.mkv", "ok"},
+		{"series folder", "TV/Show/Series 2/Show - S02E01.mkv", "ok"},
+		{"season mismatch", "TV/Show/Season 02/Show - S01E02.mkv", "season 1 in Season 2 folder"},
+		{"no season folder", "TV/Show/Show - S01E02.mkv", "not in a Season folder"},
+		{"loose episode number", "TV/Show/Season 01/Show - 1x02.mkv", "no SxxEyy episode number"},
+		{"episode named after another show", "TV/Show/Season 01/Other - S01E02.mkv", `name doesn't start with "Show"`},
+		{"season folder in the root", "Season 01/Show - S01E02.mkv", `not in a show folder`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := checkNaming(root, filepath.Join(root, filepath.FromSlash(test.path))); got != test.want {
+				t.Errorf("checkNaming(%q) = %q, want %q", test.path, got, test.want)
+			}
+		})
+	}
+}
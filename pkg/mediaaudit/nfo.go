@@ -0,0 +1,91 @@
+package mediaaudit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// nfoDurationTolerance is how far the NFO's duration can be from the probed one, as a share of it,
+// before it's a mismatch, rounding and differently trimmed remuxes make exact matches rare
+const nfoDurationTolerance float64 = 0.02
+
+// nfo is the part of a Kodi .nfo file we check against the file, for a movie or an episode
+type nfo struct {
+	Video []struct {
+		Codec             string `xml:"codec"`
+		Width             int    `xml:"width"`
+		Height            int    `xml:"height"`
+		DurationInSeconds int    `xml:"durationinseconds"`
+	} `xml:"fileinfo>streamdetails>video"`
+}
+
+// findNFO returns the .nfo sidecar for the video at path, Movie.nfo for Movie.mkv,
+// or movie.nfo in the same folder, or "" if there isn't one
+func findNFO(path string) string {
+	candidates := []string{
+		strings.TrimSuffix(path, filepath.Ext(path)) + ".nfo",
+		filepath.Join(filepath.Dir(path), "movie.nfo"),
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// readNFO parses the Kodi .nfo file at path
+// The root element is movie, episodedetails or the like, we don't mind which
+func readNFO(path string) (*nfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parsed := &nfo{}
+	if err := xml.Unmarshal(data, parsed); err != nil {
+		return nil, fmt.Errorf("Failed to parse %q: %w", path, err)
+	}
+	return parsed, nil
+}
+
+// checkNFO compares the stream details declared in the video's .nfo with the report
+// Returns ok if they agree, the differences if not, or "" if there's no .nfo or it has no stream details
+func checkNFO(report *Report, path string) (string, error) {
+	nfoPath := findNFO(path)
+	if nfoPath == "" {
+		return "", nil
+	}
+	parsed, err := readNFO(nfoPath)
+	if err != nil {
+		return "", err
+	}
+	if len(parsed.Video) == 0 {
+		return "", nil
+	}
+	video := parsed.Video[0]
+
+	var differences []string
+	if video.Codec != "" && normalize(normalCodecs, video.Codec) != report.Codec {
+		differences = append(differences, fmt.Sprintf("codec %s not %s", video.Codec, report.Codec))
+	}
+	if video.Width != 0 && video.Width != report.Width {
+		differences = append(differences, fmt.Sprintf("width %d not %d", video.Width, report.Width))
+	}
+	if video.Height != 0 && video.Height != report.Height {
+		differences = append(differences, fmt.Sprintf("height %d not %d", video.Height, report.Height))
+	}
+	if video.DurationInSeconds != 0 && report.DurationSeconds > 0 {
+		if math.Abs(float64(video.DurationInSeconds)-report.DurationSeconds) > report.DurationSeconds*nfoDurationTolerance {
+			differences = append(differences, fmt.Sprintf("duration %ds not %.0fs", video.DurationInSeconds, report.DurationSeconds))
+		}
+	}
+
+	if len(differences) == 0 {
+		return "ok", nil
+	}
+	return "NFO says " + strings.Join(differences, ", "), nil
+}
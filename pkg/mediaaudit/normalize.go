@@ -0,0 +1,168 @@
+package mediaaudit
+
+import "strings"
+
+// Reports are normalized to the names mediainfo uses, so that results from different backends,
+// or from ffprobe-style plugins, can be compared and filtered the same way
+// Keys are lower case, values that aren't listed are left alone
+var (
+	normalContainers map[string]string = map[string]string{
+		"matroska":                "Matroska",
+		"matroska,webm":           "Matroska",
+		"mkv":                     "Matroska",
+		"webm":                    "WebM",
+		"mpeg-4":                  "MPEG-4",
+		"mp4":                     "MPEG-4",
+		"mov,mp4,m4a,3gp,3g2,mj2": "MPEG-4",
+		"mov":                     "QuickTime",
+		"quicktime":               "QuickTime",
+		"avi":                     "AVI",
+		"mpegts":                  "MPEG-TS",
+		"mpeg-ts":                 "MPEG-TS",
+		"asf":                     "Windows Media",
+		"wmv":                     "Windows Media",
+		"flv":                     "Flash Video",
+		"mpeg":                    "MPEG-PS",
+		"mpeg-ps":                 "MPEG-PS",
+		"mxf":                     "MXF",
+		"mxf_d10":                 "MXF",
+	}
+	normalCodecs map[string]string = map[string]string{
+		"h264":       "AVC",
+		"h.264":      "AVC",
+		"avc":        "AVC",
+		"avc1":       "AVC",
+		"hevc":       "HEVC",
+		"h265":       "HEVC",
+		"h.265":      "HEVC",
+		"hvc1":       "HEVC",
+		"hev1":       "HEVC",
+		"dvhe":       "HEVC",
+		"dvh1":       "HEVC",
+		"av1":        "AV1",
+		"av01":       "AV1",
+		"dav1":       "AV1",
+		"vp8":        "VP8",
+		"vp9":        "VP9",
+		"mpeg2video": "MPEG Video",
+		"mpeg-2":     "MPEG Video",
+		"mpeg1video": "MPEG Video",
+		"mpeg4":      "MPEG-4 Visual",
+		"xvid":       "MPEG-4 Visual",
+		"divx":       "MPEG-4 Visual",
+		"vc1":        "VC-1",
+		"wmv3":       "VC-1",
+		"prores":     "ProRes",
+		"apch":       "ProRes",
+		"apcn":       "ProRes",
+		"apcs":       "ProRes",
+		"apco":       "ProRes",
+		"ap4h":       "ProRes",
+		"ap4x":       "ProRes",
+		"dnxhd":      "VC-3",
+		"dnxhr":      "VC-3",
+		"avdn":       "VC-3",
+		"jpeg2000":   "JPEG 2000",
+		"j2k":        "JPEG 2000",
+		"mjp2":       "JPEG 2000",
+		"cfhd":       "CineForm",
+		"mjpeg":      "JPEG",
+	}
+	normalCaptions map[string]string = map[string]string{
+		"eia_608": "EIA-608",
+		"cea-608": "EIA-608",
+		"cea608":  "EIA-608",
+		"eia_708": "EIA-708",
+		"cea-708": "EIA-708",
+		"cea708":  "EIA-708",
+	}
+	normalColorPrimaries map[string]string = map[string]string{
+		"bt709":     "BT.709",
+		"bt2020":    "BT.2020",
+		"bt470bg":   "BT.601 PAL",
+		"smpte170m": "BT.601 NTSC",
+		"smpte432":  "Display P3",
+	}
+	normalTransferCharacteristics map[string]string = map[string]string{
+		"bt709":        "BT.709",
+		"smpte2084":    "PQ",
+		"arib-std-b67": "HLG",
+		"bt2020-10":    "BT.2020 (10-bit)",
+		"bt2020-12":    "BT.2020 (12-bit)",
+		"smpte170m":    "BT.601",
+	}
+	normalChromaSubsampling map[string]string = map[string]string{
+		"420":     "4:2:0",
+		"422":     "4:2:2",
+		"444":     "4:4:4",
+		"yuv420p": "4:2:0",
+		"yuv422p": "4:2:2",
+		"yuv444p": "4:4:4",
+
+		"yuv420p10le": "4:2:0",
+		"yuv422p10le": "4:2:2",
+		"yuv444p10le": "4:4:4",
+		"yuv420p12le": "4:2:0",
+	}
+	// Sample entries that only Dolby Vision streams use, for backends that report them as the codec
+	dolbyVisionCodecs map[string]bool = map[string]bool{
+		"dvhe": true,
+		"dvh1": true,
+		"dav1": true,
+	}
+	normalBitrateTypes map[string]string = map[string]string{
+		"cbr": "Constant",
+		"vbr": "Variable",
+	}
+	normalScanTypes map[string]string = map[string]string{
+		"progressive": "Progressive",
+		"interlaced":  "Interlaced",
+		"tt":          "Interlaced",
+		"bb":          "Interlaced",
+		"tb":          "Interlaced",
+		"bt":          "Interlaced",
+		"mbaff":       "MBAFF",
+	}
+)
+
+// normalize looks value up in names, ignoring case and surrounding space
+func normalize(names map[string]string, value string) string {
+	value = strings.TrimSpace(value)
+	if normal, ok := names[strings.ToLower(value)]; ok {
+		return normal
+	}
+	return value
+}
+
+// normalizeReport rewrites the values a backend filled in to mediainfo's names
+func normalizeReport(report *Report) {
+	if dolbyVisionCodecs[strings.ToLower(strings.TrimSpace(report.Codec))] {
+		report.HDR = "Dolby Vision"
+	}
+	report.Container = normalize(normalContainers, report.Container)
+	report.Codec = normalize(normalCodecs, report.Codec)
+	report.ColorPrimaries = normalize(normalColorPrimaries, report.ColorPrimaries)
+	report.TransferCharacteristics = normalize(normalTransferCharacteristics, report.TransferCharacteristics)
+	report.ChromaSubsampling = normalize(normalChromaSubsampling, report.ChromaSubsampling)
+	report.ScanType = normalize(normalScanTypes, report.ScanType)
+	report.BitrateType = normalize(normalBitrateTypes, report.BitrateType)
+	report.HDR = hdrFormat(report)
+	for i, caption := range report.Captions {
+		report.Captions[i] = normalize(normalCaptions, caption)
+	}
+}
+
+// hdrFormat labels the report's HDR format from its normalized transfer characteristics and primaries
+// Dolby Vision streams carry an HDR10 or HLG base layer, so they can only be told apart by the backend's
+// own HDR metadata, mediainfo's HDR_Format, which is otherwise replaced
+func hdrFormat(report *Report) string {
+	switch {
+	case strings.Contains(strings.ToLower(report.HDR), "dolby vision"):
+		return "Dolby Vision"
+	case report.TransferCharacteristics == "PQ" && report.ColorPrimaries == "BT.2020":
+		return "HDR10"
+	case report.TransferCharacteristics == "HLG":
+		return "HLG"
+	}
+	return ""
+}
@@ -0,0 +1,129 @@
+package mediaaudit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeReport(t *testing.T) {
+	// The same files as each backend describes them, which should all come out with mediainfo's names
+	tests := []struct {
+		name   string
+		report Report
+		want   Report
+	}{
+		{
+			name: "mediainfo SDR",
+			report: Report{Container: "Matroska", Codec: "AVC", ColorPrimaries: "BT.709", TransferCharacteristics: "BT.709",
+				ChromaSubsampling: "4:2:0", ScanType: "Progressive", BitrateType: "Variable", Captions: []string{"EIA-608"}},
+			want: Report{Container: "Matroska", Codec: "AVC", ColorPrimaries: "BT.709", TransferCharacteristics: "BT.709",
+				ChromaSubsampling: "4:2:0", ScanType: "Progressive", BitrateType: "Variable", Captions: []string{"EIA-608"}},
+		},
+		{
+			name: "ffprobe SDR",
+			report: Report{Container: "matroska,webm", Codec: "h264", ColorPrimaries: "bt709", TransferCharacteristics: "bt709",
+				ChromaSubsampling: "yuv420p", ScanType: "progressive", BitrateType: "vbr", Captions: []string{"eia_608"}},
+			want: Report{Container: "Matroska", Codec: "AVC", ColorPrimaries: "BT.709", TransferCharacteristics: "BT.709",
+				ChromaSubsampling: "4:2:0", ScanType: "Progressive", BitrateType: "Variable", Captions: []string{"EIA-608"}},
+		},
+		{
+			name: "mediainfo HDR10",
+			report: Report{Container: "MPEG-4", Codec: "HEVC", ColorPrimaries: "BT.2020", TransferCharacteristics: "PQ",
+				ChromaSubsampling: "4:2:0", HDR: "SMPTE ST 2086, HDR10 compatible", ScanType: "Progressive", BitrateType: "Constant"},
+			want: Report{Container: "MPEG-4", Codec: "HEVC", ColorPrimaries: "BT.2020", TransferCharacteristics: "PQ",
+				ChromaSubsampling: "4:2:0", HDR: "HDR10", ScanType: "Progressive", BitrateType: "Constant"},
+		},
+		{
+			name: "ffprobe HDR10",
+			report: Report{Container: "mov,mp4,m4a,3gp,3g2,mj2", Codec: "hevc", ColorPrimaries: "bt2020", TransferCharacteristics: "smpte2084",
+				ChromaSubsampling: "yuv420p10le", ScanType: "progressive", BitrateType: "cbr"},
+			want: Report{Container: "MPEG-4", Codec: "HEVC", ColorPrimaries: "BT.2020", TransferCharacteristics: "PQ",
+				ChromaSubsampling: "4:2:0", HDR: "HDR10", ScanType: "Progressive", BitrateType: "Constant"},
+		},
+		{
+			name:   "fourcc HDR10",
+			report: Report{Container: "mp4", Codec: "hvc1", ColorPrimaries: "BT2020", TransferCharacteristics: "SMPTE2084", ChromaSubsampling: "420"},
+			want:   Report{Container: "MPEG-4", Codec: "HEVC", ColorPrimaries: "BT.2020", TransferCharacteristics: "PQ", ChromaSubsampling: "4:2:0", HDR: "HDR10"},
+		},
+		{
+			name: "mediainfo Dolby Vision",
+			report: Report{Container: "MPEG-4", Codec: "HEVC", ColorPrimaries: "BT.2020", TransferCharacteristics: "PQ",
+				HDR: "Dolby Vision, Version 1.0, dvhe.08.06, BL+RPU, HDR10 compatible / SMPTE ST 2086, HDR10 compatible"},
+			want: Report{Container: "MPEG-4", Codec: "HEVC", ColorPrimaries: "BT.2020", TransferCharacteristics: "PQ", HDR: "Dolby Vision"},
+		},
+		{
+			name:   "fourcc Dolby Vision",
+			report: Report{Container: "mp4", Codec: "dvh1", ColorPrimaries: "bt2020", TransferCharacteristics: "smpte2084", ChromaSubsampling: "yuv420p10le"},
+			want:   Report{Container: "MPEG-4", Codec: "HEVC", ColorPrimaries: "BT.2020", TransferCharacteristics: "PQ", ChromaSubsampling: "4:2:0", HDR: "Dolby Vision"},
+		},
+		{
+			name:   "PQ without BT.2020 primaries isn't HDR10",
+			report: Report{Container: "mp4", Codec: "hevc", ColorPrimaries: "bt709", TransferCharacteristics: "smpte2084"},
+			want:   Report{Container: "MPEG-4", Codec: "HEVC", ColorPrimaries: "BT.709", TransferCharacteristics: "PQ"},
+		},
+		{
+			name:   "ffprobe 12-bit SDR",
+			report: Report{Container: "mov", Codec: "prores", ColorPrimaries: "bt2020", TransferCharacteristics: "bt2020-12", ChromaSubsampling: "yuv422p10le"},
+			want:   Report{Container: "QuickTime", Codec: "ProRes", ColorPrimaries: "BT.2020", TransferCharacteristics: "BT.2020 (12-bit)", ChromaSubsampling: "4:2:2"},
+		},
+		{
+			name:   "ffprobe 12-bit 4:2:0",
+			report: Report{Container: "matroska", Codec: "av1", ChromaSubsampling: "yuv420p12le"},
+			want:   Report{Container: "Matroska", Codec: "AV1", ChromaSubsampling: "4:2:0"},
+		},
+		{
+			name:   "mediainfo HLG",
+			report: Report{Container: "MPEG-TS", Codec: "HEVC", ColorPrimaries: "BT.2020", TransferCharacteristics: "HLG"},
+			want:   Report{Container: "MPEG-TS", Codec: "HEVC", ColorPrimaries: "BT.2020", TransferCharacteristics: "HLG", HDR: "HLG"},
+		},
+		{
+			name:   "ffprobe HLG",
+			report: Report{Container: "mpegts", Codec: "hevc", ColorPrimaries: "bt2020", TransferCharacteristics: "arib-std-b67"},
+			want:   Report{Container: "MPEG-TS", Codec: "HEVC", ColorPrimaries: "BT.2020", TransferCharacteristics: "HLG", HDR: "HLG"},
+		},
+		{
+			name: "mediainfo interlaced DVD",
+			report: Report{Container: "MPEG-PS", Codec: "MPEG Video", ColorPrimaries: "BT.601 NTSC", TransferCharacteristics: "BT.601",
+				ChromaSubsampling: "4:2:0", ScanType: "Interlaced", Captions: []string{"EIA-708"}},
+			want: Report{Container: "MPEG-PS", Codec: "MPEG Video", ColorPrimaries: "BT.601 NTSC", TransferCharacteristics: "BT.601",
+				ChromaSubsampling: "4:2:0", ScanType: "Interlaced", Captions: []string{"EIA-708"}},
+		},
+		{
+			name: "ffprobe interlaced DVD",
+			report: Report{Container: "mpeg", Codec: "mpeg2video", ColorPrimaries: "smpte170m", TransferCharacteristics: "smpte170m",
+				ChromaSubsampling: "yuv420p", ScanType: "tt", Captions: []string{"cea-708"}},
+			want: Report{Container: "MPEG-PS", Codec: "MPEG Video", ColorPrimaries: "BT.601 NTSC", TransferCharacteristics: "BT.601",
+				ChromaSubsampling: "4:2:0", ScanType: "Interlaced", Captions: []string{"EIA-708"}},
+		},
+		{
+			name:   "ffprobe ProRes in QuickTime",
+			report: Report{Container: "mov", Codec: "prores", ChromaSubsampling: "yuv422p"},
+			want:   Report{Container: "QuickTime", Codec: "ProRes", ChromaSubsampling: "4:2:2"},
+		},
+		{
+			name:   "fourcc ProRes 4444 in QuickTime",
+			report: Report{Container: "QuickTime", Codec: "ap4h", ChromaSubsampling: "444"},
+			want:   Report{Container: "QuickTime", Codec: "ProRes", ChromaSubsampling: "4:4:4"},
+		},
+		{
+			name:   "padding and case are ignored",
+			report: Report{Container: " MKV ", Codec: "H.264\n", ColorPrimaries: " Bt709", TransferCharacteristics: "SMPTE2084 "},
+			want:   Report{Container: "Matroska", Codec: "AVC", ColorPrimaries: "BT.709", TransferCharacteristics: "PQ"},
+		},
+		{
+			name:   "unknown values are left alone",
+			report: Report{Container: "Some Container", Codec: "Some Codec", TransferCharacteristics: "Some Transfer"},
+			want:   Report{Container: "Some Container", Codec: "Some Codec", TransferCharacteristics: "Some Transfer"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := test.report
+			report.Captions = append([]string(nil), test.report.Captions...)
+			normalizeReport(&report)
+			if !reflect.DeepEqual(report, test.want) {
+				t.Errorf("normalizeReport() = %+v, want %+v", report, test.want)
+			}
+		})
+	}
+}
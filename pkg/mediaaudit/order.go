@@ -0,0 +1,72 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Scan orders
+const (
+	OrderWalk              string = "walk"                // As found, directory by directory in lexical order
+	OrderNewestFirst       string = "newest-first"        // Most recently modified first, so new and changed files are done early
+	OrderLargestFirst      string = "largest-first"       // Biggest files first, usually the ones worth checking most
+	OrderNeverScannedFirst string = "never-scanned-first" // Files not in Scanner.History, or changed since, first, then newest first
+	OrderRandom            string = "random"              // Shuffled differently every run, so repeated partial scans spread out
+)
+
+// ValidOrder checks order is one Scanner.Order accepts
+func ValidOrder(order string) error {
+	switch order {
+	case "", OrderWalk, OrderNewestFirst, OrderLargestFirst, OrderNeverScannedFirst, OrderRandom:
+		return nil
+	}
+	return fmt.Errorf("Unknown order %q, expected one of %s, %s, %s, %s or %s", order, OrderWalk, OrderNewestFirst, OrderLargestFirst, OrderNeverScannedFirst, OrderRandom)
+}
+
+// orderFiles sorts files in place for s.Order
+func (s *Scanner) orderFiles(files []foundFile) {
+	switch s.Order {
+	case OrderNewestFirst:
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].info.ModTime().After(files[j].info.ModTime())
+		})
+	case OrderLargestFirst:
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].info.Size() > files[j].info.Size()
+		})
+	case OrderNeverScannedFirst:
+		scanned := make([]bool, len(files))
+		for i, file := range files {
+			scanned[i] = s.History != nil && s.History.Done(file.path, file.info)
+		}
+		sort.Sort(neverScannedFirst{files: files, scanned: scanned})
+	case OrderRandom:
+		rand.New(rand.NewSource(time.Now().UnixNano())).Shuffle(len(files), func(i, j int) {
+			files[i], files[j] = files[j], files[i]
+		})
+	}
+}
+
+// neverScannedFirst sorts files that haven't been scanned before the ones that have, newest first within each
+type neverScannedFirst struct {
+	files   []foundFile
+	scanned []bool
+}
+
+func (n neverScannedFirst) Len() int {
+	return len(n.files)
+}
+
+func (n neverScannedFirst) Less(i, j int) bool {
+	if n.scanned[i] != n.scanned[j] {
+		return !n.scanned[i]
+	}
+	return n.files[i].info.ModTime().After(n.files[j].info.ModTime())
+}
+
+func (n neverScannedFirst) Swap(i, j int) {
+	n.files[i], n.files[j] = n.files[j], n.files[i]
+	n.scanned[i], n.scanned[j] = n.scanned[j], n.scanned[i]
+}
@@ -0,0 +1,335 @@
+package mediaaudit
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Containers reported for packages, in place of the MXF their track files are wrapped in
+const (
+	ContainerIMF     string = "IMF"
+	ContainerDCP     string = "DCP"
+	ContainerPackage string = "Package" // Has an ASSETMAP, but no composition playlist to tell which
+)
+
+// assetMapNames are what the ASSETMAP is called at the root of a package,
+// Interop DCPs leave off the extension that SMPTE DCPs and IMF packages have
+var assetMapNames []string = []string{"ASSETMAP.xml", "ASSETMAP"}
+
+// isAssetMap reports whether path is a package's ASSETMAP, which stands in for the whole package during a scan
+func isAssetMap(path string) bool {
+	name := filepath.Base(path)
+	for _, assetMap := range assetMapNames {
+		if strings.EqualFold(name, assetMap) {
+			return true
+		}
+	}
+	return false
+}
+
+// findPackage returns the ASSETMAP of the IMF or DCP package in dir, if there is one,
+// along with info covering the whole package
+func findPackage(dir string) (string, os.FileInfo, bool) {
+	for _, name := range assetMapNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			if info, err := statPackage(path, info); err == nil {
+				return path, info, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// packageInfo describes a whole package by its ASSETMAP
+// The ASSETMAP's identity is kept, so IDs and hardlink counts stay stable,
+// but the name, size and modification time are the package folder's, and everything in it
+type packageInfo struct {
+	os.FileInfo
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (p *packageInfo) Name() string       { return p.name }
+func (p *packageInfo) Size() int64        { return p.size }
+func (p *packageInfo) ModTime() time.Time { return p.modTime }
+
+// statPackage totals up the size of everything in the package with the ASSETMAP at path,
+// and finds when any of it was last modified
+func statPackage(path string, info os.FileInfo) (os.FileInfo, error) {
+	dir := filepath.Dir(path)
+	total := &packageInfo{FileInfo: info, name: filepath.Base(dir), modTime: info.ModTime()}
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			total.size += info.Size()
+			if info.ModTime().After(total.modTime) {
+				total.modTime = info.ModTime()
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// statFile is os.Stat, except that an ASSETMAP stands for its whole package
+func statFile(path string) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil || !isAssetMap(path) {
+		return info, err
+	}
+	return statPackage(path, info)
+}
+
+// assetMapXML is the part of an ASSETMAP we need, where to find each asset
+type assetMapXML struct {
+	Assets []struct {
+		ID    string   `xml:"Id"`
+		Paths []string `xml:"ChunkList>Chunk>Path"`
+	} `xml:"AssetList>Asset"`
+}
+
+// packingListXML is the part of a packing list we need, how big each asset should be
+type packingListXML struct {
+	XMLName xml.Name
+	Assets  []struct {
+		ID   string `xml:"Id"`
+		Size int64  `xml:"Size"`
+	} `xml:"AssetList>Asset"`
+}
+
+// cplResource is a track file, or a stretch of one, in a composition playlist
+// DCPs name the track file by Id and IMF packages by TrackFileId
+type cplResource struct {
+	ID                string `xml:"Id"`
+	TrackFileID       string `xml:"TrackFileId"`
+	EditRate          string `xml:"EditRate"`
+	IntrinsicDuration int64  `xml:"IntrinsicDuration"`
+	EntryPoint        int64  `xml:"EntryPoint"`
+	Duration          int64  `xml:"Duration"`
+	SourceDuration    int64  `xml:"SourceDuration"`
+	RepeatCount       int64  `xml:"RepeatCount"`
+}
+
+// compositionPlaylistXML is the part of a composition playlist we need, the picture track of every reel or segment
+// DCPs are made of reels, and IMF compositions of segments
+type compositionPlaylistXML struct {
+	XMLName  xml.Name
+	EditRate string `xml:"EditRate"`
+	Reels    []struct {
+		Picture       []cplResource `xml:"AssetList>MainPicture"`
+		StereoPicture []cplResource `xml:"AssetList>MainStereoscopicPicture"`
+	} `xml:"ReelList>Reel"`
+	Segments []struct {
+		Images []cplResource `xml:"SequenceList>MainImageSequence>ResourceList>Resource"`
+	} `xml:"SegmentList>Segment"`
+}
+
+// pictures lists the main picture track of every reel or segment, in order
+func (c *compositionPlaylistXML) pictures() []cplResource {
+	var pictures []cplResource
+	for _, reel := range c.Reels {
+		pictures = append(pictures, reel.Picture...)
+		pictures = append(pictures, reel.StereoPicture...)
+	}
+	for _, segment := range c.Segments {
+		pictures = append(pictures, segment.Images...)
+	}
+	return pictures
+}
+
+// durationSeconds adds up how long every picture track plays for
+func (c *compositionPlaylistXML) durationSeconds() float64 {
+	seconds := 0.0
+	for _, picture := range c.pictures() {
+		editRate := picture.EditRate
+		if editRate == "" {
+			editRate = c.EditRate
+		}
+		rate, ok := parseEditRate(editRate)
+		if !ok {
+			continue
+		}
+
+		frames := picture.Duration
+		if picture.SourceDuration > 0 {
+			frames = picture.SourceDuration
+		}
+		if frames == 0 {
+			frames = picture.IntrinsicDuration - picture.EntryPoint
+		}
+		if picture.RepeatCount > 1 {
+			frames *= picture.RepeatCount
+		}
+		seconds += float64(frames) / rate
+	}
+	return seconds
+}
+
+// parseEditRate parses an edit rate as written in a composition playlist, e.g. 24000 1001
+func parseEditRate(editRate string) (float64, bool) {
+	fields := strings.Fields(editRate)
+	if len(fields) != 2 {
+		return 0, false
+	}
+	numerator, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	denominator, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || numerator <= 0 || denominator <= 0 {
+		return 0, false
+	}
+	return numerator / denominator, true
+}
+
+// readXML decodes the XML file at path into v
+func readXML(path string, v interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return xml.NewDecoder(file).Decode(v)
+}
+
+// summarizeProblems lists up to a few examples of a kind of problem, and how many more there are
+func summarizeProblems(kind string, examples []string) string {
+	const shown = 3
+	if len(examples) <= shown {
+		return fmt.Sprintf("%s: %s", kind, strings.Join(examples, " "))
+	}
+	return fmt.Sprintf("%s: %s and %d more", kind, strings.Join(examples[:shown], " "), len(examples)-shown)
+}
+
+// probePackage builds the report for the IMF or DCP package with the ASSETMAP at path,
+// checking that everything its ASSETMAP, packing lists and composition playlists refer to is there
+// The first composition playlist's main picture track is probed for the video details, and its path returned
+// so that checks needing the file itself can use it, empty if there's no picture track to probe
+func (s *Scanner) probePackage(ctx context.Context, path string) (*Report, string, error) {
+	dir := filepath.Dir(path)
+	var assetMap assetMapXML
+	if err := readXML(path, &assetMap); err != nil {
+		return nil, "", fmt.Errorf("Failed to read the ASSETMAP %q: %w", path, err)
+	}
+
+	var problems, missing, wrongSize, outside []string
+	assetPaths := make(map[string]string)
+	var packingLists []packingListXML
+	var playlists []compositionPlaylistXML
+	for _, asset := range assetMap.Assets {
+		if len(asset.Paths) == 0 {
+			continue
+		}
+		assetPath := filepath.Join(dir, filepath.FromSlash(asset.Paths[0]))
+		assetPaths[strings.ToLower(asset.ID)] = assetPath
+		if _, err := os.Stat(assetPath); err != nil {
+			missing = append(missing, asset.Paths[0])
+			continue
+		}
+		if !strings.EqualFold(filepath.Ext(assetPath), ".xml") {
+			continue
+		}
+
+		// Packing lists and playlists are told apart by their root element
+		var packingList packingListXML
+		if err := readXML(assetPath, &packingList); err == nil && packingList.XMLName.Local == "PackingList" {
+			packingLists = append(packingLists, packingList)
+			continue
+		}
+		var playlist compositionPlaylistXML
+		if err := readXML(assetPath, &playlist); err == nil && playlist.XMLName.Local == "CompositionPlaylist" {
+			playlists = append(playlists, playlist)
+		}
+	}
+
+	for _, packingList := range packingLists {
+		for _, asset := range packingList.Assets {
+			assetPath, ok := assetPaths[strings.ToLower(asset.ID)]
+			if !ok || asset.Size <= 0 {
+				continue
+			}
+			if info, err := os.Stat(assetPath); err == nil && info.Size() != asset.Size {
+				wrongSize = append(wrongSize, filepath.Base(assetPath))
+			}
+		}
+	}
+
+	report := &Report{Container: ContainerPackage}
+	media := ""
+	if len(playlists) == 0 {
+		problems = append(problems, "no composition playlist")
+	} else {
+		for _, playlist := range playlists {
+			for _, picture := range playlist.pictures() {
+				id := picture.TrackFileID
+				if id == "" {
+					id = picture.ID
+				}
+				if _, ok := assetPaths[strings.ToLower(id)]; !ok {
+					outside = append(outside, id)
+				}
+			}
+		}
+
+		playlist := playlists[0]
+		report.Container = ContainerDCP
+		if len(playlist.Segments) > 0 {
+			report.Container = ContainerIMF
+		}
+		report.DurationSeconds = playlist.durationSeconds()
+		if pictures := playlist.pictures(); len(pictures) > 0 {
+			id := pictures[0].TrackFileID
+			if id == "" {
+				id = pictures[0].ID
+			}
+			media = assetPaths[strings.ToLower(id)]
+		}
+	}
+
+	if len(missing) > 0 {
+		problems = append(problems, summarizeProblems("missing", missing))
+	}
+	if len(wrongSize) > 0 {
+		problems = append(problems, summarizeProblems("wrong size", wrongSize))
+	}
+	if len(outside) > 0 {
+		problems = append(problems, fmt.Sprintf("picture tracks not in the package: %d", len(outside)))
+	}
+
+	// The picture track has the video details, but the package has the last word on what it is and how long it plays
+	if media != "" {
+		if _, err := os.Stat(media); err == nil {
+			var picture *Report
+			err := s.probeWithRetries(ctx, media, func(ctx context.Context) (err error) {
+				picture, err = s.Backend.Probe(ctx, media)
+				return err
+			})
+			if err != nil {
+				s.logf(LevelWarn, path, "Failed to probe the picture track %q of %q: %s", media, dir, err.Error())
+				problems = append(problems, "picture track couldn't be probed")
+			} else {
+				picture.Container = report.Container
+				if report.DurationSeconds > 0 {
+					picture.DurationSeconds = report.DurationSeconds
+				}
+				report = picture
+			}
+		}
+	}
+
+	report.Package = "ok"
+	if len(problems) > 0 {
+		report.Package = strings.Join(problems, ", ")
+	}
+	return report, media, nil
+}
@@ -0,0 +1,159 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Matches a part tag at the end of a name, e.g. Movie (2010) - cd1, Movie.part2 or Show - S01E01 - pt1
+// The tag has to be set off with a dot, underscore or dash, as Plex and Jellyfin expect, so that
+// a title like The Godfather Part 2 isn't taken for the second half of The Godfather
+var partRegex *regexp.Regexp = regexp.MustCompile(`(?i)^(.+?)\s*[._-][ ._-]*(?:cd|dvd|part|pt|disc|disk)[ ._-]*(\d{1,2})$`)
+
+// detectPart fills in Title and Part if the file at path is one part of a multi-part release
+func detectPart(report *Report, path string) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if match := partRegex.FindStringSubmatch(name); match != nil {
+		report.Title = strings.TrimSpace(match[1])
+		report.Part = match[2]
+	}
+}
+
+// PartGrouper combines the parts of multi-part releases into a single report per title
+// Reports that aren't parts are passed straight through, parts are held until Flush
+type PartGrouper struct {
+	next   Writer
+	groups map[string][]*Report // Keyed by folder and title, so parts only group with their siblings
+	order  []string
+}
+
+// NewPartGrouper returns a PartGrouper writing to next
+func NewPartGrouper(next Writer) *PartGrouper {
+	return &PartGrouper{next: next, groups: make(map[string][]*Report)}
+}
+
+func (g *PartGrouper) Write(report *Report) error {
+	if report.Part == "" {
+		return g.next.Write(report)
+	}
+	key := filepath.Join(filepath.Dir(report.Path), report.Title)
+	if _, ok := g.groups[key]; !ok {
+		g.order = append(g.order, key)
+	}
+	g.groups[key] = append(g.groups[key], report)
+	return nil
+}
+
+// Flush writes a combined report for every title seen so far
+// A part on its own, or parts that share a number, e.g. the same cd1 in two containers, are written as they are
+func (g *PartGrouper) Flush() error {
+	for _, key := range g.order {
+		parts := g.groups[key]
+		if !separateParts(parts) {
+			for _, part := range parts {
+				if err := g.next.Write(part); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := g.next.Write(combineParts(parts)); err != nil {
+			return err
+		}
+	}
+	g.groups = make(map[string][]*Report)
+	g.order = nil
+	return nil
+}
+
+// Close flushes, then closes the underlying writer
+func (g *PartGrouper) Close() error {
+	if err := g.Flush(); err != nil {
+		return err
+	}
+	return g.next.Close()
+}
+
+// separateParts reports whether parts are at least two different parts of a title
+func separateParts(parts []*Report) bool {
+	if len(parts) < 2 {
+		return false
+	}
+	seen := make(map[int]bool)
+	for _, part := range parts {
+		number, _ := strconv.Atoi(part.Part)
+		if seen[number] {
+			return false
+		}
+		seen[number] = true
+	}
+	return true
+}
+
+// combineParts makes one report for a title from its parts
+// The first part's details are used for the whole title, except that sizes and durations are added up,
+// the bitrate is averaged over the duration, and any part failing a check fails the title
+// Parts of one release are encoded alike, so each part's own codec, resolution and so on aren't kept,
+// the combined row is for totals and anyone who needs them per part can scan without grouping
+func combineParts(parts []*Report) *Report {
+	sort.Slice(parts, func(i, j int) bool {
+		a, _ := strconv.Atoi(parts[i].Part)
+		b, _ := strconv.Atoi(parts[j].Part)
+		return a < b
+	})
+
+	combined := *parts[0]
+	if len(parts) == 1 {
+		return &combined
+	}
+	combined.Name = filepath.Join(filepath.Dir(parts[0].Name), parts[0].Title)
+
+	var numbers []string
+	var bitrateSeconds float64
+	combined.SizeMB, combined.DurationSeconds, combined.Chapters, combined.TrailingBytes = 0, 0, 0, 0
+	for _, part := range parts {
+		numbers = append(numbers, part.Part)
+		combined.SizeMB += part.SizeMB
+		combined.DurationSeconds += part.DurationSeconds
+		combined.Chapters += part.Chapters
+		combined.TrailingBytes += part.TrailingBytes
+		bitrateSeconds += part.BitrateMbps * part.DurationSeconds
+		combined.ExtensionMismatch = combined.ExtensionMismatch || part.ExtensionMismatch
+		combined.MissingCaptions = combined.MissingCaptions || part.MissingCaptions
+		combined.Structure = worseCheck(combined.Structure, part.Structure)
+		combined.Decode = worseCheck(combined.Decode, part.Decode)
+		combined.NFO = worseCheck(combined.NFO, part.NFO)
+		combined.Naming = worseCheck(combined.Naming, part.Naming)
+		combined.AspectRatio = worseCheck(combined.AspectRatio, part.AspectRatio)
+		combined.Spec = worseCheck(combined.Spec, part.Spec)
+		combined.Package = worseCheck(combined.Package, part.Package)
+		combined.Parental = worseCheck(combined.Parental, part.Parental)
+		combined.Frames = worseCheck(combined.Frames, part.Frames)
+		combined.AudioDropouts = worseCheck(combined.AudioDropouts, part.AudioDropouts)
+	}
+	combined.Part = strings.Join(numbers, "+")
+	if combined.TrailingMB != "" {
+		combined.TrailingMB = fmt.Sprintf("%.2f", float64(combined.TrailingBytes)/1048576)
+	}
+	if combined.DurationSeconds > 0 {
+		combined.BitrateMbps = bitrateSeconds / combined.DurationSeconds
+	}
+	return &combined
+}
+
+// worseCheck picks the more interesting of two check results, a problem over ok, and ok over not checked
+func worseCheck(a, b string) string {
+	switch {
+	case a != "" && a != "ok":
+		return a
+	case b != "" && b != "ok":
+		return b
+	case a == "ok" || b == "ok":
+		return "ok"
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+package mediaaudit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectPart(t *testing.T) {
+	tests := []struct {
+		path  string
+		title string
+		part  string
+	}{
+		{"/media/Movie (2010)/Movie (2010) - cd1.avi", "Movie (2010)", "1"},
+		{"/media/Movie (2010)/Movie (2010).part2.mkv", "Movie (2010)", "2"},
+		{"/media/Movie (2010)/Movie (2010)_DISC 3.mkv", "Movie (2010)", "3"},
+		{"/media/Show/Show - S01E01 - pt1.mkv", "Show - S01E01", "1"},
+		{"/media/The Godfather Part 2.mkv", "", ""},
+		{"/media/Movie (2010)/Movie (2010).mkv", "", ""},
+	}
+	for _, test := range tests {
+		report := &Report{}
+		detectPart(report, test.path)
+		if report.Title != test.title || report.Part != test.part {
+			t.Errorf("detectPart(%q) = %q, %q, want %q, %q", test.path, report.Title, report.Part, test.title, test.part)
+		}
+	}
+}
+
+// orderedWriter keeps every report in the order it was written, unlike collectingWriter
+type orderedWriter struct {
+	reports []*Report
+}
+
+func (w *orderedWriter) Write(report *Report) error {
+	w.reports = append(w.reports, report)
+	return nil
+}
+
+func (w *orderedWriter) Close() error {
+	return nil
+}
+
+func TestPartGrouper(t *testing.T) {
+	part := func(name string, sizeMB float64, duration float64, bitrate float64) *Report {
+		report := &Report{Path: "/media/Movie (2010)/" + name, Name: name, SizeMB: sizeMB, DurationSeconds: duration, BitrateMbps: bitrate}
+		detectPart(report, report.Path)
+		return report
+	}
+	tests := []struct {
+		name    string
+		reports []*Report
+		want    []string // Name and Part of each report written
+	}{
+		{
+			name:    "parts are combined",
+			reports: []*Report{part("Movie (2010) - cd2.avi", 700, 3000, 2), part("Movie (2010) - cd1.avi", 700, 1000, 4), part("Extras.avi", 100, 60, 1)},
+			want:    []string{"Extras.avi ", "Movie (2010) 1+2"},
+		},
+		{
+			name:    "a lone part is left alone",
+			reports: []*Report{part("Movie (2010) - cd2.avi", 700, 3000, 2)},
+			want:    []string{"Movie (2010) - cd2.avi 2"},
+		},
+		{
+			name:    "the same part twice isn't a release",
+			reports: []*Report{part("Movie (2010) - cd1.avi", 700, 3000, 2), part("Movie (2010) - cd1.mkv", 500, 3000, 1.5)},
+			want:    []string{"Movie (2010) - cd1.avi 1", "Movie (2010) - cd1.mkv 1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := &orderedWriter{}
+			grouper := NewPartGrouper(w)
+			for _, report := range test.reports {
+				if err := grouper.Write(report); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := grouper.Close(); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, report := range w.reports {
+				got = append(got, report.Name+" "+report.Part)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("PartGrouper wrote %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	w := &orderedWriter{}
+	grouper := NewPartGrouper(w)
+	grouper.Write(part("Movie (2010) - cd1.avi", 700, 1000, 4))
+	grouper.Write(part("Movie (2010) - cd2.avi", 700, 3000, 2))
+	grouper.Flush()
+	if combined := w.reports[0]; combined.SizeMB != 1400 || combined.DurationSeconds != 4000 || combined.BitrateMbps != 2.5 {
+		t.Errorf("Combined part = %.0f MB, %.0f seconds, %.2f Mbps, want 1400 MB, 4000 seconds, 2.50 Mbps", combined.SizeMB, combined.DurationSeconds, combined.BitrateMbps)
+	}
+}
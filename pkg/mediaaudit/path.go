@@ -0,0 +1,32 @@
+package mediaaudit
+
+import "path/filepath"
+
+// Ways of naming files in the output
+const (
+	PathStyleRelative string = "relative"
+	PathStyleAbsolute string = "absolute"
+	PathStyleBasename string = "basename"
+)
+
+// displayPath formats the path of a file found under root according to style
+// We fall back to the path as walked if it can't be converted
+func displayPath(root, path, style string) string {
+	switch style {
+	case PathStyleRelative:
+		if rel, err := filepath.Rel(root, path); err == nil {
+			return rel
+		}
+	case PathStyleAbsolute:
+		if abs, err := filepath.Abs(path); err == nil {
+			return abs
+		}
+	default:
+		// Camcorders number their clips from 00000.MTS, so name them after the folder they were imported to
+		if folder, clip, ok := bdmvClip(path); ok {
+			return filepath.Join(filepath.Base(folder), clip)
+		}
+		return filepath.Base(path)
+	}
+	return path
+}
@@ -0,0 +1,57 @@
+package mediaaudit
+
+import (
+	"context"
+	"sync"
+)
+
+// pauseState is shared by every scan a Scanner runs
+type pauseState struct {
+	lock    sync.Mutex
+	resumed chan struct{} // Closed on Resume, nil while not paused
+}
+
+// Pause stops a running scan from starting any more probes until Resume is called
+// Probes already running are left to finish, and nothing is lost, so it's safe to pause for as long as needed
+// Pausing before a scan starts makes it wait before probing its first file
+func (s *Scanner) Pause() {
+	s.pause.lock.Lock()
+	defer s.pause.lock.Unlock()
+	if s.pause.resumed == nil {
+		s.pause.resumed = make(chan struct{})
+	}
+}
+
+// Resume lets a paused scan carry on where it left off
+func (s *Scanner) Resume() {
+	s.pause.lock.Lock()
+	defer s.pause.lock.Unlock()
+	if s.pause.resumed != nil {
+		close(s.pause.resumed)
+		s.pause.resumed = nil
+	}
+}
+
+// Paused reports whether Pause has been called without a Resume since
+func (s *Scanner) Paused() bool {
+	s.pause.lock.Lock()
+	defer s.pause.lock.Unlock()
+	return s.pause.resumed != nil
+}
+
+// waitWhilePaused blocks until the scanner is resumed, or ctx is done
+func (s *Scanner) waitWhilePaused(ctx context.Context) error {
+	s.pause.lock.Lock()
+	resumed := s.pause.resumed
+	s.pause.lock.Unlock()
+	if resumed == nil {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resumed:
+		return nil
+	}
+}
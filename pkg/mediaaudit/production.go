@@ -0,0 +1,176 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Classes of file on production storage
+const (
+	ClassCameraOriginal string = "camera-original" // Straight from the camera, or an intermediate at a bitrate fit to grade from
+	ClassProxy          string = "proxy"           // A lightweight stand-in for editing
+	ClassDeliverable    string = "deliverable"     // Encoded for distribution
+	ClassOther          string = "other"
+)
+
+// ProductionClasses are the classes in the order they're summarised
+var ProductionClasses []string = []string{ClassCameraOriginal, ClassProxy, ClassDeliverable, ClassOther}
+
+// rawCodecs only ever come out of a camera
+var rawCodecs map[string]bool = map[string]bool{
+	"ProRes RAW":     true,
+	"REDCode":        true,
+	"ARRIRAW":        true,
+	"Blackmagic RAW": true,
+	"CinemaDNG":      true,
+}
+
+// intermediateCodecs are the editing codecs, used for camera originals and proxies alike
+var intermediateCodecs map[string]bool = map[string]bool{
+	"ProRes":   true,
+	"VC-3":     true,
+	"CineForm": true,
+}
+
+// deliveryCodecs are the long-GOP codecs, used for deliverables and by consumer and mid-range cameras alike
+var deliveryCodecs map[string]bool = map[string]bool{
+	"AVC":           true,
+	"HEVC":          true,
+	"AV1":           true,
+	"VP9":           true,
+	"MPEG-4 Visual": true,
+	"MPEG Video":    true,
+}
+
+// Bitrates, in Mbps per million pixels, that tell the classes apart
+// ProRes LT is about 50 at 1080p and ProRes Proxy and DNxHD 36 about 20,
+// while cameras record AVC and HEVC at 12 or more and deliverables rarely go over 5
+const (
+	intermediateProxyMbpsPerMegapixel = 30
+	cameraLongGOPMbpsPerMegapixel     = 10
+)
+
+// proxyPattern matches the folders and names editing software gives proxies
+var proxyPattern *regexp.Regexp = regexp.MustCompile(`(?i)(^|[^a-z])prox(y|ies)([^a-z]|$)`)
+
+// projectFolder is the folder directly under root that path is in, "." if it's in root itself
+func projectFolder(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "."
+	}
+	if project, _, ok := cut(filepath.ToSlash(rel), "/"); ok {
+		return project
+	}
+	return "."
+}
+
+// classifyFile guesses whether a file is a camera original, a proxy or a deliverable from its name, codec and bitrate
+func classifyFile(root, path string, report *Report) string {
+	if rel, err := filepath.Rel(root, path); err == nil && proxyPattern.MatchString(rel) {
+		return ClassProxy
+	}
+	if rawCodecs[report.Codec] {
+		return ClassCameraOriginal
+	}
+	// ProRes Proxy and DNxHR LB are made for nothing else
+	if strings.Contains(report.CodecProfile, "Proxy") || strings.HasSuffix(report.CommercialName, " LB") {
+		return ClassProxy
+	}
+
+	megapixels := float64(report.Width) * float64(report.Height) / 1000000
+	if megapixels <= 0 || report.BitrateMbps <= 0 {
+		return ClassOther
+	}
+	density := report.BitrateMbps / megapixels
+	switch {
+	case intermediateCodecs[report.Codec] && density < intermediateProxyMbpsPerMegapixel:
+		return ClassProxy
+	case intermediateCodecs[report.Codec]:
+		return ClassCameraOriginal
+	case deliveryCodecs[report.Codec] && density >= cameraLongGOPMbpsPerMegapixel:
+		return ClassCameraOriginal
+	case deliveryCodecs[report.Codec]:
+		return ClassDeliverable
+	}
+	return ClassOther
+}
+
+// productionTotal is what a ProductionWriter has seen of one class in one project
+type productionTotal struct {
+	files  int
+	sizeMB float64
+}
+
+// ProductionWriter is a Writer that tallies files and sizes by project and class,
+// and prints the breakdown when closed
+// Hardlinked files are only counted once
+type ProductionWriter struct {
+	out      io.Writer
+	projects map[string]map[string]*productionTotal
+	seen     map[string]bool
+}
+
+// NewProductionWriter returns a ProductionWriter that prints to out
+func NewProductionWriter(out io.Writer) *ProductionWriter {
+	return &ProductionWriter{out: out, projects: make(map[string]map[string]*productionTotal), seen: make(map[string]bool)}
+}
+
+func (p *ProductionWriter) Write(report *Report) error {
+	if p.seen[report.ID] {
+		return nil
+	}
+	p.seen[report.ID] = true
+
+	classes, ok := p.projects[report.Project]
+	if !ok {
+		classes = make(map[string]*productionTotal)
+		p.projects[report.Project] = classes
+	}
+	total, ok := classes[report.Class]
+	if !ok {
+		total = &productionTotal{}
+		classes[report.Class] = total
+	}
+	total.files++
+	total.sizeMB += report.SizeMB
+	return nil
+}
+
+// Close prints a row per project, with the files and space taken by each class
+func (p *ProductionWriter) Close() error {
+	var projects []string
+	for project := range p.projects {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+
+	table := tabwriter.NewWriter(p.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "Project\t%s\tTotal\n", strings.Join(ProductionClasses, "\t"))
+	for _, project := range projects {
+		var all productionTotal
+		cells := []string{project}
+		for _, class := range ProductionClasses {
+			total, ok := p.projects[project][class]
+			if !ok {
+				cells = append(cells, "-")
+				continue
+			}
+			all.files += total.files
+			all.sizeMB += total.sizeMB
+			cells = append(cells, total.String())
+		}
+		cells = append(cells, all.String())
+		fmt.Fprintln(table, strings.Join(cells, "\t"))
+	}
+	return table.Flush()
+}
+
+func (t productionTotal) String() string {
+	return fmt.Sprintf("%d files, %.2f GiB", t.files, t.sizeMB/1024)
+}
@@ -0,0 +1,117 @@
+package mediaaudit
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Quality metrics
+const (
+	QualityVMAF string = "vmaf"
+	QualitySSIM string = "ssim"
+)
+
+// DefaultQualityConcurrency is how many quality comparisons run at once when Scanner.QualityConcurrency is unset
+// Each one decodes two full streams, so they have their own, much smaller, limit than probes
+const DefaultQualityConcurrency int64 = 1
+
+var (
+	// e.g. "VMAF score: 93.452107"
+	vmafScoreRegex *regexp.Regexp = regexp.MustCompile(`VMAF score:\s*([0-9.]+)`)
+	// e.g. "SSIM Y:0.981 (17.2) U:0.990 (20.1) V:0.991 (20.4) All:0.984 (18.0)"
+	ssimScoreRegex *regexp.Regexp = regexp.MustCompile(`SSIM .*All:([0-9.]+)`)
+)
+
+// References maps encoded files to the sources they were made from
+type References struct {
+	root    string // Relative encode paths are resolved against this
+	sources map[string]string
+}
+
+// LoadReferences reads a CSV of encoded file, reference file pairs, without a header
+// Relative paths are relative to the directory the CSV is in
+func LoadReferences(path string) (*References, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	references := &References{root: filepath.Dir(absolute), sources: make(map[string]string)}
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 2
+	reader.Comment = '#'
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read references from %q: %w", path, err)
+		}
+		references.sources[references.resolve(record[0])] = references.resolve(record[1])
+	}
+	return references, nil
+}
+
+// resolve makes path absolute relative to the references file
+func (r *References) resolve(path string) string {
+	path = strings.TrimSpace(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.root, path)
+	}
+	return filepath.Clean(path)
+}
+
+// Len is how many encoded files have a reference
+func (r *References) Len() int {
+	return len(r.sources)
+}
+
+// Reference returns the source for the encoded file at path, if there is one
+func (r *References) Reference(path string) (string, bool) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	source, ok := r.sources[filepath.Clean(absolute)]
+	return source, ok
+}
+
+// measureQuality compares the whole of the encoded file at path to its reference with ffmpeg
+// The encode is scaled to the reference's size first, so a downscaled encode is scored as it'd be watched
+func measureQuality(ctx context.Context, path, reference, metric string) (string, error) {
+	var filter string
+	var scoreRegex *regexp.Regexp
+	switch metric {
+	case QualityVMAF:
+		filter, scoreRegex = "libvmaf", vmafScoreRegex
+	case QualitySSIM:
+		filter, scoreRegex = "ssim", ssimScoreRegex
+	default:
+		return "", fmt.Errorf("Unknown quality metric %q", metric)
+	}
+
+	graph := "[0:v][1:v]scale2ref=flags=bicubic[encode][reference];[encode][reference]" + filter
+	output, err := runFFmpegFilter(ctx, "-i", path, "-i", reference, "-lavfi", graph)
+	if err != nil {
+		return "", err
+	}
+
+	matches := scoreRegex.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return "", fmt.Errorf("No %s score in ffmpeg output for %q", metric, path)
+	}
+	return matches[len(matches)-1][1], nil
+}
@@ -0,0 +1,159 @@
+package mediaaudit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ratingAges puts the common content ratings on one scale, the age they're roughly meant for,
+// so a limit in one system can be checked against ratings from another
+// Plain numbers, like Germany's FSK 12 or the UK's 15, are their own age
+var ratingAges map[string]int = map[string]int{
+	// US films
+	"G":     0,
+	"PG":    8,
+	"PG-13": 13,
+	"R":     17,
+	"NC-17": 18,
+	// US television
+	"TV-Y":  0,
+	"TV-G":  0,
+	"TV-Y7": 7,
+	"TV-PG": 8,
+	"TV-14": 14,
+	"TV-MA": 17,
+	// UK, where PG is the same as the US
+	"U":   0,
+	"12A": 12,
+	"R18": 18,
+	// Canada and Australia
+	"14A":   14,
+	"18A":   18,
+	"M":     15,
+	"MA15+": 15,
+	"R18+":  18,
+	"X18+":  18,
+}
+
+// unratedNames are what scrapers write for a title that was never rated
+var unratedNames []string = []string{"NR", "Not Rated", "Unrated", "TV-NR"}
+
+// ratingAge returns the age rating is meant for
+func ratingAge(rating string) (int, bool) {
+	rating = strings.ToUpper(strings.TrimSpace(rating))
+	if age, ok := ratingAges[rating]; ok {
+		return age, true
+	}
+	age, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rating, "FSK "), "+"))
+	return age, err == nil && age >= 0
+}
+
+// RatingLimit is the highest rating allowed in a restricted folder, e.g. PG in Kids
+type RatingLimit struct {
+	Folder string // Relative to the scanned directory
+	Rating string
+	age    int
+}
+
+// ParseRatingLimits parses a comma separated list of folder=rating limits, e.g. Kids=PG,Teens=PG-13
+func ParseRatingLimits(value string) ([]RatingLimit, error) {
+	var limits []RatingLimit
+	for _, limit := range strings.Split(value, ",") {
+		if limit = strings.TrimSpace(limit); limit == "" {
+			continue
+		}
+		folder, rating, ok := cut(limit, "=")
+		folder = strings.Trim(filepath.ToSlash(strings.TrimSpace(folder)), "/")
+		rating = strings.TrimSpace(rating)
+		if !ok || folder == "" {
+			return nil, fmt.Errorf("Invalid rating limit %q, expected something like Kids=PG", limit)
+		}
+		age, ok := ratingAge(rating)
+		if !ok {
+			return nil, fmt.Errorf("Unknown rating %q in %q", rating, limit)
+		}
+		limits = append(limits, RatingLimit{Folder: folder, Rating: rating, age: age})
+	}
+	return limits, nil
+}
+
+// nfoRating is the part of a Kodi .nfo file with the content rating
+// Kodi writes mpaa, e.g. Rated PG-13 or US:PG-13, and some scrapers certification, e.g. US:PG-13 / GB:12A
+type nfoRating struct {
+	MPAA          string `xml:"mpaa"`
+	Certification string `xml:"certification"`
+}
+
+// readRating finds the content rating for the video at path in its .nfo,
+// falling back to the show's tvshow.nfo for episodes, "" if neither has one
+func readRating(path string) (string, error) {
+	candidates := []string{findNFO(path), filepath.Join(showFolder(path), "tvshow.nfo")}
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		data, err := os.ReadFile(candidate)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		var parsed nfoRating
+		if err := xml.Unmarshal(data, &parsed); err != nil {
+			return "", fmt.Errorf("Failed to parse %q: %w", candidate, err)
+		}
+		for _, rating := range []string{parsed.MPAA, parsed.Certification} {
+			if rating = parseRating(rating); rating != "" {
+				return rating, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// parseRating takes the first rating from an .nfo's mpaa or certification, dropping the country and any Rated prefix
+func parseRating(rating string) string {
+	if first, _, ok := cut(rating, "/"); ok {
+		rating = first
+	}
+	if _, after, ok := cut(rating, ":"); ok {
+		rating = after
+	}
+	rating = strings.TrimSpace(rating)
+	if strings.HasPrefix(strings.ToLower(rating), "rated ") {
+		rating = strings.TrimSpace(rating[len("rated "):])
+	}
+	return rating
+}
+
+// checkRating compares the rating of the video at rel, relative to the scanned directory, with the first limit
+// for a folder it's in
+// Returns ok if it's within the limit, the problem if it's over or unrated, or "" if it isn't in a restricted folder
+func checkRating(rel, rating string, limits []RatingLimit) string {
+	for _, limit := range limits {
+		if !underFolder(rel, limit.Folder) {
+			continue
+		}
+		if rating == "" || containsFold(unratedNames, rating) {
+			return "unrated"
+		}
+		age, ok := ratingAge(rating)
+		switch {
+		case !ok:
+			return fmt.Sprintf("unknown rating %s", rating)
+		case age > limit.age:
+			return fmt.Sprintf("rated %s, over %s for %s", rating, limit.Rating, limit.Folder)
+		}
+		return "ok"
+	}
+	return ""
+}
+
+// underFolder reports whether rel, a slash separated path relative to the scanned directory, is in folder
+func underFolder(rel, folder string) bool {
+	return rel == folder || strings.HasPrefix(rel, folder+"/")
+}
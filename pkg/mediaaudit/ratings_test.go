@@ -0,0 +1,83 @@
+package mediaaudit
+
+import "testing"
+
+func TestRatingAge(t *testing.T) {
+	tests := []struct {
+		rating string
+		age    int
+		ok     bool
+	}{
+		{"G", 0, true},
+		{"pg-13", 13, true},
+		{" TV-MA ", 17, true},
+		{"12A", 12, true},
+		{"MA15+", 15, true},
+		{"FSK 16", 16, true},
+		{"15", 15, true},
+		{"18+", 18, true},
+		{"Not Rated", 0, false},
+		{"-1", -1, false},
+	}
+	for _, test := range tests {
+		age, ok := ratingAge(test.rating)
+		if ok != test.ok || (ok && age != test.age) {
+			t.Errorf("ratingAge(%q) = %d, %t, want %d, %t", test.rating, age, ok, test.age, test.ok)
+		}
+	}
+}
+
+func TestParseRating(t *testing.T) {
+	tests := []struct {
+		rating string
+		want   string
+	}{
+		{"PG-13", "PG-13"},
+		{"Rated PG-13", "PG-13"},
+		{"US:PG-13", "PG-13"},
+		{"US:Rated R / GB:18", "R"},
+		{" GB:12A / US:PG-13 ", "12A"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := parseRating(test.rating); got != test.want {
+			t.Errorf("parseRating(%q) = %q, want %q", test.rating, got, test.want)
+		}
+	}
+}
+
+func TestCheckRating(t *testing.T) {
+	limits, err := ParseRatingLimits("Kids=PG, /Teens/=PG-13")
+	if err != nil {
+		t.Fatalf("ParseRatingLimits() error = %v", err)
+	}
+	tests := []struct {
+		name   string
+		rel    string
+		rating string
+		want   string
+	}{
+		{"within the limit", "Kids/Movie (2010)/Movie (2010).mkv", "G", "ok"},
+		{"at the limit", "Kids/Movie (2010).mkv", "PG", "ok"},
+		{"over the limit", "Kids/Movie (2010).mkv", "PG-13", "rated PG-13, over PG for Kids"},
+		{"another country's rating", "Teens/Movie (2010).mkv", "15", "rated 15, over PG-13 for Teens"},
+		{"unrated", "Kids/Movie (2010).mkv", "", "unrated"},
+		{"rated Not Rated", "Kids/Movie (2010).mkv", "Not Rated", "unrated"},
+		{"unknown rating", "Teens/Movie (2010).mkv", "XYZ", "unknown rating XYZ"},
+		{"not restricted", "Movies/Movie (2010).mkv", "R", ""},
+		{"only a prefix of a restricted folder", "Kidsville/Movie (2010).mkv", "R", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := checkRating(test.rel, test.rating, limits); got != test.want {
+				t.Errorf("checkRating(%q, %q) = %q, want %q", test.rel, test.rating, got, test.want)
+			}
+		})
+	}
+
+	for _, value := range []string{"Kids", "=PG", "Kids=PG-21"} {
+		if _, err := ParseRatingLimits(value); err == nil {
+			t.Errorf("ParseRatingLimits(%q) succeeded", value)
+		}
+	}
+}
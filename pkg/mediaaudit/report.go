@@ -0,0 +1,274 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportHeaders names each column of Report.ToSlice, in order
+var ReportHeaders []string = []string{"ID", "Name", "Container", "ExtensionMismatch", "Codec", "SizeMB", "BitrateType", "BitrateMbps", "Width", "Height", "ScanType", "BitDepth", "ColorPrimaries", "TransferCharacteristics", "ChromaSubsampling", "AudioLanguages", "MissingAudioLanguages", "UntaggedAudioTracks", "SubtitleLanguages", "MissingSubtitleLanguages", "Chapters", "Structure", "DurationSeconds", "Decode", "DecodeSegments", "QualityMetric", "QualityScore", "NFO", "Naming", "Hardlinks", "Title", "Part", "DisplayAspectRatio", "PixelAspectRatio", "Anamorphic", "AspectRatio", "Licensing", "Project", "Class", "FrameRate", "AudioChannels", "Spec", "Package", "CodecProfile", "CommercialName", "StartTimecode", "ReelName", "Camera", "Captions", "MissingCaptions", "CommercialPercent", "Modified", "ContentRating", "Parental", "SpatialInfo", "TemporalInfo", "GrainLevel", "BlackPercent", "FrozenPercent", "CorruptPercent", "Frames", "AudioDropouts", "TrailingMB", "HDR"}
+
+// containerExtensions maps the container format reported by mediainfo to the
+// file extensions we expect to see for it
+var containerExtensions map[string][]string = map[string][]string{
+	"Matroska":      {".mkv"},
+	"WebM":          {".webm"},
+	"MPEG-4":        {".mp4", ".m4v", ".mov"}, // mediainfo reports QuickTime files as MPEG-4
+	"AVI":           {".avi"},
+	"QuickTime":     {".mov"},
+	"MPEG-TS":       {".ts", ".mts", ".m2t", ".tp", ".mpg"}, // DVRs like the HDHomeRun write transport streams as .mpg
+	"BDAV":          {".m2ts", ".mts"},
+	"Windows Media": {".wmv", ".asf"},
+	"Flash Video":   {".flv"},
+	"MPEG-PS":       {".mpg", ".mpeg", ".vob"},
+	"MXF":           {".mxf"},
+}
+
+// Report holds everything we know about a single video file
+type Report struct {
+	ID                string // Stable across scans, see fileID
+	Path              string // As found during the walk
+	Name              string // Path formatted for output, see Scanner.PathStyle
+	Container         string
+	ExtensionMismatch bool
+	Codec             string
+	SizeMB            float64
+	BitrateType       string
+	BitrateMbps       float64
+	Width             int
+	Height            int
+	ScanType          string
+
+	BitDepth                int
+	ColorPrimaries          string
+	TransferCharacteristics string
+	ChromaSubsampling       string
+	HDR                     string // HDR10, HLG or Dolby Vision, empty for SDR, see hdrFormat
+
+	AudioLanguages        []string // One entry per audio track, und if the track isn't tagged
+	MissingAudioLanguages []string
+	UntaggedAudioTracks   int
+
+	SubtitleLanguages        []string // Embedded and sidecar subtitles combined
+	MissingSubtitleLanguages []string
+
+	Chapters int
+
+	Structure string // Problems found walking the container, ok if none, empty if not checked
+
+	DurationSeconds float64
+	Decode          string // Errors found decoding the file, ok if none, empty if not checked
+	DecodeSegments  string // Which parts of the file were decoded, e.g. 0-10,655-665,1310-1320
+
+	QualityMetric string // vmaf or ssim, empty if the file has no reference
+	QualityScore  string // Compared to the reference, empty if not measured
+
+	NFO    string // Differences from the stream details in the Kodi .nfo, ok if none, empty if not checked
+	Naming string // Problems with the file and folder names for Plex/Jellyfin, ok if none, empty if not checked
+
+	Hardlinks int // How many names the file has, anywhere on its filesystem, 1 if it isn't hardlinked, 0 if unknown
+
+	Title string // For one part of a multi-part release, e.g. Movie (2010) for Movie (2010) - cd1.avi
+	Part  string // Which part it is, or which parts were combined by a PartGrouper, e.g. 1+2
+
+	DisplayAspectRatio float64 // Width over height as it should be shown, e.g. 1.778 for 16:9
+	PixelAspectRatio   float64 // Width over height of each stored pixel, 1 unless the file is anamorphic
+	Anamorphic         bool    // Stored with non-square pixels, to be stretched to DisplayAspectRatio on playback
+	AspectRatio        string  // Problems with the aspect ratio, ok if none, empty if not checked
+
+	Licensing string // The video codec's licensing family, see CodecLicensing
+
+	Project string // The folder directly under the scanned directory, with Scanner.Production
+	Class   string // Whether the file looks like a camera original, proxy or deliverable, with Scanner.Production
+
+	FrameRate     float64 // Frames per second, 0 if variable or unknown
+	AudioChannels []int   // How many channels each audio track has, in the same order as AudioLanguages
+	Spec          string  // Where the file falls short of Scanner.Spec, ok if nowhere, empty if not checked
+
+	Package string // Problems with an IMF or DCP package, ok if none, empty if the report isn't for a package
+
+	CodecProfile   string // e.g. 422 HQ for ProRes, or 4:2:2@High for the MPEG-2 in XDCAM HD422
+	CommercialName string // What the codec is sold as, if it's a variant of Codec, e.g. XDCAM HD422, DNxHR HQX or AVC-Intra 100
+
+	StartTimecode string // Timecode of the first frame, e.g. 01:00:00:00
+	ReelName      string // The reel or card the footage came from, as written by the camera or editor
+	Camera        string // The maker and model of the camera, e.g. Sony ILME-FX6
+
+	Captions        []string // Formats of the closed captions embedded in the video, e.g. EIA-608
+	MissingCaptions bool     // Captions are required, but there aren't any
+
+	CommercialPercent string // Estimated share of a recording that's commercials, empty if not estimated
+
+	Modified time.Time // When the file, or for a package anything in it, was last modified
+
+	ContentRating string // e.g. PG-13, from the .nfo, with Scanner.RatingLimits
+	Parental      string // Whether ContentRating is within the limit for its restricted folder, ok if so, empty if not in one
+
+	SpatialInfo  float64 // Average detail in each frame, from ffmpeg's siti filter, 0 if not measured
+	TemporalInfo float64 // Average change between frames, from ffmpeg's siti filter
+	GrainLevel   string  // How much grain or noise the picture has, see estimateGrain, empty if not estimated
+
+	BlackPercent   string // Share of the sampled frames that are black, empty if not sampled
+	FrozenPercent  string // Share of the sampled frames that repeat the one before
+	CorruptPercent string // Share of the sampled frames that failed to decode, at most
+	Frames         string // Whether too many sampled frames are black, frozen or corrupt to watch, ok if not, empty if not checked
+
+	AudioDropouts string // Stretches where the audio goes silent but the picture carries on, ok if none, empty if not checked
+
+	TrailingMB    string // Padding or junk after the container's logical end, that truncating would reclaim, empty if not checked
+	TrailingBytes int64  // The same, exactly, for truncating it
+
+	Extra map[string]string // Values for extra columns, e.g. from an Extension
+}
+
+// Row formats the report as a row matching ReportHeaders followed by extraColumns
+func (r *Report) Row(extraColumns []string) []string {
+	row := r.ToSlice()
+	for _, column := range extraColumns {
+		row = append(row, r.Extra[column])
+	}
+	return row
+}
+
+// Violations lists the columns where this report failed a check, in ReportHeaders order
+// Checks that weren't run don't count
+func (r *Report) Violations() []string {
+	var violations []string
+	if r.ExtensionMismatch {
+		violations = append(violations, "ExtensionMismatch")
+	}
+	if len(r.MissingAudioLanguages) > 0 {
+		violations = append(violations, "MissingAudioLanguages")
+	}
+	if len(r.MissingSubtitleLanguages) > 0 {
+		violations = append(violations, "MissingSubtitleLanguages")
+	}
+	if r.MissingCaptions {
+		violations = append(violations, "MissingCaptions")
+	}
+	for _, check := range []struct{ column, result string }{
+		{"Structure", r.Structure},
+		{"Decode", r.Decode},
+		{"NFO", r.NFO},
+		{"Naming", r.Naming},
+		{"AspectRatio", r.AspectRatio},
+		{"Spec", r.Spec},
+		{"Package", r.Package},
+		{"Parental", r.Parental},
+		{"Frames", r.Frames},
+		{"AudioDropouts", r.AudioDropouts},
+	} {
+		if check.result != "" && check.result != "ok" {
+			violations = append(violations, check.column)
+		}
+	}
+	return violations
+}
+
+// ToSlice formats the report as a row matching ReportHeaders
+func (r *Report) ToSlice() []string {
+	return []string{
+		r.ID,
+		r.Name,
+		r.Container,
+		strconv.FormatBool(r.ExtensionMismatch),
+		r.Codec,
+		fmt.Sprintf("%.2f", r.SizeMB),
+		r.BitrateType,
+		fmt.Sprintf("%.3f", r.BitrateMbps),
+		fmt.Sprintf("%d", r.Width),
+		fmt.Sprintf("%d", r.Height),
+		r.ScanType,
+		fmt.Sprintf("%d", r.BitDepth),
+		r.ColorPrimaries,
+		r.TransferCharacteristics,
+		r.ChromaSubsampling,
+		strings.Join(r.AudioLanguages, " "),
+		strings.Join(r.MissingAudioLanguages, " "),
+		fmt.Sprintf("%d", r.UntaggedAudioTracks),
+		strings.Join(r.SubtitleLanguages, " "),
+		strings.Join(r.MissingSubtitleLanguages, " "),
+		fmt.Sprintf("%d", r.Chapters),
+		r.Structure,
+		fmt.Sprintf("%.3f", r.DurationSeconds),
+		r.Decode,
+		r.DecodeSegments,
+		r.QualityMetric,
+		r.QualityScore,
+		r.NFO,
+		r.Naming,
+		fmt.Sprintf("%d", r.Hardlinks),
+		r.Title,
+		r.Part,
+		fmt.Sprintf("%.3f", r.DisplayAspectRatio),
+		fmt.Sprintf("%.3f", r.PixelAspectRatio),
+		strconv.FormatBool(r.Anamorphic),
+		r.AspectRatio,
+		r.Licensing,
+		r.Project,
+		r.Class,
+		fmt.Sprintf("%.3f", r.FrameRate),
+		joinInts(r.AudioChannels, " "),
+		r.Spec,
+		r.Package,
+		r.CodecProfile,
+		r.CommercialName,
+		r.StartTimecode,
+		r.ReelName,
+		r.Camera,
+		strings.Join(r.Captions, " "),
+		strconv.FormatBool(r.MissingCaptions),
+		r.CommercialPercent,
+		r.Modified.Format(time.RFC3339),
+		r.ContentRating,
+		r.Parental,
+		formatComplexity(r.SpatialInfo, r.SpatialInfo),
+		formatComplexity(r.SpatialInfo, r.TemporalInfo),
+		r.GrainLevel,
+		r.BlackPercent,
+		r.FrozenPercent,
+		r.CorruptPercent,
+		r.Frames,
+		r.AudioDropouts,
+		r.TrailingMB,
+		r.HDR,
+	}
+}
+
+// formatComplexity formats a complexity measurement, empty if spatial is 0 because it wasn't measured
+func formatComplexity(spatial, value float64) string {
+	if spatial == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", value)
+}
+
+// extensionMismatch reports whether the extension of path disagrees with the
+// container mediainfo actually found in the file
+// Containers we don't know about are never flagged
+func extensionMismatch(path, container string) bool {
+	extensions, ok := containerExtensions[container]
+	if !ok {
+		return false
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range extensions {
+		if ext == e {
+			return false
+		}
+	}
+	return true
+}
+
+// joinInts formats each of values and joins them with sep
+func joinInts(values []int, sep string) string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = strconv.Itoa(value)
+	}
+	return strings.Join(formatted, sep)
+}
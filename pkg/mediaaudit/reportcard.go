@@ -0,0 +1,292 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// reportCardActions is how many recommended actions the report card lists
+const reportCardActions = 5
+
+// grade turns a score out of 100 into a letter grade
+func grade(score float64) string {
+	switch {
+	case score >= 95:
+		return "A"
+	case score >= 85:
+		return "B"
+	case score >= 75:
+		return "C"
+	case score >= 60:
+		return "D"
+	}
+	return "F"
+}
+
+// reportCardAction is something to do to improve the library, and how many points of its category it would win back
+type reportCardAction struct {
+	text   string
+	points float64
+}
+
+// reportCardCategory is one line of the report card
+type reportCardCategory struct {
+	name    string
+	checked bool   // Whether the scan checked anything in this category
+	hint    string // How to check it, if it wasn't
+	score   float64
+	detail  string
+}
+
+// ReportCardWriter grades the library as a whole once the scan finishes, for integrity, policy compliance,
+// naming, subtitle coverage and space wasted on duplicates, and lists the actions that would help most
+// Only categories the scanner was set up to check are graded, see NewReportCardWriter
+type ReportCardWriter struct {
+	out     io.Writer
+	scanner *Scanner
+	reports []*Report
+	seen    map[string]bool
+}
+
+// NewReportCardWriter returns a ReportCardWriter that prints to out, grading the checks scanner runs
+func NewReportCardWriter(out io.Writer, scanner *Scanner) *ReportCardWriter {
+	return &ReportCardWriter{out: out, scanner: scanner, seen: make(map[string]bool)}
+}
+
+func (w *ReportCardWriter) Write(report *Report) error {
+	// Hardlinks are the same file, so they're neither graded twice nor duplicates
+	if w.seen[report.ID] {
+		return nil
+	}
+	w.seen[report.ID] = true
+	w.reports = append(w.reports, report)
+	return nil
+}
+
+// countFiles counts the reports failing, and builds an action for them if there are any
+func (w *ReportCardWriter) countFiles(failing func(*Report) bool, action string) (int, []reportCardAction) {
+	count := 0
+	for _, report := range w.reports {
+		if failing(report) {
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	return count, []reportCardAction{{
+		text:   fmt.Sprintf(action, count, plural(count, "file", "files")),
+		points: percentOf(float64(count), float64(len(w.reports))),
+	}}
+}
+
+// Close prints the report card, an overall grade, a grade for each category and the top recommended actions
+func (w *ReportCardWriter) Close() error {
+	files := float64(len(w.reports))
+	var categories []reportCardCategory
+	var actions []reportCardAction
+
+	// Integrity
+	integrity := reportCardCategory{name: "Integrity", checked: (w.scanner.Verify != "" && w.scanner.Verify != VerifyNone) || w.scanner.CheckFrames || w.scanner.DetectDropouts || w.scanner.CheckTrailingData, hint: "run with -verify or -check-frames"}
+	failed := 0
+	for _, report := range w.reports {
+		if problem(report.Structure) || problem(report.Decode) || problem(report.Package) || problem(report.Frames) || problem(report.AudioDropouts) {
+			failed++
+		}
+		integrity.checked = integrity.checked || report.Package != ""
+	}
+	if integrity.checked {
+		integrity.score = 100 - percentOf(float64(failed), files)
+		integrity.detail = fmt.Sprintf("%d %s with problems", failed, plural(failed, "file", "files"))
+		for _, check := range []struct {
+			failing func(*Report) bool
+			action  string
+		}{
+			{func(r *Report) bool { return problem(r.Decode) }, "Replace the %d %s that don't decode cleanly (Decode)"},
+			{func(r *Report) bool { return problem(r.Structure) && !problem(r.Decode) }, "Remux the %d %s with a damaged container (Structure)"},
+			{func(r *Report) bool { return problem(r.Package) }, "Complete the %d IMF or DCP %s with missing or wrong-sized assets (Package)"},
+			{func(r *Report) bool { return problem(r.Frames) }, "Replace the %d %s too black, frozen or corrupt to watch (Frames)"},
+			{func(r *Report) bool { return problem(r.AudioDropouts) }, "Remux or replace the %d %s with audio dropouts (AudioDropouts)"},
+		} {
+			_, found := w.countFiles(check.failing, check.action)
+			actions = append(actions, found...)
+		}
+	}
+	categories = append(categories, integrity)
+
+	// Policy compliance covers whichever requirements were set
+	s := w.scanner
+	policy := reportCardCategory{
+		name:    "Policy compliance",
+		checked: len(s.RequiredAudioLanguages) > 0 || len(s.RequiredSubtitleLanguages) > 0 || s.RequireCaptions || s.Spec != nil || len(s.RatingLimits) > 0 || s.CheckAspectRatio || len(s.AspectRatios) > 0,
+		hint:    "set -audio-languages, -subtitle-languages, -spec-file or -max-rating",
+	}
+	if policy.checked {
+		failed = 0
+		for _, report := range w.reports {
+			if len(report.MissingAudioLanguages) > 0 || len(report.MissingSubtitleLanguages) > 0 || report.MissingCaptions ||
+				problem(report.Spec) || problem(report.Parental) || problem(report.AspectRatio) {
+				failed++
+			}
+		}
+		policy.score = 100 - percentOf(float64(failed), files)
+		policy.detail = fmt.Sprintf("%d %s out of policy", failed, plural(failed, "file", "files"))
+		for _, language := range s.RequiredAudioLanguages {
+			language := language
+			_, found := w.countFiles(func(r *Report) bool { return containsFold(r.MissingAudioLanguages, language) }, "Add "+language+" audio to %d %s")
+			actions = append(actions, found...)
+		}
+		for _, language := range s.RequiredSubtitleLanguages {
+			language := language
+			_, found := w.countFiles(func(r *Report) bool { return containsFold(r.MissingSubtitleLanguages, language) }, "Add "+language+" subtitles to %d %s")
+			actions = append(actions, found...)
+		}
+		for _, check := range []struct {
+			failing func(*Report) bool
+			action  string
+		}{
+			{func(r *Report) bool { return r.MissingCaptions }, "Add closed captions to %d %s"},
+			{func(r *Report) bool { return problem(r.Spec) }, "Re-encode the %d %s out of spec (Spec)"},
+			{func(r *Report) bool { return problem(r.Parental) }, "Move or rate the %d %s over the limit for their restricted folder (Parental)"},
+			{func(r *Report) bool { return problem(r.AspectRatio) }, "Fix the aspect ratio of %d %s (AspectRatio)"},
+		} {
+			_, found := w.countFiles(check.failing, check.action)
+			actions = append(actions, found...)
+		}
+	}
+	categories = append(categories, policy)
+
+	// Naming conformance always covers extensions, which every scan checks
+	naming := reportCardCategory{name: "Naming conformance", checked: true}
+	failed = 0
+	for _, report := range w.reports {
+		if report.ExtensionMismatch || problem(report.Naming) || problem(report.NFO) {
+			failed++
+		}
+	}
+	naming.score = 100 - percentOf(float64(failed), files)
+	naming.detail = fmt.Sprintf("%d misnamed %s", failed, plural(failed, "file", "files"))
+	if !s.CheckNaming {
+		naming.detail += ", only extensions checked"
+	}
+	for _, check := range []struct {
+		failing func(*Report) bool
+		action  string
+	}{
+		{func(r *Report) bool { return problem(r.Naming) }, "Rename %d %s to the Plex/Jellyfin conventions (Naming)"},
+		{func(r *Report) bool { return r.ExtensionMismatch }, "Fix the extension of %d %s (ExtensionMismatch)"},
+		{func(r *Report) bool { return problem(r.NFO) }, "Refresh the .nfo of %d %s (NFO)"},
+	} {
+		_, found := w.countFiles(check.failing, check.action)
+		actions = append(actions, found...)
+	}
+	categories = append(categories, naming)
+
+	// Subtitle coverage counts files with any subtitles at all, embedded or sidecar
+	unsubtitled, found := w.countFiles(func(r *Report) bool { return len(r.SubtitleLanguages) == 0 }, "Add subtitles to the %d %s without any")
+	subtitles := reportCardCategory{name: "Subtitle coverage", checked: true, score: 100 - percentOf(float64(unsubtitled), files)}
+	subtitles.detail = fmt.Sprintf("%d %s without subtitles", unsubtitled, plural(unsubtitled, "file", "files"))
+	actions = append(actions, found...)
+	categories = append(categories, subtitles)
+
+	// Duplicate waste is the space taken by every copy of a movie or episode but the largest
+	sizeMB, wasteMB, copies := 0.0, 0.0, 0
+	largest := make(map[string]*Report)
+	for _, report := range w.reports {
+		sizeMB += report.SizeMB
+		key := duplicateKey(report)
+		if key == "" {
+			continue
+		}
+		if kept, ok := largest[key]; ok {
+			copies++
+			if report.SizeMB > kept.SizeMB {
+				report, largest[key] = kept, report
+			}
+			wasteMB += report.SizeMB
+			continue
+		}
+		largest[key] = report
+	}
+	duplicates := reportCardCategory{name: "Duplicate waste", checked: true, score: 100 - percentOf(wasteMB, sizeMB)}
+	duplicates.detail = fmt.Sprintf("%.2f GiB in %d extra %s", wasteMB/1024, copies, plural(copies, "copy", "copies"))
+	if copies > 0 {
+		actions = append(actions, reportCardAction{
+			text:   fmt.Sprintf("Delete %d duplicate %s to free %.2f GiB", copies, plural(copies, "copy", "copies"), wasteMB/1024),
+			points: 100 - duplicates.score,
+		})
+	}
+	categories = append(categories, duplicates)
+
+	// The overall grade is the average of the categories that were checked
+	total, graded := 0.0, 0
+	for _, category := range categories {
+		if category.checked {
+			total += category.score
+			graded++
+		}
+	}
+	overall := "-"
+	if graded > 0 && len(w.reports) > 0 {
+		overall = grade(total / float64(graded))
+	}
+
+	fmt.Fprintf(w.out, "Library report card for %d files, %.2f GiB: %s\n", len(w.reports), sizeMB/1024, overall)
+	table := tabwriter.NewWriter(w.out, 0, 8, 2, ' ', 0)
+	for _, category := range categories {
+		if !category.checked {
+			fmt.Fprintf(table, "  %s\t-\t\tnot checked, %s\n", category.name, category.hint)
+			continue
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%.1f%%\t%s\n", category.name, grade(category.score), category.score, category.detail)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	// The actions that win back the most points come first
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].points > actions[j].points
+	})
+	if len(actions) > reportCardActions {
+		actions = actions[:reportCardActions]
+	}
+	if len(actions) > 0 {
+		fmt.Fprintln(w.out, "Top actions:")
+	}
+	for i, action := range actions {
+		fmt.Fprintf(w.out, "  %d. %s\n", i+1, action.text)
+	}
+	return nil
+}
+
+// problem reports whether a check column found a problem, rather than being ok or not checked
+func problem(result string) bool {
+	return result != "" && result != "ok"
+}
+
+// plural picks the singular or plural of a word for count
+func plural(count int, singular, plural string) string {
+	if count == 1 {
+		return singular
+	}
+	return plural
+}
+
+// duplicateKey identifies the movie or episode a file is a copy of, the show and episode number for an episode,
+// or the title and year for a movie, "" if it's neither
+// Parts of a multi-part release aren't copies of each other, so the part is part of the key
+func duplicateKey(report *Report) string {
+	name := strings.TrimSuffix(filepath.Base(report.Path), filepath.Ext(report.Path))
+	if match := episodeRegex.FindStringSubmatch(name); match != nil {
+		return strings.ToLower(filepath.Base(showFolder(report.Path))) + "/" + strings.ToLower(match[0]) + "/" + report.Part
+	}
+	if match := movieYearRegex.FindStringSubmatch(name); match != nil {
+		return strings.ToLower(match[1]) + "/" + match[2] + "/" + report.Part
+	}
+	return ""
+}
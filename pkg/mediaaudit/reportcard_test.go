@@ -0,0 +1,86 @@
+package mediaaudit
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGrade(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  string
+	}{
+		{100, "A"},
+		{95, "A"},
+		{94.9, "B"},
+		{85, "B"},
+		{75, "C"},
+		{60, "D"},
+		{59.9, "F"},
+		{0, "F"},
+	}
+	for _, test := range tests {
+		if got := grade(test.score); got != test.want {
+			t.Errorf("grade(%g) = %q, want %q", test.score, got, test.want)
+		}
+	}
+}
+
+func TestDuplicateKey(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		part string
+		want string
+	}{
+		{"episode", "/media/TV/Show/Season 01/Show - S01E02 - Title.mkv", "", "show/s01e02/"},
+		{"episode in another format", "/media/TV/show/Season 1/Show.S01E02.1080p.mp4", "", "show/s01e02/"},
+		{"movie", "/media/Movies/Movie (2010)/Movie (2010).mkv", "", "movie/2010/"},
+		{"movie in another edition", "/media/Movies/Movie (2010)/movie (2010) - 4K.mkv", "", "movie/2010/"},
+		{"part of a movie", "/media/Movies/Movie (2010)/Movie (2010) - cd2.avi", "2", "movie/2010/2"},
+		{"neither", "/media/Home Videos/Birthday.mkv", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := &Report{Path: filepath.FromSlash(test.path), Part: test.part}
+			if got := duplicateKey(report); got != test.want {
+				t.Errorf("duplicateKey(%q) = %q, want %q", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestReportCardWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := NewReportCardWriter(&out, &Scanner{})
+	for _, report := range []*Report{
+		{ID: "1", Path: filepath.FromSlash("/media/Movies/Movie (2010)/Movie (2010).mkv"), SizeMB: 3072, SubtitleLanguages: []string{"eng"}},
+		{ID: "2", Path: filepath.FromSlash("/media/Movies/Movie (2010)/Movie (2010) - 720p.mkv"), SizeMB: 1024, SubtitleLanguages: []string{"eng"}},
+		{ID: "2", Path: filepath.FromSlash("/media/Movies/Movie (2010)/Movie (2010) - link.mkv"), SizeMB: 1024, SubtitleLanguages: []string{"eng"}},
+		{ID: "3", Path: filepath.FromSlash("/media/TV/Show/Season 01/Show - S01E01.mkv"), SizeMB: 2048},
+		{ID: "4", Path: filepath.FromSlash("/media/TV/Show/Season 01/Show - S01E02.avi"), SizeMB: 2048, ExtensionMismatch: true, SubtitleLanguages: []string{"eng"}},
+	} {
+		if err := w.Write(report); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hardlink isn't counted, and the 720p copy is the waste
+	for _, want := range []string{
+		"Library report card for 4 files, 8.00 GiB: C\n",
+		"  Policy compliance   -         not checked, ",
+		"  Naming conformance  C  75.0%  1 misnamed file, only extensions checked\n",
+		"  Subtitle coverage   C  75.0%  1 file without subtitles\n",
+		"  Duplicate waste     B  87.5%  1.00 GiB in 1 extra copy\n",
+		"Top actions:\n  1. Fix the extension of 1 file (ExtensionMismatch)\n  2. Add subtitles to the 1 file without any\n  3. Delete 1 duplicate copy to free 1.00 GiB\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Report card is missing %q:\n%s", want, out.String())
+		}
+	}
+}
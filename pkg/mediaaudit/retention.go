@@ -0,0 +1,312 @@
+package mediaaudit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// RetentionRule says how long recordings are kept, by age, by how many episodes of each show, or both
+// A recording that breaks either limit is deleted
+type RetentionRule struct {
+	Name         string
+	Folders      []string       // Only recordings under these folders, relative to the scanned directory, e.g. News
+	Show         *regexp.Regexp // Only recordings of shows whose folder name matches
+	MaxAge       time.Duration  // Delete recordings modified longer ago than this, 0 to keep them however old
+	KeepEpisodes int            // Keep only this many of the newest episodes of each show, 0 to keep them all
+}
+
+// matches reports whether the rule covers the recording at rel, relative to the scanned directory, of show
+func (r *RetentionRule) matches(rel, show string) bool {
+	if len(r.Folders) > 0 {
+		found := false
+		for _, folder := range r.Folders {
+			found = found || underFolder(rel, folder)
+		}
+		if !found {
+			return false
+		}
+	}
+	return r.Show == nil || r.Show.MatchString(filepath.Base(show))
+}
+
+// LoadRetentionRules reads a file of retention rules
+// Each rule starts with its name in brackets, e.g. [news], followed by `key = value` lines:
+// folder takes a comma separated list of folders, show a regular expression,
+// max-age an age like 7d, 2w or 36h, and keep-episodes a count
+// Blank lines and lines starting with # are ignored
+// Each recording is covered by the first rule it matches, if any, and recordings no rule matches are kept
+func LoadRetentionRules(path string) ([]*RetentionRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []*RetentionRule
+	var rule *RetentionRule
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			rule = &RetentionRule{Name: strings.TrimSpace(line[1 : len(line)-1])}
+			rules = append(rules, rule)
+			continue
+		}
+		if rule == nil {
+			return nil, fmt.Errorf("%s:%d: expected a [rule-name] before any settings", path, lineNumber)
+		}
+
+		key, value, ok := cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, lineNumber)
+		}
+		if err := rule.set(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%s has no retention rules", path)
+	}
+	for _, rule := range rules {
+		if rule.MaxAge == 0 && rule.KeepEpisodes == 0 {
+			return nil, fmt.Errorf("%s: rule %q needs a max-age or keep-episodes", path, rule.Name)
+		}
+	}
+	return rules, nil
+}
+
+// set parses the value of one of the rule's settings
+func (r *RetentionRule) set(key, value string) error {
+	switch key {
+	case "folder":
+		for _, folder := range strings.Split(value, ",") {
+			if folder = strings.Trim(filepath.ToSlash(strings.TrimSpace(folder)), "/"); folder != "" {
+				r.Folders = append(r.Folders, folder)
+			}
+		}
+	case "show":
+		show, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("Invalid show pattern %q: %w", value, err)
+		}
+		r.Show = show
+	case "max-age":
+		age, err := parseAge(value)
+		if err != nil || age <= 0 {
+			return fmt.Errorf("Invalid max-age %q, expected something like 7d, 2w or 36h", value)
+		}
+		r.MaxAge = age
+	case "keep-episodes":
+		count, err := strconv.Atoi(value)
+		if err != nil || count <= 0 {
+			return fmt.Errorf("Invalid keep-episodes %q, expected a count", value)
+		}
+		r.KeepEpisodes = count
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
+
+// parseAge parses an age in days, e.g. 7d, or weeks, e.g. 2w, or anything time.ParseDuration takes
+func parseAge(value string) (time.Duration, error) {
+	unit := 24 * time.Hour
+	switch {
+	case strings.HasSuffix(value, "w"):
+		unit *= 7
+	case !strings.HasSuffix(value, "d"):
+		return time.ParseDuration(value)
+	}
+	count, err := strconv.ParseFloat(value[:len(value)-1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(count * float64(unit)), nil
+}
+
+// formatAge writes an age in days once it's at least a day
+func formatAge(age time.Duration) string {
+	if age >= 24*time.Hour {
+		return fmt.Sprintf("%dd", int(age/(24*time.Hour)))
+	}
+	return age.Round(time.Minute).String()
+}
+
+// showFolder is the folder holding every recording of the show the recording at path belongs to,
+// skipping over a Season folder
+func showFolder(path string) string {
+	dir := filepath.Dir(path)
+	if seasonFolderRegex.MatchString(filepath.Base(dir)) {
+		return filepath.Dir(dir)
+	}
+	return dir
+}
+
+// Deletion is a recording a retention rule says to delete, and why
+type Deletion struct {
+	Path   string
+	Name   string // As in the report
+	SizeMB float64
+	Rule   string
+	Reason string
+}
+
+// RetentionWriter collects reports so the retention rules can be applied once the scan finishes
+// The plan is only right for a complete scan, keep-episodes can't count episodes it hasn't seen
+type RetentionWriter struct {
+	root    string
+	rules   []*RetentionRule
+	reports []*Report
+	seen    map[string]bool
+}
+
+// NewRetentionWriter returns a RetentionWriter applying rules to the recordings found under root
+func NewRetentionWriter(root string, rules []*RetentionRule) *RetentionWriter {
+	return &RetentionWriter{root: root, rules: rules, seen: make(map[string]bool)}
+}
+
+func (w *RetentionWriter) Write(report *Report) error {
+	// A package is a folder, not a recording, and hardlinks only need deleting once
+	if report.Package != "" || w.seen[report.ID] {
+		return nil
+	}
+	w.seen[report.ID] = true
+	w.reports = append(w.reports, report)
+	return nil
+}
+
+func (w *RetentionWriter) Close() error {
+	return nil
+}
+
+// retained is a recording counted towards a show's keep-episodes
+type retained struct {
+	report  *Report
+	season  int
+	episode int
+	ok      bool // Whether season and episode were found in the name
+}
+
+// Plan lists the recordings the rules say to delete, as of now, by path
+func (w *RetentionWriter) Plan(now time.Time) []Deletion {
+	reasons := make(map[*Report][]string)
+	rules := make(map[*Report]*RetentionRule)
+	shows := make(map[*RetentionRule]map[string][]*retained)
+	for _, report := range w.reports {
+		rel, err := filepath.Rel(w.root, report.Path)
+		if err != nil {
+			continue
+		}
+		show := showFolder(report.Path)
+		var rule *RetentionRule
+		for _, r := range w.rules {
+			if r.matches(filepath.ToSlash(rel), show) {
+				rule = r
+				break
+			}
+		}
+		if rule == nil {
+			continue
+		}
+		rules[report] = rule
+
+		if age := now.Sub(report.Modified); rule.MaxAge > 0 && age > rule.MaxAge {
+			reasons[report] = append(reasons[report], fmt.Sprintf("%s old, over %s", formatAge(age), formatAge(rule.MaxAge)))
+		}
+		if rule.KeepEpisodes > 0 {
+			recording := &retained{report: report}
+			if match := episodeRegex.FindStringSubmatch(filepath.Base(report.Path)); match != nil {
+				recording.season, _ = strconv.Atoi(match[1])
+				recording.episode, _ = strconv.Atoi(match[2])
+				recording.ok = true
+			}
+			if shows[rule] == nil {
+				shows[rule] = make(map[string][]*retained)
+			}
+			shows[rule][show] = append(shows[rule][show], recording)
+		}
+	}
+
+	for rule, byShow := range shows {
+		for _, recordings := range byShow {
+			if len(recordings) <= rule.KeepEpisodes {
+				continue
+			}
+			sortNewestFirst(recordings)
+			for _, recording := range recordings[rule.KeepEpisodes:] {
+				reasons[recording.report] = append(reasons[recording.report], fmt.Sprintf("more than %d episodes", rule.KeepEpisodes))
+			}
+		}
+	}
+
+	var plan []Deletion
+	for _, report := range w.reports {
+		if len(reasons[report]) == 0 {
+			continue
+		}
+		plan = append(plan, Deletion{
+			Path:   report.Path,
+			Name:   report.Name,
+			SizeMB: report.SizeMB,
+			Rule:   rules[report].Name,
+			Reason: strings.Join(reasons[report], ", "),
+		})
+	}
+	sort.Slice(plan, func(i, j int) bool {
+		return plan[i].Path < plan[j].Path
+	})
+	return plan
+}
+
+// sortNewestFirst orders a show's recordings by season and episode if every one of them is numbered,
+// otherwise by when they were recorded
+// Daily shows are rarely numbered, and a repeat recorded today shouldn't push out last night's new episode
+func sortNewestFirst(recordings []*retained) {
+	numbered := true
+	for _, recording := range recordings {
+		numbered = numbered && recording.ok
+	}
+	sort.SliceStable(recordings, func(i, j int) bool {
+		a, b := recordings[i], recordings[j]
+		if numbered && (a.season != b.season || a.episode != b.episode) {
+			if a.season != b.season {
+				return a.season > b.season
+			}
+			return a.episode > b.episode
+		}
+		return a.report.Modified.After(b.report.Modified)
+	})
+}
+
+// WriteRetentionPlan prints what a plan deletes, and how much space that frees
+func WriteRetentionPlan(out io.Writer, plan []Deletion) error {
+	sizeMB := 0.0
+	for _, deletion := range plan {
+		sizeMB += deletion.SizeMB
+	}
+	fmt.Fprintf(out, "Retention plan deletes %d files, %.2f GiB:\n", len(plan), sizeMB/1024)
+	table := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, deletion := range plan {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", deletion.Rule, deletion.Name, deletion.Reason)
+	}
+	return table.Flush()
+}
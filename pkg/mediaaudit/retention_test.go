@@ -0,0 +1,219 @@
+package mediaaudit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLoadRetentionRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []RetentionRule // Show is compared by its pattern
+		shows   []string
+		wantErr bool
+	}{
+		{
+			name: "every setting",
+			content: "# Recordings\n\n[news]\nfolder = News, /Weather/ ,\nmax-age = 7d\n\n" +
+				"[dailies]\nshow = ^(The )?Daily\nkeep-episodes = 5\nmax-age = 2w\n",
+			want: []RetentionRule{
+				{Name: "news", Folders: []string{"News", "Weather"}, MaxAge: 7 * 24 * time.Hour},
+				{Name: "dailies", MaxAge: 14 * 24 * time.Hour, KeepEpisodes: 5},
+			},
+			shows: []string{"", "^(The )?Daily"},
+		},
+		{name: "no rules", content: "# Nothing yet\n", wantErr: true},
+		{name: "setting before a rule", content: "max-age = 7d\n[news]\n", wantErr: true},
+		{name: "neither limit", content: "[news]\nfolder = News\n", wantErr: true},
+		{name: "not key = value", content: "[news]\nmax-age 7d\n", wantErr: true},
+		{name: "unknown setting", content: "[news]\nmax-age = 7d\nkeep = 5\n", wantErr: true},
+		{name: "bad age", content: "[news]\nmax-age = a week\n", wantErr: true},
+		{name: "negative age", content: "[news]\nmax-age = -7d\n", wantErr: true},
+		{name: "bad count", content: "[news]\nkeep-episodes = 0\n", wantErr: true},
+		{name: "bad show pattern", content: "[news]\nshow = (\nmax-age = 7d\n", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "retention.conf")
+			if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			rules, err := LoadRetentionRules(path)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("LoadRetentionRules() succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadRetentionRules() error = %v", err)
+			}
+			if len(rules) != len(test.want) {
+				t.Fatalf("LoadRetentionRules() = %d rules, want %d", len(rules), len(test.want))
+			}
+			for i, rule := range rules {
+				show := ""
+				if rule.Show != nil {
+					show = rule.Show.String()
+				}
+				if show != test.shows[i] {
+					t.Errorf("Rule %d show = %q, want %q", i, show, test.shows[i])
+				}
+				got := *rule
+				got.Show = nil
+				if !reflect.DeepEqual(got, test.want[i]) {
+					t.Errorf("Rule %d = %+v, want %+v", i, got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "7d", want: 7 * 24 * time.Hour},
+		{value: "2w", want: 14 * 24 * time.Hour},
+		{value: "36h", want: 36 * time.Hour},
+		{value: "1.5d", want: 36 * time.Hour},
+		{value: "90m", want: 90 * time.Minute},
+		{value: "d", wantErr: true},
+		{value: "7", wantErr: true},
+		{value: "a week", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseAge(test.value)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("parseAge(%q) = %s, %v, want %s, error %t", test.value, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestRetentionPlan(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days float64) time.Time {
+		return now.Add(-time.Duration(days * float64(24*time.Hour)))
+	}
+	recording := func(path string, days float64) *Report {
+		return &Report{ID: path, Path: filepath.Join("/media", path), Name: filepath.Base(path), Modified: daysAgo(days)}
+	}
+	news := &RetentionRule{Name: "news", Folders: []string{"News"}, MaxAge: 7 * 24 * time.Hour}
+	dailies := &RetentionRule{Name: "dailies", Show: regexp.MustCompile(`^(The )?Daily`), KeepEpisodes: 2}
+	shows := &RetentionRule{Name: "shows", Folders: []string{"TV"}, KeepEpisodes: 2}
+
+	tests := []struct {
+		name    string
+		rules   []*RetentionRule
+		reports []*Report
+		want    []string // Path relative to /media, then the rule and reason
+	}{
+		{
+			name:    "max-age",
+			rules:   []*RetentionRule{news},
+			reports: []*Report{recording("News/Evening/a.ts", 3), recording("News/Evening/b.ts", 10), recording("News/c.ts", 7.5)},
+			want:    []string{"News/Evening/b.ts: news: 10d old, over 7d", "News/c.ts: news: 7d old, over 7d"},
+		},
+		{
+			name:    "folder must be a whole path component",
+			rules:   []*RetentionRule{news},
+			reports: []*Report{recording("Newsroom/a.ts", 30), recording("Movies/News (2010).mkv", 30)},
+		},
+		{
+			name: "first matching rule wins",
+			rules: []*RetentionRule{
+				{Name: "keep", Folders: []string{"News/Archive"}, KeepEpisodes: 100},
+				news,
+			},
+			reports: []*Report{recording("News/Archive/a.ts", 30), recording("News/b.ts", 30)},
+			want:    []string{"News/b.ts: news: 30d old, over 7d"},
+		},
+		{
+			name:  "unmatched recordings are kept",
+			rules: []*RetentionRule{dailies},
+			reports: []*Report{
+				recording("TV/Other Show/S01E01.ts", 30), recording("TV/Other Show/S01E02.ts", 20), recording("TV/Other Show/S01E03.ts", 10),
+			},
+		},
+		{
+			name:  "keep-episodes orders numbered shows by episode, not when they were recorded",
+			rules: []*RetentionRule{shows},
+			reports: []*Report{
+				recording("TV/Drama/Season 2/Drama S02E01.mkv", 1), // A rerun recorded most recently
+				recording("TV/Drama/Season 2/Drama S02E02.mkv", 5),
+				recording("TV/Drama/Season 1/Drama S01E09.mkv", 3),
+				recording("TV/Drama/Season 2/Drama S02E03.mkv", 4),
+			},
+			want: []string{
+				"TV/Drama/Season 1/Drama S01E09.mkv: shows: more than 2 episodes",
+				"TV/Drama/Season 2/Drama S02E01.mkv: shows: more than 2 episodes",
+			},
+		},
+		{
+			name:  "keep-episodes orders shows with unnumbered episodes by when they were recorded",
+			rules: []*RetentionRule{dailies},
+			reports: []*Report{
+				recording("TV/The Daily Show/2026-10-14.ts", 2),
+				recording("TV/The Daily Show/The Daily Show S30E01.ts", 3),
+				recording("TV/The Daily Show/2026-10-15.ts", 1),
+				recording("TV/Daily Planet/2026-10-15.ts", 1),
+			},
+			want: []string{"TV/The Daily Show/The Daily Show S30E01.ts: dailies: more than 2 episodes"},
+		},
+		{
+			name:  "both limits",
+			rules: []*RetentionRule{{Name: "both", Folders: []string{"News"}, MaxAge: 7 * 24 * time.Hour, KeepEpisodes: 1}},
+			reports: []*Report{
+				recording("News/Evening/a.ts", 1), recording("News/Evening/b.ts", 3), recording("News/Evening/c.ts", 8),
+			},
+			want: []string{
+				"News/Evening/b.ts: both: more than 1 episodes",
+				"News/Evening/c.ts: both: 8d old, over 7d, more than 1 episodes",
+			},
+		},
+		{
+			name:  "hardlinks are deleted once and count as one episode",
+			rules: []*RetentionRule{shows},
+			reports: []*Report{
+				recording("TV/Drama/Drama S01E01.mkv", 3),
+				{ID: "TV/Drama/Drama S01E01.mkv", Path: "/media/TV/Drama/Drama S01E01 (link).mkv", Modified: daysAgo(3)},
+				recording("TV/Drama/Drama S01E02.mkv", 2),
+				recording("TV/Drama/Drama S01E03.mkv", 1),
+			},
+			want: []string{"TV/Drama/Drama S01E01.mkv: shows: more than 2 episodes"},
+		},
+		{
+			name:  "packages are never planned",
+			rules: []*RetentionRule{news},
+			reports: []*Report{
+				{ID: "dvd", Path: "/media/News/Special/VIDEO_TS/VTS_01_1.VOB", Package: "DVD", Modified: daysAgo(30)},
+				{ID: "bluray", Path: "/media/News/Special Two/BDMV/STREAM/00000.m2ts", Package: "Blu-ray", Modified: daysAgo(30)},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := NewRetentionWriter("/media", test.rules)
+			for _, report := range test.reports {
+				if err := w.Write(report); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var got []string
+			for _, deletion := range w.Plan(now) {
+				rel, _ := filepath.Rel("/media", deletion.Path)
+				got = append(got, filepath.ToSlash(rel)+": "+deletion.Rule+": "+deletion.Reason)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Plan() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
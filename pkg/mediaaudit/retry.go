@@ -0,0 +1,84 @@
+package mediaaudit
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// maxFileWaits is how many times a probe waits for file descriptors to free up before giving up
+// With the backoff doubling that's several minutes, long enough for anything but a leak
+const maxFileWaits int = 8
+
+// DefaultRetryBackoff is how long to wait before the first retry when Scanner.RetryBackoff is unset
+const DefaultRetryBackoff time.Duration = time.Second
+
+// backoff is how long to wait before the given retry, counting from 1
+// It doubles every attempt, and jitter spreads retries out so a hiccup on a shared mount
+// doesn't have every worker hit it again at the same instant
+func backoff(base time.Duration, retry int) time.Duration {
+	ceiling := base << uint(retry-1)
+	if ceiling <= 0 || ceiling > time.Hour {
+		ceiling = time.Hour
+	}
+	return ceiling/2 + time.Duration(rand.Int63n(int64(ceiling/2)+1))
+}
+
+// probeOnce runs probe, cancelling it if it takes longer than s.ProbeTimeout
+func (s *Scanner) probeOnce(ctx context.Context, path string, probe func(ctx context.Context) error) error {
+	if s.ProbeTimeout <= 0 {
+		return probe(ctx)
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, s.ProbeTimeout)
+	defer cancel()
+	err := probe(probeCtx)
+	if err != nil && probeCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return fmt.Errorf("Probe of %q timed out after %s: %w", path, s.ProbeTimeout, context.DeadlineExceeded)
+	}
+	return err
+}
+
+// probeWithRetries runs probe, retrying failures, including timeouts, up to s.Retries times
+// Running out of file descriptors doesn't count, those probes wait for others to finish and try again
+// The error returned is the last attempt's
+func (s *Scanner) probeWithRetries(ctx context.Context, path string, probe func(ctx context.Context) error) error {
+	base := s.RetryBackoff
+	if base <= 0 {
+		base = DefaultRetryBackoff
+	}
+
+	err := s.probeOnce(ctx, path, probe)
+	for waits := 1; err != nil && outOfFiles(err) && waits <= maxFileWaits; waits++ {
+		delay := backoff(base, waits)
+		s.logf(LevelDebug, path, "Out of file descriptors probing %q, waiting %s", path, delay.Round(time.Millisecond))
+		if !sleep(ctx, delay) {
+			return err
+		}
+		err = s.probeOnce(ctx, path, probe)
+	}
+
+	for retry := 1; err != nil && retry <= s.Retries; retry++ {
+		delay := backoff(base, retry)
+		s.logf(LevelWarn, path, "Probe of %q failed, retrying in %s (%d of %d): %s", path, delay.Round(time.Millisecond), retry, s.Retries, err.Error())
+
+		if !sleep(ctx, delay) {
+			return err
+		}
+		err = s.probeOnce(ctx, path, probe)
+	}
+	return err
+}
+
+// sleep waits for delay, returning false if ctx is done first
+func sleep(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
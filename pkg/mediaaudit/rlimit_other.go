@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package mediaaudit
+
+// openFileLimit isn't known here
+func openFileLimit() (uint64, bool) {
+	return 0, false
+}
+
+// outOfFiles can't tell here, so every failure counts as the file's
+func outOfFiles(err error) bool {
+	return false
+}
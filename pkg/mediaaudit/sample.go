@@ -0,0 +1,217 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// DefaultSampleSeed is used when Sample.Seed is unset
+// Samples are reproducible, the same tree and seed always give the same sample
+const DefaultSampleSeed int64 = 1
+
+// z95 is the z-score for a 95% confidence interval
+const z95 float64 = 1.96
+
+// Sample probes a random subset of the files a scan would cover, and estimates statistics
+// for the whole tree from it
+// Set either Percent or Count, a Sample records what it sees so it can't be reused between scans
+type Sample struct {
+	Percent float64 // Share of files to probe, from 0 to 100
+	Count   int     // Exact number of files to probe, if Percent is unset
+	Seed    int64   // Picks which files are sampled, DefaultSampleSeed if unset
+
+	lock       sync.Mutex
+	population int // How many files the sample was drawn from
+	failed     int
+	reports    []*Report
+}
+
+// ParseSample parses either a percentage, e.g. 5%, or a number of files, e.g. 500
+func ParseSample(value string) (*Sample, error) {
+	value = strings.TrimSpace(value)
+	if percent := strings.TrimSuffix(value, "%"); percent != value {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("Invalid sample %q, expected a percentage above 0 and up to 100", value)
+		}
+		return &Sample{Percent: p}, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count <= 0 {
+		return nil, fmt.Errorf("Invalid sample %q, expected a percentage, e.g. 5%%, or a number of files", value)
+	}
+	return &Sample{Count: count}, nil
+}
+
+// choose picks the files to probe from every file found, keeping them in the order they were found
+func (s *Sample) choose(candidates []foundFile) []foundFile {
+	s.lock.Lock()
+	s.population = len(candidates)
+	s.lock.Unlock()
+
+	size := s.Count
+	if s.Percent > 0 {
+		size = int(math.Ceil(float64(len(candidates)) * s.Percent / 100))
+	}
+	if size >= len(candidates) {
+		return candidates
+	}
+
+	chosen := rand.New(rand.NewSource(s.seed())).Perm(len(candidates))[:size]
+	sort.Ints(chosen)
+	sampled := make([]foundFile, 0, size)
+	for _, i := range chosen {
+		sampled = append(sampled, candidates[i])
+	}
+	return sampled
+}
+
+// record adds a probed file to the sample
+func (s *Sample) record(report *Report) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reports = append(s.reports, report)
+}
+
+// recordFailure counts a sampled file that couldn't be probed
+func (s *Sample) recordFailure() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failed++
+}
+
+// Estimate is a statistic for the whole tree, with its 95% confidence interval
+type Estimate struct {
+	Name  string
+	Unit  string // "%" for shares of files
+	Value float64
+	Low   float64
+	High  float64
+}
+
+// seed returns the seed to sample with
+func (s *Sample) seed() int64 {
+	if s.Seed == 0 {
+		return DefaultSampleSeed
+	}
+	return s.Seed
+}
+
+// SampleSummary estimates statistics for the whole tree from the files sampled
+type SampleSummary struct {
+	Population int // Files the sample was drawn from
+	Sampled    int // Files probed, including failures
+	Failed     int
+	Seed       int64 // The seed the sample was chosen with, to repeat it
+	Estimates  []Estimate
+}
+
+// Summary estimates statistics for the whole tree from what's been sampled so far
+// Shares count every sampled file, bitrate only those that were probed successfully
+func (s *Sample) Summary() *SampleSummary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	summary := &SampleSummary{
+		Population: s.population,
+		Sampled:    len(s.reports) + s.failed,
+		Failed:     s.failed,
+		Seed:       s.seed(),
+	}
+	n := summary.Sampled
+	if n == 0 {
+		return summary
+	}
+
+	// Confidence intervals shrink as the sample approaches the whole population
+	correction := 0.0
+	if s.population > 1 {
+		correction = float64(s.population-n) / float64(s.population-1)
+	}
+	share := func(name string, count int) Estimate {
+		p := float64(count) / float64(n)
+		margin := z95 * math.Sqrt(p*(1-p)/float64(n)*correction)
+		return Estimate{Name: name, Unit: "%", Value: p * 100, Low: math.Max(0, p-margin) * 100, High: math.Min(1, p+margin) * 100}
+	}
+
+	codecs := make(map[string]int)
+	var mismatched, missingAudio, missingSubtitles, interlaced int
+	var bitrates []float64
+	for _, report := range s.reports {
+		codecs[report.Codec]++
+		if report.ExtensionMismatch {
+			mismatched++
+		}
+		if len(report.MissingAudioLanguages) > 0 {
+			missingAudio++
+		}
+		if len(report.MissingSubtitleLanguages) > 0 {
+			missingSubtitles++
+		}
+		if strings.HasPrefix(report.ScanType, "Interlaced") || report.ScanType == "MBAFF" {
+			interlaced++
+		}
+		bitrates = append(bitrates, report.BitrateMbps)
+	}
+
+	if len(bitrates) > 0 {
+		var sum, squares float64
+		for _, b := range bitrates {
+			sum += b
+		}
+		mean := sum / float64(len(bitrates))
+		for _, b := range bitrates {
+			squares += (b - mean) * (b - mean)
+		}
+		margin := 0.0
+		if len(bitrates) > 1 {
+			variance := squares / float64(len(bitrates)-1)
+			margin = z95 * math.Sqrt(variance/float64(len(bitrates))*correction)
+		}
+		summary.Estimates = append(summary.Estimates, Estimate{Name: "Mean bitrate", Unit: "Mbps", Value: mean, Low: math.Max(0, mean-margin), High: mean + margin})
+	}
+
+	names := make([]string, 0, len(codecs))
+	for codec := range codecs {
+		names = append(names, codec)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if codecs[names[i]] != codecs[names[j]] {
+			return codecs[names[i]] > codecs[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for _, codec := range names {
+		summary.Estimates = append(summary.Estimates, share("Codec "+codec, codecs[codec]))
+	}
+	summary.Estimates = append(summary.Estimates,
+		share("Interlaced", interlaced),
+		share("Extension mismatch", mismatched),
+		share("Missing audio languages", missingAudio),
+		share("Missing subtitle languages", missingSubtitles),
+		share("Failed to probe", s.failed),
+	)
+	return summary
+}
+
+// Write prints the summary as a table, with shares extrapolated to a number of files
+// It's headed as estimates, so nobody mistakes it for the results of a full scan
+func (s *SampleSummary) Write(w io.Writer) error {
+	fmt.Fprintf(w, "ESTIMATES for all %d files from a random sample of %d (seed %d, %d failed), with 95%% confidence intervals:\n", s.Population, s.Sampled, s.Seed, s.Failed)
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, e := range s.Estimates {
+		if e.Unit == "%" {
+			fmt.Fprintf(table, "%s\t%.1f%%\t(%.1f%% - %.1f%%)\t~%.0f files\n", e.Name, e.Value, e.Low, e.High, e.Value/100*float64(s.Population))
+		} else {
+			fmt.Fprintf(table, "%s\t%.2f %s\t(%.2f - %.2f)\n", e.Name, e.Value, e.Unit, e.Low, e.High)
+		}
+	}
+	return table.Flush()
+}
@@ -0,0 +1,124 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseSample(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    *Sample
+		wantErr bool
+	}{
+		{value: "5%", want: &Sample{Percent: 5}},
+		{value: " 12.5% ", want: &Sample{Percent: 12.5}},
+		{value: "100%", want: &Sample{Percent: 100}},
+		{value: "500", want: &Sample{Count: 500}},
+		{value: "0%", wantErr: true},
+		{value: "101%", wantErr: true},
+		{value: "0", wantErr: true},
+		{value: "-3", wantErr: true},
+		{value: "five", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParseSample(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseSample(%q) error = %v, want error %t", test.value, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && (got.Percent != test.want.Percent || got.Count != test.want.Count) {
+			t.Errorf("ParseSample(%q) = %+v, want %+v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestSampleChoose(t *testing.T) {
+	var candidates []foundFile
+	for i := 0; i < 100; i++ {
+		candidates = append(candidates, foundFile{path: fmt.Sprintf("/media/%03d.mkv", i)})
+	}
+	paths := func(files []foundFile) []string {
+		var paths []string
+		for _, file := range files {
+			paths = append(paths, file.path)
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name    string
+		percent float64
+		count   int
+		size    int
+	}{
+		{"percent", 10, 0, 10},
+		{"percent rounds up", 0.5, 0, 1},
+		{"count", 0, 7, 7},
+		{"more than there are", 0, 500, 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sample := &Sample{Percent: test.percent, Count: test.count}
+			chosen := paths(sample.choose(candidates))
+			if len(chosen) != test.size {
+				t.Fatalf("choose() = %d files, want %d", len(chosen), test.size)
+			}
+			for i := 1; i < len(chosen); i++ {
+				if chosen[i-1] >= chosen[i] {
+					t.Fatalf("choose() = %q, not in the order found", chosen)
+				}
+			}
+			// The same tree always gives the same sample
+			again := &Sample{Percent: test.percent, Count: test.count}
+			if repeat := paths(again.choose(candidates)); !reflect.DeepEqual(repeat, chosen) {
+				t.Errorf("choose() = %q, then %q", chosen, repeat)
+			}
+		})
+	}
+
+	seeded := func(seed int64) []string {
+		sample := &Sample{Count: 10, Seed: seed}
+		return paths(sample.choose(candidates))
+	}
+	if !reflect.DeepEqual(seeded(DefaultSampleSeed), seeded(0)) {
+		t.Errorf("choose() with the default seed = %q, want %q", seeded(DefaultSampleSeed), seeded(0))
+	}
+	if !reflect.DeepEqual(seeded(42), seeded(42)) || reflect.DeepEqual(seeded(42), seeded(0)) {
+		t.Errorf("choose() with seed 42 = %q, want a repeatable sample unlike %q", seeded(42), seeded(0))
+	}
+}
+
+func TestSampleSummary(t *testing.T) {
+	sample := &Sample{Count: 4}
+	sample.choose(make([]foundFile, 4))
+	for _, report := range []*Report{
+		{Codec: "AVC", BitrateMbps: 2, ScanType: "Progressive"},
+		{Codec: "HEVC", BitrateMbps: 6, ScanType: "Interlaced", ExtensionMismatch: true},
+		{Codec: "AVC", BitrateMbps: 4, ScanType: "MBAFF", MissingAudioLanguages: []string{"fre"}},
+	} {
+		sample.record(report)
+	}
+	sample.recordFailure()
+
+	// The sample is the whole tree, so there's nothing to be uncertain about
+	summary := sample.Summary()
+	want := []Estimate{
+		{Name: "Mean bitrate", Unit: "Mbps", Value: 4, Low: 4, High: 4},
+		{Name: "Codec AVC", Unit: "%", Value: 50, Low: 50, High: 50},
+		{Name: "Codec HEVC", Unit: "%", Value: 25, Low: 25, High: 25},
+		{Name: "Interlaced", Unit: "%", Value: 50, Low: 50, High: 50},
+		{Name: "Extension mismatch", Unit: "%", Value: 25, Low: 25, High: 25},
+		{Name: "Missing audio languages", Unit: "%", Value: 25, Low: 25, High: 25},
+		{Name: "Missing subtitle languages", Unit: "%", Value: 0, Low: 0, High: 0},
+		{Name: "Failed to probe", Unit: "%", Value: 25, Low: 25, High: 25},
+	}
+	if summary.Population != 4 || summary.Sampled != 4 || summary.Failed != 1 || summary.Seed != DefaultSampleSeed {
+		t.Errorf("Summary() = %d of %d sampled, %d failed, seed %d, want 4 of 4, 1 failed, seed %d",
+			summary.Sampled, summary.Population, summary.Failed, summary.Seed, DefaultSampleSeed)
+	}
+	if !reflect.DeepEqual(summary.Estimates, want) {
+		t.Errorf("Summary().Estimates = %+v, want %+v", summary.Estimates, want)
+	}
+}
@@ -0,0 +1,22 @@
+package mediaaudit
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrSandboxUnsupported is returned by WithSandbox on platforms where tools can't be sandboxed
+var ErrSandboxUnsupported error = errors.New("Sandboxing probes isn't supported on this platform")
+
+type sandboxKey struct{}
+
+// WithSandbox returns a context that runs the tools probing files, mediainfo and ffmpeg,
+// in a sandbox, since they parse untrusted files
+// On Linux that's fresh user, network, IPC and UTS namespaces, so they have no network access,
+// and they're killed if we exit
+func WithSandbox(ctx context.Context) (context.Context, error) {
+	if !sandboxSupported {
+		return ctx, ErrSandboxUnsupported
+	}
+	return context.WithValue(ctx, sandboxKey{}, true), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package mediaaudit
+
+import "os/exec"
+
+const sandboxSupported bool = false
+
+// sandbox isn't available here, WithSandbox refuses before we get this far
+func sandbox(cmd *exec.Cmd) {}
@@ -0,0 +1,631 @@
+package mediaaudit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// DefaultConcurrency is a sane number of files to probe at once, to avoid hitting file open limits
+const DefaultConcurrency int64 = 150
+
+// Each file being probed holds a few descriptors open, pipes to its tool and the file itself,
+// and the rest of the scan needs some for output, logs and the walk
+const (
+	filesPerProbe    uint64 = 4
+	filesForScanning uint64 = 64
+)
+
+var subtitleFileRegex *regexp.Regexp = regexp.MustCompile(`\.srt$|\.idx$|\.sub$`)
+
+// Backend probes a single file for its technical metadata
+// Values don't have to use mediainfo's names, common alternatives like ffprobe's are normalized to them
+type Backend interface {
+	Probe(ctx context.Context, path string) (*Report, error)
+}
+
+// ColumnBackend is a Backend that also fills in extra columns in Report.Extra
+type ColumnBackend interface {
+	Backend
+	ExtraColumns() []string
+}
+
+// Scanner walks a directory tree, probing every video file it finds
+// The zero value isn't usable, Backend must be set, and a Scanner must not be copied once used
+type Scanner struct {
+	Backend Backend
+
+	Concurrency int64  // How many files to probe at once, DefaultConcurrency if unset
+	PathStyle   string // How Report.Name is formatted, PathStyleBasename if unset
+
+	VideoExtensions []string // Extensions, without the dot, of files to probe, DefaultVideoExtensions if unset
+	Sniff           bool     // Also probe files with other extensions if their content looks like a video container
+	Shard           *Shard   // Only probe the files in this shard, if set
+	Sample          *Sample  // Only probe a random subset of files, and estimate statistics for the rest, if set
+
+	Order       string        // Which files to probe first, OrderWalk if unset
+	SettleTime  time.Duration // Leave files modified more recently than this until the end of the scan, and skip them if they're still changing
+	DeferLocked bool          // Leave files another program has locked until the end of the scan, and skip them if they're still locked
+
+	ProbeTimeout time.Duration // Kill the backend if a single probe takes longer than this, if set
+	Sandbox      bool          // Run mediainfo and ffmpeg sandboxed, see WithSandbox
+	MaxProcesses int64         // How many mediainfo and ffmpeg processes can run at once, unlimited if 0
+	MaxMemory    uint64        // Address space limit in bytes for each mediainfo and ffmpeg process, unlimited if 0
+	Retries      int           // How many more times to probe a file that failed, for flaky network mounts
+	RetryBackoff time.Duration // How long to wait before the first retry, doubling each time, DefaultRetryBackoff if unset
+
+	Verify                    string        // How thoroughly to check files for corruption, VerifyNone if unset
+	DecodeSegments            int           // With VerifyDecode, how many segments to sample, 0 decodes the whole file
+	DecodeSegmentLength       time.Duration // With VerifyDecode, how long each sampled segment is
+	IdetProbe                 bool          // Run ffmpeg's idet filter on files the backend can't classify
+	RequiredAudioLanguages    []string      // Languages every file must have an audio track for
+	RequiredSubtitleLanguages []string      // Languages every file must have embedded or sidecar subtitles for
+	RequireCaptions           bool          // Every file must have embedded closed captions
+	EstimateCommercials       bool          // Decode each file to estimate how much of it is commercials, for DVR recordings
+	MeasureComplexity         bool          // Decode a minute of each file to measure its spatial and temporal information
+	EstimateGrain             bool          // Sample each file to estimate how much film grain or noise it has
+	CheckFrames               bool          // Sample each file for black, frozen and corrupt frames
+	DetectDropouts            bool          // Decode each file to find where the audio drops out while the picture carries on
+	CheckTrailingData         bool          // Walk each file's container to find padding or junk after its logical end, implies the structure check
+
+	CheckNFO    bool // Compare each file to the stream details in its Kodi .nfo, if it has one
+	CheckNaming bool // Check file and folder names against Plex/Jellyfin conventions
+
+	CheckAspectRatio bool          // Check the display aspect ratio agrees with the stored dimensions and pixel aspect ratio
+	AspectRatios     []float64     // The display aspect ratios files are expected to have, any if empty, implies CheckAspectRatio
+	Production       bool          // Fill in each file's project folder and class, for production storage
+	Spec             *DeliverySpec // Check every file against this delivery spec, if set
+	RatingLimits     []RatingLimit // Read each file's content rating, and check files in these folders are within their limit
+
+	AudioExtensions []string // With ScanAudio, extensions, without the dot, of files to probe, DefaultAudioExtensions if unset
+	LossyHints      bool     // With ScanAudio, check lossless files for the spectral cutoff a lossy source leaves
+
+	References         *References // Score files listed here against their reference, if set
+	QualityMetric      string      // QualityVMAF or QualitySSIM, QualityVMAF if unset
+	QualityConcurrency int64       // How many quality comparisons, decode checks and other decoding analyses to run at once, DefaultQualityConcurrency if unset
+
+	Extensions []Extension   // Add extra columns to each report, in order
+	Filter     *Filter       // Only reports matching this are written, if set
+	Checkpoint *Checkpoint   // Skip files recorded here, and record each file as it's finished, if set
+	History    *Checkpoint   // Record each file as it's finished, for OrderNeverScannedFirst, if set
+	Failures   FailureWriter // Receives every file that couldn't be probed, if set
+
+	Logger Logger // Where skipped files and probe failures are logged, the standard logger if unset
+
+	qualitySem *semaphore.Weighted // The heavy work queue for quality comparisons and decoding analyses, set up by Scan
+	pause      pauseState          // See Pause
+}
+
+// ExtraColumns lists the columns added by the backend and the scanner's extensions, in order
+// Pass these to the Writer so it knows which extra values to output
+func (s *Scanner) ExtraColumns() []string {
+	var columns []string
+	if backend, ok := s.Backend.(ColumnBackend); ok {
+		columns = append(columns, backend.ExtraColumns()...)
+	}
+	for _, extension := range s.Extensions {
+		columns = append(columns, extension.Columns()...)
+	}
+	return columns
+}
+
+// logf formats and logs a message about the file at path
+func (s *Scanner) logf(level LogLevel, path string, format string, args ...interface{}) {
+	logger := s.Logger
+	if logger == nil {
+		logger = stdLogger{}
+	}
+	logger.Log(level, path, fmt.Sprintf(format, args...))
+}
+
+// foundFile is a file found by walk
+type foundFile struct {
+	path string
+	info os.FileInfo
+}
+
+// Plan is what a scan would cover, without probing anything
+type Plan struct {
+	Files       []string
+	Bytes       int64
+	UniqueBytes int64    // Bytes, counting files hardlinked to each other only once
+	Skipped     []string // Files that aren't videos or subtitles
+}
+
+// Plan walks root the same way Scan would, but only lists the files that would be probed
+func (s *Scanner) Plan(ctx context.Context, root string) (*Plan, error) {
+	return s.plan(ctx, s.videoWalk(root), s.Sample)
+}
+
+// plan lists the files walk would visit, with sample chosen from them if set
+func (s *Scanner) plan(ctx context.Context, walk walkFunc, sample *Sample) (*Plan, error) {
+	plan := &Plan{}
+	seen := make(map[string]bool)
+	err := s.walkOrdered(ctx, walk, sample, func(path string, info os.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		plan.Files = append(plan.Files, path)
+		plan.Bytes += info.Size()
+		if id := fileID(path, info); !seen[id] {
+			seen[id] = true
+			plan.UniqueBytes += info.Size()
+		}
+		return nil
+	}, func(path string) {
+		plan.Skipped = append(plan.Skipped, path)
+	})
+	return plan, err
+}
+
+// walkFunc walks a tree, calling visit for every file to probe and skip for every other file we don't recognise
+type walkFunc func(visit func(path string, info os.FileInfo) error, skip func(path string)) error
+
+// videoWalk returns a walkFunc that walks root for video files, see walk
+func (s *Scanner) videoWalk(root string) walkFunc {
+	return func(visit func(path string, info os.FileInfo) error, skip func(path string)) error {
+		return s.walk(root, visit, skip)
+	}
+}
+
+// walkOrdered is walk, but with sample or Order set it finds every file first,
+// then only visits the sample, in order
+func (s *Scanner) walkOrdered(ctx context.Context, walk walkFunc, sample *Sample, visit func(path string, info os.FileInfo) error, skip func(path string)) error {
+	if sample == nil && (s.Order == "" || s.Order == OrderWalk) {
+		return walk(visit, skip)
+	}
+
+	var candidates []foundFile
+	err := walk(func(path string, info os.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		candidates = append(candidates, foundFile{path: path, info: info})
+		return nil
+	}, skip)
+	if err != nil {
+		return err
+	}
+
+	if sample != nil {
+		candidates = sample.choose(candidates)
+	}
+	s.orderFiles(candidates)
+	for _, candidate := range candidates {
+		if err := visit(candidate.path, candidate.info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk calls visit for every video file under root, and skip for every other file we don't recognise
+// With Sniff set, files with other extensions are visited too if their content is a container we recognise
+// With Shard set, video files in other shards are passed over without calling either
+func (s *Scanner) walk(root string, visit func(path string, info os.FileInfo) error, skip func(path string)) error {
+	extensions := s.VideoExtensions
+	if len(extensions) == 0 {
+		extensions = DefaultVideoExtensions
+	}
+	return s.walkFiles(root, extensions, s.Sniff, true, visit, skip)
+}
+
+// walkFiles is walk, for files with the given extensions, sniffing the rest if sniff is set
+// With packages set, the ASSETMAP of each IMF or DCP package is visited in place of everything in its folder
+func (s *Scanner) walkFiles(root string, extensions []string, sniff, packages bool, visit func(path string, info os.FileInfo) error, skip func(path string)) error {
+	if s.Shard != nil {
+		visitAll := visit
+		visit = func(path string, info os.FileInfo) error {
+			if !s.Shard.Contains(root, path) {
+				return nil
+			}
+			return visitAll(path, info)
+		}
+	}
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		// Make sure we actually want to check the file
+		switch {
+		case err != nil:
+			s.logf(LevelError, path, "Prevent panic by handling failure accessing a path %q: %v", path, err)
+			return err
+		case info.IsDir() && packages:
+			if assetMap, info, ok := findPackage(path); ok {
+				if err := visit(assetMap, info); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		case info.IsDir():
+			return nil
+		case subtitleFileRegex.MatchString(info.Name()):
+			// These are picked up alongside their video file
+			return nil
+		case hasExtension(info.Name(), extensions):
+			return visit(path, info)
+		case sniff:
+			container, err := sniffFile(path)
+			if err != nil {
+				s.logf(LevelWarn, path, "Failed to read %q to check its content: %s", path, err.Error())
+			} else if container != "" {
+				s.logf(LevelDebug, path, "Probing %q, its content looks like %s", path, container)
+				return visit(path, info)
+			}
+		}
+		skip(path)
+		return nil
+	})
+}
+
+// Scan walks root and writes a report for each video file to w as soon as it's ready
+// Reports are written in whatever order probes finish, w is not closed
+// Once ctx is done no new probes are started, but the ones already running are allowed to finish
+// and their reports written, so that the output is never cut off mid-row
+func (s *Scanner) Scan(ctx context.Context, root string, w Writer) error {
+	return s.runScan(ctx, root, s.videoWalk(root), s.Sample, "non-video", func(ctx context.Context, path string, info os.FileInfo, writeLock *sync.Mutex) bool {
+		report, err := s.safeProbe(ctx, root, path, info)
+		if err != nil {
+			s.logf(LevelError, path, "%s", err.Error())
+			if s.Sample != nil {
+				s.Sample.recordFailure()
+			}
+			writeLock.Lock()
+			s.writeFailure(root, path, info, failureStatus(err), err.Error())
+			writeLock.Unlock()
+			return false
+		}
+		if s.Sample != nil {
+			s.Sample.record(report)
+		}
+
+		if s.Filter == nil || s.Filter.Match(report) {
+			// Now write it
+			writeLock.Lock()
+			err := w.Write(report)
+			writeLock.Unlock()
+			if err != nil {
+				s.logf(LevelError, path, "Failed to write output when checking %q: %s", info.Name(), err.Error())
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// probeFunc probes a single file and writes out its report or failure, holding writeLock while writing,
+// and returns whether it finished, so the file can be recorded in the checkpoint and history
+type probeFunc func(ctx context.Context, path string, info os.FileInfo, writeLock *sync.Mutex) bool
+
+// runScan is the part of a scan that doesn't depend on what's being probed
+// It walks with walk, skipping files the checkpoint has done and deferring files still settling or locked,
+// and probes the rest in the background with probe, as many at once as the concurrency and open file limit allow,
+// with the sandbox and limits applied, then waits for every probe to finish
+// Files walk skips are logged as skippedKind, e.g. non-video
+func (s *Scanner) runScan(ctx context.Context, root string, walk walkFunc, sample *Sample, skippedKind string, probe probeFunc) error {
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	// Stay under the open file limit, rather than have probes fail with EMFILE
+	if limit, ok := openFileLimit(); ok && limit > filesForScanning {
+		if fit := int64((limit - filesForScanning) / filesPerProbe); fit < concurrency {
+			s.logf(LevelWarn, "", "Probing %d files at once instead of %d to stay under the open file limit of %d", fit, concurrency, limit)
+			concurrency = fit
+		}
+	}
+
+	// Probes in flight are drained rather than killed, so they don't get the scan's context
+	probeCtx := context.Background()
+	var err error
+	if s.Sandbox {
+		if probeCtx, err = WithSandbox(probeCtx); err != nil {
+			return err
+		}
+	}
+	if s.MaxProcesses > 0 || s.MaxMemory > 0 {
+		if probeCtx, err = WithLimits(probeCtx, Limits{Processes: s.MaxProcesses, Memory: s.MaxMemory}); err != nil {
+			return err
+		}
+	}
+
+	var writeLock sync.Mutex
+	sem := semaphore.NewWeighted(concurrency)
+
+	qualityConcurrency := s.QualityConcurrency
+	if qualityConcurrency <= 0 {
+		qualityConcurrency = DefaultQualityConcurrency
+	}
+	s.qualitySem = semaphore.NewWeighted(qualityConcurrency)
+
+	var deferred []foundFile
+
+	// probeFile probes a single file in the background
+	probeFile := func(path string, info os.FileInfo) error {
+		// Acquire a semaphore
+		if err := sem.Acquire(ctx, 1); err != nil {
+			return err
+		}
+		go func(path string, info os.FileInfo) {
+			defer sem.Release(1)
+			if !probe(probeCtx, path, info, &writeLock) {
+				return
+			}
+
+			if s.Checkpoint != nil {
+				if err := s.Checkpoint.Record(path, info); err != nil {
+					s.logf(LevelWarn, path, "Failed to record %q in the checkpoint: %s", info.Name(), err.Error())
+				}
+			}
+			if s.History != nil {
+				if err := s.History.Record(path, info); err != nil {
+					s.logf(LevelWarn, path, "Failed to record %q in the history: %s", info.Name(), err.Error())
+				}
+			}
+		}(path, info)
+		return nil
+	}
+
+	// Traverse the given directory
+	walkErr := s.walkOrdered(ctx, walk, sample, func(path string, info os.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if s.Checkpoint != nil && s.Checkpoint.Done(path, info) {
+			return nil
+		}
+		if err := s.waitWhilePaused(ctx); err != nil {
+			return err
+		}
+
+		// Files still being written would only give a partial report, so come back to them at the end
+		if s.SettleTime > 0 {
+			if age := time.Since(info.ModTime()); age < s.SettleTime {
+				s.logf(LevelInfo, path, "Deferring %q, it was modified %s ago", info.Name(), age.Round(time.Second))
+				deferred = append(deferred, foundFile{path: path, info: info})
+				return nil
+			}
+		}
+		if s.DeferLocked && fileLocked(path) {
+			s.logf(LevelInfo, path, "Deferring %q, another program has it locked", info.Name())
+			deferred = append(deferred, foundFile{path: path, info: info})
+			return nil
+		}
+		return probeFile(path, info)
+	}, func(path string) {
+		// We're not sure what we're skipping here, so log to stderr
+		s.logf(LevelInfo, path, "Skipping %s file: %q", skippedKind, filepath.Base(path))
+	})
+
+	if walkErr == nil {
+		walkErr = s.probeDeferred(ctx, deferred, probeFile, func(file foundFile, status, reason string) {
+			writeLock.Lock()
+			s.writeFailure(root, file.path, file.info, status, reason)
+			writeLock.Unlock()
+		})
+	}
+
+	// Wait for all goroutines to finish, even if the context is done they need to finish writing
+	sem.Acquire(context.Background(), concurrency)
+	return walkErr
+}
+
+// failureStatus is the Failure status for a probe that failed with err
+func failureStatus(err error) string {
+	var parseErr *ParseError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return FailureTimeout
+	case errors.As(err, &parseErr):
+		return FailureParse
+	}
+	return FailureError
+}
+
+// writeFailure records a file that couldn't be probed with s.Failures, if set
+// It isn't safe for concurrent use, callers need to hold the same lock as for writing reports
+func (s *Scanner) writeFailure(root, path string, info os.FileInfo, status, reason string) {
+	if s.Failures == nil {
+		return
+	}
+	failure := &Failure{
+		ID:     fileID(path, info),
+		Path:   path,
+		Name:   displayPath(root, path, s.PathStyle),
+		Status: status,
+		Reason: reason,
+	}
+	if err := s.Failures.WriteFailure(failure); err != nil {
+		s.logf(LevelError, path, "Failed to record failure for %q: %s", info.Name(), err.Error())
+	}
+}
+
+// safeProbe is probe, but turns a panic into a ParseError so the rest of the scan carries on
+func (s *Scanner) safeProbe(ctx context.Context, root, path string, info os.FileInfo) (report *Report, err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			parseErr := &ParseError{Path: path, Value: value, Stack: debug.Stack()}
+			s.logf(LevelDebug, path, "%s\n%s", parseErr.Error(), parseErr.Stack)
+			report, err = nil, parseErr
+		}
+	}()
+	return s.probe(ctx, root, path, info)
+}
+
+// probe builds the full report for a single file
+func (s *Scanner) probe(ctx context.Context, root, path string, info os.FileInfo) (*Report, error) {
+	s.logf(LevelDebug, path, "Probing %q", path)
+
+	// A package is reported as a whole, named after its folder,
+	// and its main picture track stands in for it wherever a check needs to read the media
+	name, media := path, path
+	var report *Report
+	var err error
+	if isAssetMap(path) {
+		name = filepath.Dir(path)
+		report, media, err = s.probePackage(ctx, path)
+	} else {
+		// Get the report from the backend
+		err = s.probeWithRetries(ctx, path, func(ctx context.Context) (err error) {
+			report, err = s.Backend.Probe(ctx, path)
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	normalizeReport(report)
+	fillAspectRatio(report)
+	report.Licensing = CodecLicensing(report.Codec)
+	report.ExtensionMismatch = extensionMismatch(name, report.Container)
+
+	// Mediainfo can't always tell, so optionally look at the frames themselves
+	if s.IdetProbe && media != "" && ambiguousScanType(report.ScanType) {
+		scanType, err := detectScanType(ctx, media)
+		if err != nil {
+			s.logf(LevelWarn, path, "Failed to run idet on %q: %s", info.Name(), err.Error())
+		} else {
+			report.ScanType = scanType
+		}
+	}
+
+	// A package without a picture track has nothing to verify
+	// Finding trailing data takes the same walk as the structure check, so it fills that in too
+	if media != "" && (s.Verify == VerifyStructure || s.CheckTrailingData) {
+		s.checkStructure(report, media)
+	}
+	if media != "" && s.Verify == VerifyDecode {
+		s.verifyDecode(ctx, report, media)
+	}
+
+	if s.References != nil && media != "" {
+		if reference, ok := s.References.Reference(name); ok {
+			s.measureQuality(ctx, report, media, reference)
+		}
+	}
+
+	if s.EstimateCommercials && media != "" {
+		s.estimateCommercials(ctx, report, media)
+	}
+
+	if s.MeasureComplexity && media != "" {
+		s.measureComplexity(ctx, report, media)
+	}
+
+	if s.EstimateGrain && media != "" {
+		s.estimateGrain(ctx, report, media)
+	}
+
+	if s.CheckFrames && media != "" {
+		s.checkFrames(ctx, report, media)
+	}
+
+	if s.DetectDropouts && media != "" && len(report.AudioChannels) > 0 {
+		s.detectDropouts(ctx, report, media)
+	}
+
+	if s.CheckNFO {
+		report.NFO, err = checkNFO(report, name)
+		if err != nil {
+			s.logf(LevelWarn, path, "Failed to check the .nfo for %q: %s", info.Name(), err.Error())
+		}
+	}
+
+	if s.CheckNaming {
+		report.Naming = checkNaming(root, name)
+	}
+
+	if len(s.RatingLimits) > 0 {
+		report.ContentRating, err = readRating(name)
+		if err != nil {
+			s.logf(LevelWarn, path, "Failed to read the content rating for %q: %s", info.Name(), err.Error())
+		}
+		if rel, err := filepath.Rel(root, name); err == nil {
+			report.Parental = checkRating(filepath.ToSlash(rel), report.ContentRating, s.RatingLimits)
+		}
+	}
+
+	if s.CheckAspectRatio || len(s.AspectRatios) > 0 {
+		report.AspectRatio = checkAspectRatio(report, s.AspectRatios)
+	}
+
+	if s.Spec != nil {
+		report.Spec, err = checkDeliverySpec(ctx, report, media, s.Spec)
+		if err != nil {
+			s.logf(LevelWarn, path, "Failed to measure the loudness of %q: %s", info.Name(), err.Error())
+		}
+	}
+
+	if s.Production {
+		report.Project = projectFolder(root, name)
+		report.Class = classifyFile(root, name, report)
+	}
+
+	checkAudioLanguages(report, s.RequiredAudioLanguages)
+	checkSubtitleLanguages(report, sidecarSubtitles(name), s.RequiredSubtitleLanguages)
+	checkCaptions(report, s.RequireCaptions)
+
+	report.ID = fileID(path, info)
+	report.Path = path
+	report.Name = displayPath(root, name, s.PathStyle)
+	detectPart(report, name)
+
+	// Calculate the size of the file
+	// Hardlinked files have the same ID, so totals can count each one once
+	report.SizeMB = math.Round((float64(info.Size())/1048576)*100) / 100
+	report.Modified = info.ModTime()
+	if links, ok := linkCount(info); ok {
+		report.Hardlinks = int(links)
+	}
+
+	// Extensions get to see the finished report
+	for _, extension := range s.Extensions {
+		values, err := extension.Extend(ctx, report)
+		if err != nil {
+			s.logf(LevelWarn, path, "Extension failed when checking %q: %s", info.Name(), err.Error())
+			continue
+		}
+		if report.Extra == nil {
+			report.Extra = make(map[string]string)
+		}
+		for _, column := range extension.Columns() {
+			if value, ok := values[column]; ok {
+				report.Extra[column] = value
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// measureQuality scores the file at path against its reference, waiting its turn in the heavy work queue
+func (s *Scanner) measureQuality(ctx context.Context, report *Report, path, reference string) {
+	metric := s.QualityMetric
+	if metric == "" {
+		metric = QualityVMAF
+	}
+	report.QualityMetric = metric
+
+	if err := s.qualitySem.Acquire(ctx, 1); err != nil {
+		return
+	}
+	defer s.qualitySem.Release(1)
+
+	s.logf(LevelDebug, path, "Comparing %q to %q", path, reference)
+	score, err := measureQuality(ctx, path, reference, metric)
+	if err != nil {
+		s.logf(LevelWarn, path, "Failed to measure %s of %q against %q: %s", metric, path, reference, err.Error())
+		return
+	}
+	report.QualityScore = score
+}
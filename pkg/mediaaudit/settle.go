@@ -0,0 +1,47 @@
+package mediaaudit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// probeDeferred probes each deferred file once s.SettleTime has passed since it was last modified
+// Files that changed again in the meantime are still being written, and with s.DeferLocked, files that are
+// still locked are still in use too, so they're passed to inUse with a FailureInUse or FailureLocked status instead
+func (s *Scanner) probeDeferred(ctx context.Context, deferred []foundFile, probe func(path string, info os.FileInfo) error, inUse func(file foundFile, status, reason string)) error {
+	for _, file := range deferred {
+		if err := s.waitWhilePaused(ctx); err != nil {
+			return err
+		}
+		if !sleep(ctx, time.Until(file.info.ModTime().Add(s.SettleTime))) {
+			return ctx.Err()
+		}
+
+		info, err := statFile(file.path)
+		if err != nil {
+			// Downloaders often write to a temporary name and rename it once finished
+			s.logf(LevelInfo, file.path, "Skipping %q, it's gone since it was deferred: %s", file.info.Name(), err.Error())
+			continue
+		}
+		if !info.ModTime().Equal(file.info.ModTime()) || info.Size() != file.info.Size() {
+			reason := fmt.Sprintf("Still being written, modified %s ago", time.Since(info.ModTime()).Round(time.Second))
+			s.logf(LevelWarn, file.path, "Skipping %q: %s", info.Name(), reason)
+			inUse(file, FailureInUse, reason)
+			continue
+		}
+		if s.DeferLocked && fileLocked(file.path) {
+			reason := "Locked by another program"
+			s.logf(LevelWarn, file.path, "Skipping %q: %s", info.Name(), reason)
+			inUse(file, FailureLocked, reason)
+			continue
+		}
+
+		s.logf(LevelDebug, file.path, "Probing deferred file %q", file.path)
+		if err := probe(file.path, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Shard is one of Count deterministic, non-overlapping subsets of a tree
+// Independent scans of the same tree, one per shard, cover every file exactly once
+type Shard struct {
+	Index int // From 1 to Count
+	Count int
+}
+
+// ParseShard parses a shard written as index/count, e.g. 2/8
+func ParseShard(value string) (*Shard, error) {
+	index, count, ok := cut(value, "/")
+	if !ok {
+		return nil, fmt.Errorf("Invalid shard %q, expected index/count, e.g. 2/8", value)
+	}
+	shard := &Shard{}
+	var err error
+	if shard.Index, err = strconv.Atoi(strings.TrimSpace(index)); err != nil {
+		return nil, fmt.Errorf("Invalid shard index %q: %w", index, err)
+	}
+	if shard.Count, err = strconv.Atoi(strings.TrimSpace(count)); err != nil {
+		return nil, fmt.Errorf("Invalid shard count %q: %w", count, err)
+	}
+	if shard.Count < 1 || shard.Index < 1 || shard.Index > shard.Count {
+		return nil, fmt.Errorf("Invalid shard %q, the index must be between 1 and the count", value)
+	}
+	return shard, nil
+}
+
+func (s *Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// Contains reports whether the file at path belongs to this shard
+// Files are assigned by a hash of their path relative to root, so hosts that mount the
+// library in different places still agree
+func (s *Shard) Contains(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(filepath.ToSlash(rel)))
+	return int(hash.Sum32()%uint32(s.Count)) == s.Index-1
+}
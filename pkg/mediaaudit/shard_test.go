@@ -0,0 +1,72 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Shard
+		wantErr bool
+	}{
+		{value: "2/8", want: Shard{Index: 2, Count: 8}},
+		{value: " 1 / 1 ", want: Shard{Index: 1, Count: 1}},
+		{value: "8/8", want: Shard{Index: 8, Count: 8}},
+		{value: "2", wantErr: true},
+		{value: "0/8", wantErr: true},
+		{value: "9/8", wantErr: true},
+		{value: "1/0", wantErr: true},
+		{value: "a/8", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParseShard(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseShard(%q) error = %v, want error %t", test.value, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && *got != test.want {
+			t.Errorf("ParseShard(%q) = %s, want %s", test.value, got, &test.want)
+		}
+	}
+}
+
+func TestShardContains(t *testing.T) {
+	var paths []string
+	for i := 0; i < 1000; i++ {
+		paths = append(paths, filepath.FromSlash(fmt.Sprintf("TV/Show %d/Season %02d/Show %d - S%02dE%02d.mkv", i/100, i/10%10+1, i/100, i/10%10+1, i%10+1)))
+	}
+
+	for _, count := range []int{1, 2, 3, 8} {
+		t.Run(fmt.Sprintf("%d shards", count), func(t *testing.T) {
+			// Every file is in exactly one shard, wherever the library is mounted
+			sizes := make([]int, count)
+			for _, path := range paths {
+				var in []int
+				for index := 1; index <= count; index++ {
+					shard := &Shard{Index: index, Count: count}
+					here := shard.Contains(filepath.FromSlash("/media"), filepath.Join(filepath.FromSlash("/media"), path))
+					there := shard.Contains(filepath.FromSlash("/mnt/library"), filepath.Join(filepath.FromSlash("/mnt/library"), path))
+					if here != there {
+						t.Fatalf("Shard %d/%d disagrees between mounts on %s", index, count, path)
+					}
+					if here {
+						in = append(in, index)
+					}
+				}
+				if len(in) != 1 {
+					t.Fatalf("%s is in shards %v, want exactly one", path, in)
+				}
+				sizes[in[0]-1]++
+			}
+			// And the shards are roughly even
+			for i, size := range sizes {
+				if want := len(paths) / count; size < want*3/4 || size > want*5/4 {
+					t.Errorf("Shard %d/%d has %d files, want about %d", i+1, count, size, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package mediaaudit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultVideoExtensions are the extensions probed when Scanner.VideoExtensions is unset
+var DefaultVideoExtensions []string = []string{"mp4", "mkv", "avi", "mov", "mxf", "ts", "m2ts", "mts", "mpg"}
+
+// Container signatures recognised by sniffContainer
+const (
+	signatureMatroska string = "Matroska" // Also WebM
+	signatureAVI      string = "AVI"
+	signatureBMFF     string = "MPEG-4" // Also QuickTime
+	signatureMPEGTS   string = "MPEG-TS"
+	signatureBDAV     string = "BDAV" // MPEG-TS with a 4 byte timestamp before each packet, as in .m2ts
+	signatureASF      string = "ASF"  // Windows Media
+	signatureFLV      string = "FLV"
+	signatureMPEGPS   string = "MPEG-PS"
+	signatureMXF      string = "MXF"
+)
+
+// sniffLength is how much of a file sniffContainer needs, enough for two transport stream packets
+const sniffLength int = 2*192 + 4
+
+// mxfPartitionKey starts the key of every MXF partition pack, the first of which opens the file
+var mxfPartitionKey []byte = []byte{0x06, 0x0E, 0x2B, 0x34, 0x02, 0x05, 0x01, 0x01, 0x0D, 0x01, 0x02, 0x01, 0x01}
+
+var asfHeaderGUID []byte = []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11, 0xA6, 0xD9, 0x00, 0xAA, 0x00, 0x62, 0xCE, 0x6C}
+
+// hasExtension reports whether name ends in one of extensions, given without the dot and in any case
+func hasExtension(name string, extensions []string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	for _, e := range extensions {
+		if strings.EqualFold(ext, strings.TrimPrefix(e, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// readHeader reads up to sniffLength bytes from the start of r
+// A file shorter than that isn't an error, the header is just shorter
+func readHeader(r io.ReaderAt) ([]byte, error) {
+	header := make([]byte, sniffLength)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+// sniffContainer recognises a container from the start of a file, returning "" if it's not one we know
+func sniffContainer(header []byte) string {
+	startsWith := func(offset int, signature []byte) bool {
+		return len(header) >= offset+len(signature) && bytes.Equal(header[offset:offset+len(signature)], signature)
+	}
+
+	switch {
+	case startsWith(0, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return signatureMatroska
+	case startsWith(0, []byte("RIFF")) && startsWith(8, []byte("AVI ")):
+		return signatureAVI
+	case len(header) >= 8 && isBMFFBoxType(header[4:8]):
+		return signatureBMFF
+	case startsWith(0, asfHeaderGUID):
+		return signatureASF
+	case startsWith(0, []byte("FLV\x01")):
+		return signatureFLV
+	case startsWith(0, []byte{0x00, 0x00, 0x01, 0xBA}):
+		return signatureMPEGPS
+	case startsWith(0, mxfPartitionKey):
+		return signatureMXF
+	case startsWith(0, []byte{0x47}) && startsWith(188, []byte{0x47}) && startsWith(2*188, []byte{0x47}):
+		return signatureMPEGTS
+	case startsWith(4, []byte{0x47}) && startsWith(4+192, []byte{0x47}) && startsWith(4+2*192, []byte{0x47}):
+		return signatureBDAV
+	}
+	return ""
+}
+
+// sniffFile recognises the container of the file at path by its content, returning "" if it's not one we know
+func sniffFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header, err := readHeader(file)
+	if err != nil {
+		return "", err
+	}
+	return sniffContainer(header), nil
+}
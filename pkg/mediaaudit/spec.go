@@ -0,0 +1,283 @@
+package mediaaudit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultLoudnessTolerance is how far, in LU, the integrated loudness can be from a spec's target
+const DefaultLoudnessTolerance float64 = 1
+
+// frameRateTolerance is how far apart two frame rates can be and still count as the same,
+// so 23.976 matches 24000/1001
+const frameRateTolerance = 0.01
+
+// Resolution is a width and height in pixels
+type Resolution struct {
+	Width  int
+	Height int
+}
+
+func (r Resolution) String() string {
+	return fmt.Sprintf("%dx%d", r.Width, r.Height)
+}
+
+// DeliverySpec describes what a deliverable has to be, anything left empty isn't checked
+type DeliverySpec struct {
+	Name              string
+	Containers        []string     // Any of these, as mediainfo names them, e.g. MPEG-4
+	Codecs            []string     // Any of these video codecs, as mediainfo names them, e.g. AVC, or commercial names, e.g. XDCAM HD422
+	Resolutions       []Resolution // Any of these
+	FrameRates        []float64    // Any of these, e.g. 23.976
+	AudioChannels     []int        // Exactly these audio tracks, with this many channels each, in order, e.g. 6 2 for 5.1 then stereo
+	Loudness          *float64     // The integrated loudness of the first audio track, in LUFS
+	LoudnessTolerance float64      // How far, in LU, the loudness can be from Loudness
+	TruePeak          *float64     // The most the true peak of the first audio track can reach, in dBTP
+	Captions          bool         // Closed captions must be embedded in the video
+}
+
+// LoadDeliverySpec reads the spec called name from a file of specs
+// Each spec starts with its name in brackets, e.g. [broadcast-hd], followed by `key = value` lines:
+// container, codec, resolution, frame-rate and audio-channels take comma separated lists,
+// loudness, loudness-tolerance and true-peak a number, and captions true or false
+// Blank lines and lines starting with # are ignored
+// If name is empty the file must have exactly one spec
+func LoadDeliverySpec(path, name string) (*DeliverySpec, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadDeliverySpec(file, path, name)
+}
+
+// ReadDeliverySpec reads the spec called name from specs in the format LoadDeliverySpec reads,
+// naming them source in any error
+func ReadDeliverySpec(r io.Reader, source, name string) (*DeliverySpec, error) {
+	var specs []*DeliverySpec
+	var spec *DeliverySpec
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			spec = &DeliverySpec{Name: strings.TrimSpace(line[1 : len(line)-1]), LoudnessTolerance: DefaultLoudnessTolerance}
+			specs = append(specs, spec)
+			continue
+		}
+		if spec == nil {
+			return nil, fmt.Errorf("%s:%d: expected a [spec-name] before any settings", source, lineNumber)
+		}
+
+		key, value, ok := cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key = value", source, lineNumber)
+		}
+		if err := spec.set(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", source, lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, spec := range specs {
+		if spec.Name == name || (name == "" && len(specs) == 1) {
+			return spec, nil
+		}
+		names = append(names, spec.Name)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%s has %d specs, choose one of: %s", source, len(specs), strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("%s has no spec %q, choose one of: %s", source, name, strings.Join(names, ", "))
+}
+
+// set parses the value of one of the spec's settings
+func (d *DeliverySpec) set(key, value string) error {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	switch key {
+	case "container":
+		d.Containers = values
+	case "codec":
+		d.Codecs = values
+	case "resolution":
+		for _, v := range values {
+			width, height, ok := cut(v, "x")
+			w, widthErr := strconv.Atoi(width)
+			h, heightErr := strconv.Atoi(height)
+			if !ok || widthErr != nil || heightErr != nil {
+				return fmt.Errorf("Invalid resolution %q, expected something like 1920x1080", v)
+			}
+			d.Resolutions = append(d.Resolutions, Resolution{Width: w, Height: h})
+		}
+	case "frame-rate":
+		for _, v := range values {
+			rate, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("Invalid frame rate %q, expected something like 23.976", v)
+			}
+			d.FrameRates = append(d.FrameRates, rate)
+		}
+	case "audio-channels":
+		for _, v := range values {
+			channels, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("Invalid channel count %q, expected something like 6", v)
+			}
+			d.AudioChannels = append(d.AudioChannels, channels)
+		}
+	case "loudness", "loudness-tolerance", "true-peak":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid %s %q, expected a number", key, value)
+		}
+		switch key {
+		case "loudness":
+			d.Loudness = &number
+		case "loudness-tolerance":
+			d.LoudnessTolerance = math.Abs(number)
+		case "true-peak":
+			d.TruePeak = &number
+		}
+	case "captions":
+		required, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Invalid captions %q, expected true or false", value)
+		}
+		d.Captions = required
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
+
+// Matches the integrated loudness and true peak in the summary of ffmpeg's ebur128 filter
+var (
+	integratedLoudnessRegex *regexp.Regexp = regexp.MustCompile(`I:\s+(-?[\d.]+|-inf) LUFS`)
+	truePeakRegex           *regexp.Regexp = regexp.MustCompile(`Peak:\s+(-?[\d.]+|-inf) dBFS`)
+)
+
+// measureLoudness decodes the first audio track with ffmpeg's ebur128 filter, returning its integrated loudness in LUFS
+// and true peak in dBTP
+func measureLoudness(ctx context.Context, path string) (float64, float64, error) {
+	output, err := runFFmpegFilter(ctx, "-i", path, "-map", "0:a:0", "-af", "ebur128=peak=true:framelog=verbose")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var levels [2]float64
+	for i, regex := range []*regexp.Regexp{integratedLoudnessRegex, truePeakRegex} {
+		matches := regex.FindAllStringSubmatch(output, -1)
+		if len(matches) == 0 {
+			return 0, 0, fmt.Errorf("No loudness summary in ffmpeg output for %q", path)
+		}
+		// Only the last summary covers the full run
+		level := matches[len(matches)-1][1]
+		if level == "-inf" {
+			levels[i] = math.Inf(-1)
+		} else if levels[i], err = strconv.ParseFloat(level, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	return levels[0], levels[1], nil
+}
+
+// checkDeliverySpec lists where the file at path falls short of spec, or returns ok
+// Loudness is only measured if the spec sets it, and a failure to measure it counts against the file
+func checkDeliverySpec(ctx context.Context, report *Report, path string, spec *DeliverySpec) (string, error) {
+	var problems []string
+
+	if len(spec.Containers) > 0 && !containsFold(spec.Containers, report.Container) {
+		problems = append(problems, fmt.Sprintf("container %s, expected %s", report.Container, strings.Join(spec.Containers, " or ")))
+	}
+	if len(spec.Codecs) > 0 && !containsFold(spec.Codecs, report.Codec) && !containsFold(spec.Codecs, report.CommercialName) {
+		problems = append(problems, fmt.Sprintf("codec %s, expected %s", report.Codec, strings.Join(spec.Codecs, " or ")))
+	}
+
+	if len(spec.Resolutions) > 0 {
+		found := false
+		var expected []string
+		for _, resolution := range spec.Resolutions {
+			found = found || (resolution.Width == report.Width && resolution.Height == report.Height)
+			expected = append(expected, resolution.String())
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%dx%d, expected %s", report.Width, report.Height, strings.Join(expected, " or ")))
+		}
+	}
+
+	if len(spec.FrameRates) > 0 {
+		found := false
+		var expected []string
+		for _, rate := range spec.FrameRates {
+			found = found || math.Abs(rate-report.FrameRate) <= frameRateTolerance*rate
+			expected = append(expected, strconv.FormatFloat(rate, 'f', -1, 64))
+		}
+		switch {
+		case report.FrameRate == 0:
+			problems = append(problems, fmt.Sprintf("variable or unknown frame rate, expected %s fps", strings.Join(expected, " or ")))
+		case !found:
+			problems = append(problems, fmt.Sprintf("%.3f fps, expected %s", report.FrameRate, strings.Join(expected, " or ")))
+		}
+	}
+
+	if len(spec.AudioChannels) > 0 && joinInts(report.AudioChannels, " ") != joinInts(spec.AudioChannels, " ") {
+		problems = append(problems, fmt.Sprintf("audio channels %q, expected %q", joinInts(report.AudioChannels, " "), joinInts(spec.AudioChannels, " ")))
+	}
+
+	if spec.Captions && len(report.Captions) == 0 {
+		problems = append(problems, "no closed captions")
+	}
+
+	var err error
+	if spec.Loudness != nil || spec.TruePeak != nil {
+		var loudness, truePeak float64
+		if len(report.AudioChannels) == 0 {
+			problems = append(problems, "no audio to measure the loudness of")
+		} else if loudness, truePeak, err = measureLoudness(ctx, path); err != nil {
+			problems = append(problems, "loudness not measured")
+		} else {
+			if spec.Loudness != nil && math.Abs(loudness-*spec.Loudness) > spec.LoudnessTolerance {
+				problems = append(problems, fmt.Sprintf("loudness %.1f LUFS, expected %.1f±%.1f", loudness, *spec.Loudness, spec.LoudnessTolerance))
+			}
+			if spec.TruePeak != nil && truePeak > *spec.TruePeak {
+				problems = append(problems, fmt.Sprintf("true peak %.1f dBTP, over %.1f", truePeak, *spec.TruePeak))
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return "ok", err
+	}
+	return strings.Join(problems, ", "), err
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
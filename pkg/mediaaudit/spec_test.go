@@ -0,0 +1,138 @@
+package mediaaudit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testSpecs string = `# Delivery specs
+[broadcast-hd]
+container = MXF, MPEG-4
+codec = AVC
+resolution = 1920x1080
+frame-rate = 25, 29.97
+audio-channels = 6, 2
+loudness = -23
+true-peak = -1
+
+[web]
+codec = AVC, HEVC
+loudness-tolerance = -2
+`
+
+func TestLoadDeliverySpec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "specs.conf")
+	if err := os.WriteFile(path, []byte(testSpecs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loudness, truePeak := -23.0, -1.0
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    *DeliverySpec
+		wantErr bool
+	}{
+		{
+			name: "every setting",
+			spec: "broadcast-hd",
+			want: &DeliverySpec{Name: "broadcast-hd", Containers: []string{"MXF", "MPEG-4"}, Codecs: []string{"AVC"},
+				Resolutions: []Resolution{{1920, 1080}}, FrameRates: []float64{25, 29.97}, AudioChannels: []int{6, 2},
+				Loudness: &loudness, LoudnessTolerance: DefaultLoudnessTolerance, TruePeak: &truePeak},
+		},
+		{
+			name: "tolerance is a distance",
+			spec: "web",
+			want: &DeliverySpec{Name: "web", Codecs: []string{"AVC", "HEVC"}, LoudnessTolerance: 2},
+		},
+		{name: "unknown spec", spec: "cinema", wantErr: true},
+		{name: "more than one spec to choose from", spec: "", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec, err := LoadDeliverySpec(path, test.spec)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("LoadDeliverySpec() succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadDeliverySpec() error = %v", err)
+			}
+			if !reflect.DeepEqual(spec, test.want) {
+				t.Errorf("LoadDeliverySpec() = %+v, want %+v", spec, test.want)
+			}
+		})
+	}
+
+	for _, content := range []string{
+		"codec = AVC\n",
+		"[web]\ncodec\n",
+		"[web]\nresolution = 1080p\n",
+		"[web]\nframe-rate = fast\n",
+		"[web]\naudio-channels = 5.1\n",
+		"[web]\nloudness = loud\n",
+		"[web]\nbitrate = 8\n",
+	} {
+		path := filepath.Join(t.TempDir(), "specs.conf")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadDeliverySpec(path, ""); err == nil {
+			t.Errorf("LoadDeliverySpec(%q) succeeded", content)
+		}
+	}
+}
+
+func TestCheckDeliverySpec(t *testing.T) {
+	spec := &DeliverySpec{Containers: []string{"MXF", "MPEG-4"}, Codecs: []string{"AVC"}, Resolutions: []Resolution{{1920, 1080}, {1280, 720}},
+		FrameRates: []float64{25, 23.976}, AudioChannels: []int{6, 2}}
+	valid := Report{Container: "MPEG-4", Codec: "AVC", Width: 1920, Height: 1080, FrameRate: 25, AudioChannels: []int{6, 2}}
+
+	tests := []struct {
+		name   string
+		change func(report *Report)
+		want   string
+	}{
+		{"meets the spec", func(report *Report) {}, "ok"},
+		{"case doesn't matter", func(report *Report) {
+			report.Container, report.Codec = "mpeg-4", "avc"
+		}, "ok"},
+		{"24000/1001 is 23.976", func(report *Report) {
+			report.FrameRate = 24000.0 / 1001
+		}, "ok"},
+		{"wrong container and codec", func(report *Report) {
+			report.Container, report.Codec = "Matroska", "HEVC"
+		}, "container Matroska, expected MXF or MPEG-4, codec HEVC, expected AVC"},
+		{"wrong resolution", func(report *Report) {
+			report.Width, report.Height = 720, 576
+		}, "720x576, expected 1920x1080 or 1280x720"},
+		{"wrong frame rate", func(report *Report) {
+			report.FrameRate = 29.97
+		}, "29.970 fps, expected 25 or 23.976"},
+		{"variable frame rate", func(report *Report) {
+			report.FrameRate = 0
+		}, "variable or unknown frame rate, expected 25 or 23.976 fps"},
+		{"audio tracks out of order", func(report *Report) {
+			report.AudioChannels = []int{2, 6}
+		}, `audio channels "2 6", expected "6 2"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := valid
+			report.AudioChannels = append([]int(nil), valid.AudioChannels...)
+			test.change(&report)
+			got, err := checkDeliverySpec(context.Background(), &report, "test.mp4", spec)
+			if err != nil {
+				t.Fatalf("checkDeliverySpec() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("checkDeliverySpec() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,670 @@
+package mediaaudit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Verification levels, from cheapest to most thorough
+const (
+	VerifyNone      string = "none"
+	VerifyStructure string = "structure" // Walk the container's box/element tree without decoding anything
+	VerifyDecode    string = "decode"    // Decode the file, or samples of it, with ffmpeg
+)
+
+// How many index entries we'll follow before calling the index good enough
+const maxIndexEntries = 100000
+
+// errUnsupportedContainer is returned for containers the structure check can't walk, e.g. transport streams,
+// which says nothing about whether the file is sound
+var errUnsupportedContainer error = errors.New("Unrecognised container signature")
+
+// structureCheck is the outcome of walking a container's structure
+type structureCheck struct {
+	problems   []string
+	size       int64
+	logicalEnd int64 // Where the container's last top-level element ends, less any padding after it
+}
+
+func (c *structureCheck) problem(format string, args ...interface{}) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+// String summarizes the problems found, ok if there weren't any
+// One broken element usually breaks everything around it, so only the first problem is spelled out
+func (c *structureCheck) String() string {
+	switch len(c.problems) {
+	case 0:
+		return "ok"
+	case 1:
+		return c.problems[0]
+	}
+	return fmt.Sprintf("%s (and %d more)", c.problems[0], len(c.problems)-1)
+}
+
+// trailingBytes is how much of the file comes after the container's logical end, padding or junk that
+// nothing reads, 0 if there isn't any or the file is cut short
+func (c *structureCheck) trailingBytes() int64 {
+	if c.logicalEnd >= c.size {
+		return 0
+	}
+	return c.size - c.logicalEnd
+}
+
+// checkStructure walks the top-level structure of the file at path, see walkStructure
+func checkStructure(path string) (*structureCheck, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	check, err := walkStructure(file, info.Size())
+	if errors.Is(err, errUnsupportedContainer) {
+		return nil, fmt.Errorf("%w in %q", err, path)
+	}
+	return check, err
+}
+
+// walkStructure walks the top-level structure of the size bytes in r, and the index where there is one,
+// looking for elements that overrun the file, missing required elements and index entries pointing nowhere
+// The container is recognised by its signature rather than the extension
+func walkStructure(r io.ReaderAt, size int64) (*structureCheck, error) {
+	header, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &structureCheck{size: size}
+	switch sniffContainer(header) {
+	case signatureMatroska:
+		checkMatroska(r, size, check)
+	case signatureAVI:
+		checkAVI(r, size, check)
+	case signatureBMFF:
+		checkBMFF(r, size, check)
+	default:
+		return nil, errUnsupportedContainer
+	}
+	return check, nil
+}
+
+// checkStructure fills in the structure check for the file at path, and with CheckTrailingData how much padding
+// or junk comes after the container's logical end
+func (s *Scanner) checkStructure(report *Report, path string) {
+	check, err := checkStructure(path)
+	if errors.Is(err, errUnsupportedContainer) {
+		// Left empty, as not checked, rather than failing a file there's nothing known to be wrong with
+		s.logf(LevelDebug, path, "Not checking the structure of %q: %s", path, err.Error())
+		return
+	}
+	if err != nil {
+		report.Structure = err.Error()
+		return
+	}
+	report.Structure = check.String()
+	if s.CheckTrailingData {
+		report.TrailingBytes = check.trailingBytes()
+		report.TrailingMB = fmt.Sprintf("%.2f", float64(report.TrailingBytes)/1048576)
+	}
+}
+
+// isBMFFBoxType reports whether the first box type looks like the start of an MP4/QuickTime file
+func isBMFFBoxType(boxType []byte) bool {
+	switch string(boxType) {
+	case "ftyp", "moov", "mdat", "free", "skip", "wide", "pnot":
+		return true
+	}
+	return false
+}
+
+// bmffBox is a box header from an ISO base media (MP4/MOV) file
+type bmffBox struct {
+	boxType string
+	start   int64 // Offset of the box header
+	data    int64 // Offset of the box payload
+	end     int64
+}
+
+// readBMFFBoxes reads the headers of the boxes between start and end
+func readBMFFBoxes(r io.ReaderAt, start, end int64, check *structureCheck) []bmffBox {
+	var boxes []bmffBox
+	header := make([]byte, 16)
+	for offset := start; offset < end; {
+		if end-offset < 8 {
+			check.problem("%d trailing bytes at offset %d", end-offset, offset)
+			break
+		}
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			check.problem("Unable to read box header at offset %d", offset)
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		box := bmffBox{boxType: string(header[4:8]), start: offset, data: offset + 8}
+		switch size {
+		case 0:
+			// The box runs to the end of its parent
+			size = end - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				check.problem("Unable to read large size of %q box at offset %d", box.boxType, offset)
+				return boxes
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			box.data += 8
+		}
+		if size < box.data-offset {
+			check.problem("%q box at offset %d has an invalid size of %d", box.boxType, offset, size)
+			break
+		}
+		box.end = offset + size
+		if box.end > end || box.end < offset {
+			check.problem("%q box at offset %d overruns its parent by %d bytes", box.boxType, offset, box.end-end)
+			box.end = end
+			boxes = append(boxes, box)
+			break
+		}
+		boxes = append(boxes, box)
+		offset = box.end
+	}
+	return boxes
+}
+
+func findBMFFBox(boxes []bmffBox, boxType string) *bmffBox {
+	for i := range boxes {
+		if boxes[i].boxType == boxType {
+			return &boxes[i]
+		}
+	}
+	return nil
+}
+
+// checkBMFF walks an MP4/MOV file, checking that the sample index points into the media data
+// and that the tracks are interleaved
+func checkBMFF(r io.ReaderAt, size int64, check *structureCheck) {
+	// Anything after the logical end is trailing data, not boxes, though a box overrunning the file is still a problem
+	check.logicalEnd = bmffEnd(r, size)
+	end := check.logicalEnd
+	if end > size {
+		end = size
+	}
+	boxes := readBMFFBoxes(r, 0, end, check)
+
+	moov := findBMFFBox(boxes, "moov")
+	if moov == nil {
+		check.problem("No moov box")
+		return
+	}
+	fragmented := findBMFFBox(boxes, "moof") != nil
+	var mdats []bmffBox
+	for _, box := range boxes {
+		if box.boxType == "mdat" {
+			mdats = append(mdats, box)
+		}
+	}
+	if len(mdats) == 0 {
+		check.problem("No mdat box")
+		return
+	}
+	if fragmented {
+		// Sample offsets live in the fragments, which is more than we want to chase here
+		return
+	}
+
+	type trackRange struct{ first, last int64 }
+	var tracks []trackRange
+	entries := 0
+	for _, trak := range readBMFFBoxes(r, moov.data, moov.end, check) {
+		if trak.boxType != "trak" {
+			continue
+		}
+		stbl := descendBMFF(r, trak, check, "mdia", "minf", "stbl")
+		if stbl == nil {
+			check.problem("Track at offset %d has no sample table", trak.start)
+			continue
+		}
+		offsets, err := readChunkOffsets(r, *stbl, check)
+		if err != nil {
+			check.problem("Track at offset %d: %s", trak.start, err.Error())
+			continue
+		}
+		if len(offsets) == 0 {
+			continue
+		}
+
+		track := trackRange{first: offsets[0], last: offsets[0]}
+		valid := true
+		for _, offset := range offsets {
+			entries++
+			if entries > maxIndexEntries {
+				break
+			}
+			inside := false
+			for _, mdat := range mdats {
+				if offset >= mdat.data && offset < mdat.end {
+					inside = true
+					break
+				}
+			}
+			if !inside {
+				check.problem("Track at offset %d has a chunk at %d outside the media data", trak.start, offset)
+				valid = false
+				break
+			}
+			if offset < track.first {
+				track.first = offset
+			}
+			if offset > track.last {
+				track.last = offset
+			}
+		}
+		if valid {
+			tracks = append(tracks, track)
+		}
+	}
+
+	// If one track's chunks all come after another's, players have to seek back and forth to play them together
+	for i := range tracks {
+		for j := range tracks {
+			if i != j && tracks[i].last < tracks[j].first && tracks[i].first != tracks[i].last && tracks[j].first != tracks[j].last {
+				check.problem("Tracks aren't interleaved")
+				return
+			}
+		}
+	}
+}
+
+// isPaddingBox reports whether a top-level box is only there to take up space
+func isPaddingBox(boxType []byte) bool {
+	return string(boxType) == "free" || string(boxType) == "skip"
+}
+
+// bmffEnd walks the top-level boxes of an MP4/MOV file, returning where the last one that isn't padding ends,
+// past size if it overruns the file
+// The walk stops at the first box type that isn't printable, where junk appended to the file starts
+func bmffEnd(r io.ReaderAt, size int64) int64 {
+	header := make([]byte, 16)
+	end := int64(0)
+	for offset := int64(0); offset+8 <= size; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			break
+		}
+		printable := true
+		for _, b := range header[4:8] {
+			printable = printable && b >= 0x20 && b < 0x7f
+		}
+		if !printable {
+			break
+		}
+		boxSize, headerSize := int64(binary.BigEndian.Uint32(header[0:4])), int64(8)
+		switch boxSize {
+		case 0:
+			// The box runs to the end of the file, so nothing can come after it
+			return size
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return end
+			}
+			boxSize, headerSize = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		if boxSize < headerSize || offset+boxSize < offset {
+			break
+		}
+		offset += boxSize
+		if !isPaddingBox(header[4:8]) {
+			end = offset
+		}
+	}
+	return end
+}
+
+// descendBMFF follows a path of box types down from parent
+func descendBMFF(r io.ReaderAt, parent bmffBox, check *structureCheck, path ...string) *bmffBox {
+	current := &parent
+	for _, boxType := range path {
+		current = findBMFFBox(readBMFFBoxes(r, current.data, current.end, check), boxType)
+		if current == nil {
+			return nil
+		}
+	}
+	return current
+}
+
+// readChunkOffsets reads the chunk offset table from an stbl box
+func readChunkOffsets(r io.ReaderAt, stbl bmffBox, check *structureCheck) ([]int64, error) {
+	children := readBMFFBoxes(r, stbl.data, stbl.end, check)
+	box, width := findBMFFBox(children, "stco"), int64(4)
+	if box == nil {
+		box, width = findBMFFBox(children, "co64"), 8
+	}
+	if box == nil {
+		return nil, errors.New("no chunk offset table")
+	}
+
+	// Full box header (version and flags) then the entry count
+	header := make([]byte, 8)
+	if box.end-box.data < 8 {
+		return nil, errors.New("chunk offset table is truncated")
+	}
+	if _, err := r.ReadAt(header, box.data); err != nil {
+		return nil, err
+	}
+	count := int64(binary.BigEndian.Uint32(header[4:8]))
+	if count*width > box.end-box.data-8 {
+		return nil, fmt.Errorf("chunk offset table claims %d entries but only has room for %d", count, (box.end-box.data-8)/width)
+	}
+	if count > maxIndexEntries {
+		count = maxIndexEntries
+	}
+
+	table := make([]byte, count*width)
+	if _, err := r.ReadAt(table, box.data+8); err != nil {
+		return nil, err
+	}
+	offsets := make([]int64, count)
+	for i := range offsets {
+		if width == 4 {
+			offsets[i] = int64(binary.BigEndian.Uint32(table[int64(i)*4:]))
+		} else {
+			offsets[i] = int64(binary.BigEndian.Uint64(table[int64(i)*8:]))
+		}
+	}
+	return offsets, nil
+}
+
+// Matroska element IDs we care about
+const (
+	ebmlIDHeader   uint64 = 0x1A45DFA3
+	ebmlIDSegment  uint64 = 0x18538067
+	ebmlIDSeekHead uint64 = 0x114D9B74
+	ebmlIDInfo     uint64 = 0x1549A966
+	ebmlIDTracks   uint64 = 0x1654AE6B
+	ebmlIDCues     uint64 = 0x1C53BB6B
+	ebmlIDCluster  uint64 = 0x1F43B675
+	ebmlIDVoid     uint64 = 0xEC
+
+	ebmlIDCuePoint           uint64 = 0xBB
+	ebmlIDCueTrackPositions  uint64 = 0xB7
+	ebmlIDCueClusterPosition uint64 = 0xF1
+)
+
+// ebmlElement is an element header from a Matroska/WebM file
+type ebmlElement struct {
+	id          uint64
+	start       int64
+	data        int64
+	end         int64
+	unknownSize bool
+}
+
+// readEBMLVarint reads a variable length integer at offset, returning the value and its length
+// IDs keep their length marker bits, sizes don't
+func readEBMLVarint(r io.ReaderAt, offset int64, keepMarker bool) (value uint64, length int, allOnes bool, err error) {
+	first := make([]byte, 1)
+	if _, err := r.ReadAt(first, offset); err != nil {
+		return 0, 0, false, err
+	}
+	for length = 1; length <= 8; length++ {
+		if first[0]&(0x80>>uint(length-1)) != 0 {
+			break
+		}
+	}
+	if length > 8 {
+		return 0, 0, false, errors.New("invalid variable length integer")
+	}
+
+	buf := make([]byte, length)
+	if _, err := r.ReadAt(buf, offset); err != nil {
+		return 0, 0, false, err
+	}
+	if !keepMarker {
+		buf[0] &^= 0x80 >> uint(length-1)
+	}
+	allOnes = true
+	for i, b := range buf {
+		value = value<<8 | uint64(b)
+		mask := byte(0xFF)
+		if i == 0 {
+			mask = 0xFF >> uint(length)
+		}
+		if b&mask != mask {
+			allOnes = false
+		}
+	}
+	return value, length, allOnes, nil
+}
+
+// readEBMLElement reads the element header at offset
+func readEBMLElement(r io.ReaderAt, offset int64) (ebmlElement, error) {
+	id, idLength, _, err := readEBMLVarint(r, offset, true)
+	if err != nil {
+		return ebmlElement{}, err
+	}
+	size, sizeLength, unknown, err := readEBMLVarint(r, offset+int64(idLength), false)
+	if err != nil {
+		return ebmlElement{}, err
+	}
+	element := ebmlElement{id: id, start: offset, data: offset + int64(idLength+sizeLength), unknownSize: unknown}
+	element.end = element.data + int64(size)
+	if size > math.MaxInt64/2 || element.end < element.data {
+		// Far too big to be real, make sure it's reported as overrunning its parent
+		element.end = math.MaxInt64
+	}
+	return element, nil
+}
+
+// readEBMLChildren reads the headers of the elements between start and end
+func readEBMLChildren(r io.ReaderAt, start, end int64, check *structureCheck) []ebmlElement {
+	var elements []ebmlElement
+	for offset := start; offset < end; {
+		element, err := readEBMLElement(r, offset)
+		if err != nil {
+			check.problem("Unable to read element header at offset %d", offset)
+			break
+		}
+		if element.unknownSize {
+			// Only allowed for streaming, we can't skip over it without parsing its children
+			element.end = end
+			elements = append(elements, element)
+			break
+		}
+		if element.end > end {
+			check.problem("Element %#x at offset %d overruns its parent", element.id, offset)
+			element.end = end
+			elements = append(elements, element)
+			break
+		}
+		elements = append(elements, element)
+		offset = element.end
+	}
+	return elements
+}
+
+// readEBMLUint reads an unsigned integer element's payload
+func readEBMLUint(r io.ReaderAt, element ebmlElement) (uint64, error) {
+	length := element.end - element.data
+	if length < 0 || length > 8 {
+		return 0, fmt.Errorf("invalid integer length %d", length)
+	}
+	buf := make([]byte, length)
+	if _, err := r.ReadAt(buf, element.data); err != nil {
+		return 0, err
+	}
+	var value uint64
+	for _, b := range buf {
+		value = value<<8 | uint64(b)
+	}
+	return value, nil
+}
+
+// checkMatroska walks a Matroska/WebM file's segment, checking the required elements
+// are there and that the cues point at clusters
+func checkMatroska(r io.ReaderAt, size int64, check *structureCheck) {
+	check.logicalEnd = matroskaEnd(r, size)
+	end := check.logicalEnd
+	if end > size {
+		end = size
+	}
+	top := readEBMLChildren(r, 0, end, check)
+
+	var segment *ebmlElement
+	for i := range top {
+		if top[i].id == ebmlIDSegment {
+			segment = &top[i]
+			break
+		}
+	}
+	if segment == nil {
+		check.problem("No segment element")
+		return
+	}
+
+	found := make(map[uint64]int)
+	var cues *ebmlElement
+	children := readEBMLChildren(r, segment.data, segment.end, check)
+	for i, child := range children {
+		found[child.id]++
+		if child.id == ebmlIDCues && cues == nil {
+			cues = &children[i]
+		}
+	}
+	for _, required := range []struct {
+		id   uint64
+		name string
+	}{{ebmlIDInfo, "Info"}, {ebmlIDTracks, "Tracks"}, {ebmlIDCluster, "Cluster"}} {
+		if found[required.id] == 0 {
+			check.problem("No %s element", required.name)
+		}
+	}
+	if cues == nil {
+		// Plenty of muxers leave these out, but seeking suffers without them
+		check.problem("No Cues element, seeking will be slow")
+		return
+	}
+
+	// Every cue should point at the start of a cluster, relative to the start of the segment data
+	entries := 0
+	for _, cuePoint := range readEBMLChildren(r, cues.data, cues.end, check) {
+		if cuePoint.id != ebmlIDCuePoint {
+			continue
+		}
+		for _, positions := range readEBMLChildren(r, cuePoint.data, cuePoint.end, check) {
+			if positions.id != ebmlIDCueTrackPositions {
+				continue
+			}
+			for _, position := range readEBMLChildren(r, positions.data, positions.end, check) {
+				if position.id != ebmlIDCueClusterPosition {
+					continue
+				}
+				entries++
+				if entries > maxIndexEntries {
+					return
+				}
+				relative, err := readEBMLUint(r, position)
+				if err != nil {
+					check.problem("Unreadable cue at offset %d", position.start)
+					return
+				}
+				target := segment.data + int64(relative)
+				cluster, err := readEBMLElement(r, target)
+				if err != nil || cluster.id != ebmlIDCluster {
+					check.problem("Cue at offset %d points at %d, which isn't a cluster", position.start, target)
+					return
+				}
+			}
+		}
+	}
+}
+
+// matroskaEnd walks the top-level elements of a Matroska/WebM file, the EBML header and segments, returning where
+// the last one ends, past size if it overruns the file
+// The walk stops at the first element that can't be at the top level, where junk appended to the file starts,
+// and Void elements after the last segment are padding
+func matroskaEnd(r io.ReaderAt, size int64) int64 {
+	end := int64(0)
+	for offset := int64(0); offset < size; {
+		element, err := readEBMLElement(r, offset)
+		if err != nil || (element.id != ebmlIDHeader && element.id != ebmlIDSegment && element.id != ebmlIDVoid) {
+			break
+		}
+		if element.unknownSize {
+			// A live stream's segment runs to the end of the file
+			return size
+		}
+		offset = element.end
+		if element.id != ebmlIDVoid {
+			end = offset
+		}
+	}
+	return end
+}
+
+// checkAVI walks a RIFF AVI file, checking for the headers, the movie data and the index
+func checkAVI(r io.ReaderAt, size int64, check *structureCheck) {
+	header := make([]byte, 12)
+	// RIFF files can be chained past 1GB with RIFF AVIX chunks, so walk them all
+	offset := int64(0)
+	first := true
+	found := make(map[string]bool)
+	for offset < size {
+		if size-offset < 12 {
+			// Too short to be another RIFF chunk, so it's trailing data
+			break
+		}
+		if _, err := r.ReadAt(header, offset); err != nil {
+			check.problem("Unable to read RIFF header at offset %d", offset)
+			break
+		}
+		if string(header[0:4]) != "RIFF" {
+			// Anything after the last RIFF chunk isn't part of the file
+			break
+		}
+		riffEnd := offset + 8 + int64(binary.LittleEndian.Uint32(header[4:8]))
+		if riffEnd > size {
+			check.problem("RIFF chunk at offset %d overruns the file by %d bytes", offset, riffEnd-size)
+			riffEnd = size
+		}
+
+		chunk := make([]byte, 12)
+		for position := offset + 12; position+8 <= riffEnd; {
+			if _, err := r.ReadAt(chunk, position); err != nil && !errors.Is(err, io.EOF) {
+				check.problem("Unable to read chunk at offset %d", position)
+				break
+			}
+			id := string(chunk[0:4])
+			if id == "LIST" {
+				id = "LIST " + string(chunk[8:12])
+			}
+			found[id] = true
+			chunkEnd := position + 8 + int64(binary.LittleEndian.Uint32(chunk[4:8]))
+			if chunkEnd > riffEnd {
+				check.problem("%q chunk at offset %d overruns its RIFF chunk by %d bytes", id, position, chunkEnd-riffEnd)
+				break
+			}
+			// Chunks are padded to an even length
+			position = chunkEnd + chunkEnd%2
+		}
+
+		if first && !found["LIST hdrl"] {
+			check.problem("No hdrl header list")
+		}
+		first = false
+		offset = riffEnd + riffEnd%2
+		check.logicalEnd = offset
+	}
+
+	if !found["LIST movi"] {
+		check.problem("No movi list")
+	}
+	if !found["idx1"] {
+		check.problem("No index, seeking will be slow")
+	}
+}
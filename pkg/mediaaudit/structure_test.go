@@ -0,0 +1,208 @@
+package mediaaudit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// bmffTestBox builds an MP4 box of boxType around payload
+func bmffTestBox(boxType string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	box := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(box[0:4], uint32(8+len(data)))
+	copy(box[4:8], boxType)
+	return append(box, data...)
+}
+
+// testMP4 builds a minimal MP4 with one track whose only chunk is in the mdat box
+func testMP4() []byte {
+	ftyp := bmffTestBox("ftyp", []byte("isom\x00\x00\x02\x00isom"))
+	moov := func(chunk uint32) []byte {
+		stco := make([]byte, 12)
+		binary.BigEndian.PutUint32(stco[4:8], 1)
+		binary.BigEndian.PutUint32(stco[8:12], chunk)
+		return bmffTestBox("moov", bmffTestBox("trak", bmffTestBox("mdia", bmffTestBox("minf", bmffTestBox("stbl", bmffTestBox("stco", stco))))))
+	}
+	// The chunk offset doesn't change the size of the moov box, so it can be worked out from a placeholder
+	chunk := uint32(len(ftyp) + len(moov(0)) + 8)
+	return bytes.Join([][]byte{ftyp, moov(chunk), bmffTestBox("mdat", []byte("sample data"))}, nil)
+}
+
+// ebmlTestElement builds a Matroska element with id around payload, with an 8 byte size
+func ebmlTestElement(id uint64, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	var element []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> uint(shift)); b != 0 || len(element) > 0 {
+			element = append(element, b)
+		}
+	}
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(data)))
+	size[0] = 0x01
+	return append(append(element, size...), data...)
+}
+
+// testMKV builds a minimal Matroska file with one cluster and a cue pointing at it
+func testMKV() []byte {
+	header := ebmlTestElement(ebmlIDHeader, ebmlTestElement(0x4286, []byte{1}))
+	info := ebmlTestElement(ebmlIDInfo, ebmlTestElement(0x2AD7B1, []byte{0x0F, 0x42, 0x40}))
+	tracks := ebmlTestElement(ebmlIDTracks)
+	cluster := ebmlTestElement(ebmlIDCluster, ebmlTestElement(0xE7, []byte{0}))
+	cues := func(position uint64) []byte {
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, position)
+		return ebmlTestElement(ebmlIDCues, ebmlTestElement(ebmlIDCuePoint, ebmlTestElement(ebmlIDCueTrackPositions, ebmlTestElement(ebmlIDCueClusterPosition, value))))
+	}
+	// As with the MP4, the cue's position doesn't change the size of the cues
+	position := uint64(len(info) + len(tracks) + len(cues(0)))
+	return append(header, ebmlTestElement(ebmlIDSegment, info, tracks, cues(position), cluster)...)
+}
+
+// riffTestChunk builds a RIFF chunk of id around payload, padded to an even length
+func riffTestChunk(id string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	chunk := make([]byte, 8, 9+len(data))
+	copy(chunk[0:4], id)
+	binary.LittleEndian.PutUint32(chunk[4:8], uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// testAVI builds a minimal AVI with a header list, one frame and an index
+func testAVI() []byte {
+	hdrl := riffTestChunk("LIST", []byte("hdrl"), riffTestChunk("avih", make([]byte, 56)))
+	movi := riffTestChunk("LIST", []byte("movi"), riffTestChunk("00dc", []byte("frame")))
+	idx1 := riffTestChunk("idx1", make([]byte, 16))
+	return riffTestChunk("RIFF", []byte("AVI "), hdrl, movi, idx1)
+}
+
+func TestWalkStructure(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"MP4", testMP4(), "ok"},
+		{"Matroska", testMKV(), "ok"},
+		{"AVI", testAVI(), "ok"},
+		{"MP4 without media data", testMP4()[:len(testMP4())-len(bmffTestBox("mdat", []byte("sample data")))], "No mdat box"},
+		{"AVI without an index", riffTestChunk("RIFF", []byte("AVI "), riffTestChunk("LIST", []byte("hdrl")), riffTestChunk("LIST", []byte("movi"))), "No index, seeking will be slow"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			check, err := walkStructure(bytes.NewReader(test.data), int64(len(test.data)))
+			if err != nil {
+				t.Fatalf("walkStructure() error = %v", err)
+			}
+			if got := check.String(); got != test.want {
+				t.Errorf("walkStructure() = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	data := []byte("\x47 a transport stream, say")
+	if _, err := walkStructure(bytes.NewReader(data), int64(len(data))); !errors.Is(err, errUnsupportedContainer) {
+		t.Errorf("walkStructure() error = %v, want %v", err, errUnsupportedContainer)
+	}
+}
+
+func TestBMFFEnd(t *testing.T) {
+	mp4 := testMP4()
+	end := int64(len(mp4))
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	large := []byte{0, 0, 0, 1, 'w', 'i', 'd', 'e', 0, 0, 0, 0, 0, 0, 0, 20, 1, 2, 3, 4}
+	tests := []struct {
+		name string
+		data []byte
+		want int64
+	}{
+		{"clean", mp4, end},
+		{"free box", join(mp4, bmffTestBox("free", make([]byte, 100))), end},
+		{"free and skip boxes", join(mp4, bmffTestBox("free"), bmffTestBox("skip", []byte("padding"))), end},
+		{"junk", join(mp4, make([]byte, 100)), end},
+		{"free box then junk", join(mp4, bmffTestBox("free", make([]byte, 10)), []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x80, 0x81, 0x82, 0x83}), end},
+		{"free box before the media data", join(mp4[:len(mp4)-19], bmffTestBox("free"), mp4[len(mp4)-19:]), end + 8},
+		{"large size", join(mp4, large), end + int64(len(large))},
+		{"runs to the end of the file", join(mp4, []byte{0, 0, 0, 0, 'm', 'd', 'a', 't'}, make([]byte, 50)), end + 58},
+		{"overruns the file", mp4[:end-5], end},
+		{"too short for a box header", join(mp4, []byte("free")), end},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := bmffEnd(bytes.NewReader(test.data), int64(len(test.data))); got != test.want {
+				t.Errorf("bmffEnd() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatroskaEnd(t *testing.T) {
+	mkv := testMKV()
+	end := int64(len(mkv))
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	// A live stream's segment has an unknown size, all ones
+	live := join(ebmlTestElement(ebmlIDHeader), []byte{0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, ebmlTestElement(ebmlIDCluster))
+	tests := []struct {
+		name string
+		data []byte
+		want int64
+	}{
+		{"clean", mkv, end},
+		{"void element", join(mkv, ebmlTestElement(ebmlIDVoid, make([]byte, 100))), end},
+		{"junk", join(mkv, make([]byte, 100)), end},
+		{"void element then junk", join(mkv, ebmlTestElement(ebmlIDVoid), []byte("not an element")), end},
+		{"cluster after the segment", join(mkv, ebmlTestElement(ebmlIDCluster)), end},
+		{"unknown size", live, int64(len(live))},
+		{"overruns the file", mkv[:end-5], end},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matroskaEnd(bytes.NewReader(test.data), int64(len(test.data))); got != test.want {
+				t.Errorf("matroskaEnd() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWalkStructureTrailing(t *testing.T) {
+	// RIFF chunks are padded to an even length, the pad byte isn't trailing data
+	odd := riffTestChunk("RIFF", []byte("AVI "), riffTestChunk("LIST", []byte("hdrl")), riffTestChunk("LIST", []byte("movi")), riffTestChunk("idx1", []byte("x")), []byte("y"))
+	tests := []struct {
+		name     string
+		data     []byte
+		want     string
+		trailing int64
+	}{
+		{"MP4 with junk", append(testMP4(), make([]byte, 1000)...), "ok", 1000},
+		{"Matroska with padding", append(testMKV(), ebmlTestElement(ebmlIDVoid, make([]byte, 100))...), "ok", 109},
+		{"AVI with a few stray bytes", append(testAVI(), "abc"...), "ok", 3},
+		{"AVI padded to an even length", odd, "ok", 0},
+		{"MP4 cut short", testMP4()[:len(testMP4())-5], `"mdat" box at offset`, 0},
+		{"Matroska cut short", testMKV()[:len(testMKV())-5], "Element 0x18538067 at offset", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			check, err := walkStructure(bytes.NewReader(test.data), int64(len(test.data)))
+			if err != nil {
+				t.Fatalf("walkStructure() error = %v", err)
+			}
+			if got := check.String(); !strings.HasPrefix(got, test.want) {
+				t.Errorf("walkStructure() = %q, want %q", got, test.want)
+			}
+			if got := check.trailingBytes(); got != test.trailing {
+				t.Errorf("trailingBytes() = %d, want %d", got, test.trailing)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package mediaaudit
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Two letter ISO 639-1 codes that commonly show up in sidecar subtitle names, mapped to the ISO 639-2 codes mediainfo uses
+var iso6391To6392 map[string]string = map[string]string{
+	"ar": "ara", "cs": "ces", "da": "dan", "de": "deu", "el": "ell",
+	"en": "eng", "es": "spa", "fi": "fin", "fr": "fra", "he": "heb",
+	"hi": "hin", "hu": "hun", "it": "ita", "ja": "jpn", "ko": "kor",
+	"nl": "nld", "no": "nor", "pl": "pol", "pt": "por", "ro": "ron",
+	"ru": "rus", "sv": "swe", "th": "tha", "tr": "tur", "uk": "ukr",
+	"vi": "vie", "zh": "zho",
+}
+
+// captionFormats are the closed caption formats broadcasters embed in the video stream, as mediainfo names them
+var captionFormats map[string]bool = map[string]bool{"EIA-608": true, "EIA-708": true}
+
+// Three letter tags that show up in sidecar names but aren't languages
+var nonLanguageTags map[string]bool = map[string]bool{"sdh": true, "dub": true, "sub": true}
+
+// sidecarSubtitles finds subtitle files next to the video at path that share its name,
+// e.g. Movie.en.srt or Movie.eng.forced.srt for Movie.mkv, and returns the language of each
+func sidecarSubtitles(path string) []string {
+	dir := filepath.Dir(path)
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var languages []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !subtitleFileRegex.MatchString(name) || !strings.HasPrefix(name, base) {
+			continue
+		}
+		tags := strings.TrimSuffix(strings.TrimPrefix(name, base), filepath.Ext(name))
+		// Make sure we didn't just match the start of a longer name, like Movie 2.srt for Movie.mkv
+		if tags != "" && tags[0] != '.' && tags[0] != '_' && tags[0] != '-' {
+			continue
+		}
+		languages = append(languages, sidecarLanguage(tags))
+	}
+	return languages
+}
+
+// sidecarLanguage picks the language out of the tags between the video name and the extension,
+// e.g. .eng.forced, ignoring anything that doesn't look like a language code
+func sidecarLanguage(tags string) string {
+	for _, tag := range strings.FieldsFunc(strings.ToLower(tags), func(r rune) bool { return r == '.' || r == '_' || r == '-' }) {
+		if code, ok := iso6391To6392[tag]; ok {
+			return code
+		}
+		if len(tag) == 3 && strings.IndexFunc(tag, func(r rune) bool { return !unicode.IsLetter(r) }) == -1 && !nonLanguageTags[tag] {
+			return tag
+		}
+	}
+	return "und"
+}
+
+// checkSubtitleLanguages merges sidecar subtitles into the report and fills in
+// which of the required languages have no subtitles at all
+func checkSubtitleLanguages(report *Report, sidecars []string, required []string) {
+	present := make(map[string]bool)
+	for _, language := range append(report.SubtitleLanguages, sidecars...) {
+		present[strings.ToLower(language)] = true
+	}
+
+	report.SubtitleLanguages = report.SubtitleLanguages[:0]
+	for language := range present {
+		report.SubtitleLanguages = append(report.SubtitleLanguages, language)
+	}
+	sort.Strings(report.SubtitleLanguages)
+
+	report.MissingSubtitleLanguages = nil
+	for _, language := range required {
+		if !present[strings.ToLower(language)] {
+			report.MissingSubtitleLanguages = append(report.MissingSubtitleLanguages, language)
+		}
+	}
+}
+
+// checkCaptions flags the report if captions are required but it has none
+func checkCaptions(report *Report, required bool) {
+	report.MissingCaptions = required && len(report.Captions) == 0
+}
@@ -0,0 +1,122 @@
+package mediaaudit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// ErrMemoryLimitUnsupported is returned by WithLimits on platforms where tool memory can't be capped
+var ErrMemoryLimitUnsupported error = errors.New("Limiting the memory of probes isn't supported on this platform")
+
+// Limits caps the resources used by the tools probing files, mediainfo and ffmpeg
+type Limits struct {
+	Processes int64  // How many tool processes can run at once, others wait their turn, unlimited if 0
+	Memory    uint64 // Address space limit for each tool process in bytes, unlimited if 0 (Linux only, see toolCommand)
+}
+
+type limitsKey struct{}
+
+// toolLimits is Limits ready to apply
+type toolLimits struct {
+	processes *semaphore.Weighted
+	memory    uint64
+}
+
+// WithLimits returns a context that applies limits to every tool run with it
+func WithLimits(ctx context.Context, limits Limits) (context.Context, error) {
+	if limits.Memory > 0 && !memoryLimitSupported {
+		return ctx, ErrMemoryLimitUnsupported
+	}
+	applied := &toolLimits{memory: limits.Memory}
+	if limits.Processes > 0 {
+		applied.processes = semaphore.NewWeighted(limits.Processes)
+	}
+	return context.WithValue(ctx, limitsKey{}, applied), nil
+}
+
+// toolCmd is an exec.Cmd that honours the sandbox and limits in its context
+type toolCmd struct {
+	*exec.Cmd
+	ctx       context.Context
+	prlimited bool // Whether the command was wrapped in prlimit, so its memory is already limited
+}
+
+// toolCommand is exec.CommandContext for the tools that parse the files we scan,
+// sandboxed if ctx came from WithSandbox, and limited if it came from WithLimits
+// A memory limit is applied by running the tool under prlimit where it's installed,
+// otherwise only once the tool has started, which a tool that allocates straight away can beat
+func toolCommand(ctx context.Context, name string, args ...string) *toolCmd {
+	prlimited := false
+	if limits, _ := ctx.Value(limitsKey{}).(*toolLimits); limits != nil && limits.memory > 0 {
+		name, args, prlimited = limitedCommand(limits.memory, name, args)
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	if sandboxed, _ := ctx.Value(sandboxKey{}).(bool); sandboxed {
+		sandbox(cmd)
+	}
+	return &toolCmd{Cmd: cmd, ctx: ctx, prlimited: prlimited}
+}
+
+// Run waits for a free process slot, then starts the tool and waits for it to finish
+// Without prlimit, the memory limit is applied as soon as the process has started
+func (t *toolCmd) Run() error {
+	limits, _ := t.ctx.Value(limitsKey{}).(*toolLimits)
+	if limits != nil && limits.processes != nil {
+		if err := limits.processes.Acquire(t.ctx, 1); err != nil {
+			return err
+		}
+		defer limits.processes.Release(1)
+	}
+
+	if err := t.Cmd.Start(); err != nil {
+		return err
+	}
+	if limits != nil && limits.memory > 0 && !t.prlimited {
+		if err := limitMemory(t.Process.Pid, limits.memory); err != nil {
+			t.Process.Kill()
+			t.Cmd.Wait()
+			return err
+		}
+	}
+	return t.Cmd.Wait()
+}
+
+// Output is exec.Cmd.Output, going through Run
+func (t *toolCmd) Output() ([]byte, error) {
+	var stdout bytes.Buffer
+	t.Stdout = &stdout
+	err := t.Run()
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput is exec.Cmd.CombinedOutput, going through Run
+func (t *toolCmd) CombinedOutput() ([]byte, error) {
+	var output bytes.Buffer
+	t.Stdout = &output
+	t.Stderr = &output
+	err := t.Run()
+	return output.Bytes(), err
+}
+
+// runFFmpegFilter runs ffmpeg with args, which should name the input and the filters to run, discarding the output
+// ffmpeg writes filter results to stderr, so that's returned, and on failure its last line explains why
+func runFFmpegFilter(ctx context.Context, args ...string) (string, error) {
+	args = append([]string{"-hide_banner", "-nostdin", "-nostats"}, args...)
+	output, err := toolCommand(ctx, "ffmpeg", append(args, "-f", "null", "-")...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, lastLine(string(output)))
+	}
+	return string(output), nil
+}
+
+// lastLine returns the last non-empty line of output, which is where ffmpeg puts the reason it failed
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
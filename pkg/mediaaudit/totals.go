@@ -0,0 +1,38 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"io"
+)
+
+// TotalsWriter is a Writer that counts the files in the report and adds up their size, both as listed and counting
+// files hardlinked to each other only once, and prints both when closed
+type TotalsWriter struct {
+	out      io.Writer
+	files    int
+	sizeMB   float64
+	uniqueMB float64
+	seen     map[string]bool
+}
+
+// NewTotalsWriter returns a TotalsWriter that prints to out
+func NewTotalsWriter(out io.Writer) *TotalsWriter {
+	return &TotalsWriter{out: out, seen: make(map[string]bool)}
+}
+
+func (w *TotalsWriter) Write(report *Report) error {
+	w.files++
+	w.sizeMB += report.SizeMB
+	if !w.seen[report.ID] {
+		w.seen[report.ID] = true
+		w.uniqueMB += report.SizeMB
+	}
+	return nil
+}
+
+// Close prints the totals, the apparent size being what adding up SizeMB gives and the unique size what's
+// actually taken up on disk
+func (w *TotalsWriter) Close() error {
+	_, err := fmt.Fprintf(w.out, "Scanned %d files, %.2f GiB apparent, %.2f GiB unique counting hardlinked files once\n", w.files, w.sizeMB/1024, w.uniqueMB/1024)
+	return err
+}
@@ -0,0 +1,108 @@
+package mediaaudit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// minTruncateBytes is the least trailing data worth truncating, a few stray bytes aren't worth touching the file for
+const minTruncateBytes = 1 << 20
+
+// Truncation is a file with trailing data that can be cut off
+type Truncation struct {
+	Path          string
+	Name          string    // As in the report
+	TrailingBytes int64     // How much to cut off the end
+	Modified      time.Time // When the file was modified as of the scan, it isn't touched if that's changed
+	Skipped       string    // Why the file won't be truncated, empty if it will be
+}
+
+// Apply truncates the file, after walking it again to make sure it still ends where it did during the scan
+func (t Truncation) Apply() error {
+	if t.Skipped != "" {
+		return fmt.Errorf("Not truncating %q: %s", t.Path, t.Skipped)
+	}
+	info, err := os.Stat(t.Path)
+	if err != nil {
+		return err
+	}
+	if !info.ModTime().Equal(t.Modified) {
+		return fmt.Errorf("Not truncating %q, it has changed since it was scanned", t.Path)
+	}
+	check, err := checkStructure(t.Path)
+	if err != nil {
+		return err
+	}
+	if len(check.problems) > 0 || check.trailingBytes() != t.TrailingBytes {
+		return fmt.Errorf("Not truncating %q, its structure has changed since it was scanned", t.Path)
+	}
+	return os.Truncate(t.Path, check.logicalEnd)
+}
+
+// TruncationWriter collects the files with trailing data so a plan to truncate them can be made once the scan finishes
+type TruncationWriter struct {
+	reports []*Report
+	seen    map[string]bool
+}
+
+// NewTruncationWriter returns an empty TruncationWriter
+func NewTruncationWriter() *TruncationWriter {
+	return &TruncationWriter{seen: make(map[string]bool)}
+}
+
+func (w *TruncationWriter) Write(report *Report) error {
+	// Hardlinks only need truncating once, and a package's files are left as the package lists them
+	if report.Package != "" || report.TrailingBytes < minTruncateBytes || w.seen[report.ID] {
+		return nil
+	}
+	w.seen[report.ID] = true
+	w.reports = append(w.reports, report)
+	return nil
+}
+
+func (w *TruncationWriter) Close() error {
+	return nil
+}
+
+// Plan lists the files with trailing data, largest first
+// Only files whose structure is otherwise sound are truncated, since anywhere else the logical end can't be trusted
+func (w *TruncationWriter) Plan() []Truncation {
+	var plan []Truncation
+	for _, report := range w.reports {
+		truncation := Truncation{Path: report.Path, Name: report.Name, TrailingBytes: report.TrailingBytes, Modified: report.Modified}
+		if report.Structure != "ok" {
+			truncation.Skipped = fmt.Sprintf("structure problem: %s", report.Structure)
+		}
+		plan = append(plan, truncation)
+	}
+	sort.SliceStable(plan, func(i, j int) bool {
+		return plan[i].TrailingBytes > plan[j].TrailingBytes
+	})
+	return plan
+}
+
+// WriteTruncationPlan prints the plan and how much space truncating would reclaim
+func WriteTruncationPlan(out io.Writer, plan []Truncation) error {
+	files := 0
+	var reclaimable int64
+	for _, truncation := range plan {
+		if truncation.Skipped == "" {
+			files++
+			reclaimable += truncation.TrailingBytes
+		}
+	}
+	fmt.Fprintf(out, "Truncation plan reclaims %.2f GiB of trailing data from %d of %d files:\n", float64(reclaimable)/(1<<30), files, len(plan))
+	table := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, truncation := range plan {
+		action := "truncate"
+		if truncation.Skipped != "" {
+			action = "skip, " + truncation.Skipped
+		}
+		fmt.Fprintf(table, "%s\t%.2f MB\t%s\n", truncation.Name, float64(truncation.TrailingBytes)/1048576, action)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,86 @@
+package mediaaudit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTruncationTest writes data to a temporary file, returning a truncation for everything after the MP4
+func writeTruncationTest(t *testing.T, data []byte) Truncation {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "Movie (2010).mp4")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Truncation{Path: path, Name: filepath.Base(path), TrailingBytes: int64(len(data) - len(testMP4())), Modified: info.ModTime()}
+}
+
+func TestTruncationApply(t *testing.T) {
+	mp4 := testMP4()
+	junk := append(append([]byte{}, mp4...), bytes.Repeat([]byte{0}, 4096)...)
+
+	t.Run("truncates to the logical end", func(t *testing.T) {
+		truncation := writeTruncationTest(t, junk)
+		if err := truncation.Apply(); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		data, err := os.ReadFile(truncation.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, mp4) {
+			t.Errorf("Apply() left %d bytes, want the %d of the MP4", len(data), len(mp4))
+		}
+	})
+
+	// None of these should touch the file
+	tests := []struct {
+		name   string
+		change func(truncation *Truncation)
+	}{
+		{"skipped", func(truncation *Truncation) {
+			truncation.Skipped = "structure problem"
+		}},
+		{"modified since the scan", func(truncation *Truncation) {
+			truncation.Modified = truncation.Modified.Add(-time.Hour)
+		}},
+		{"trailing data changed since the scan", func(truncation *Truncation) {
+			truncation.TrailingBytes -= 1024
+		}},
+		{"deleted since the scan", func(truncation *Truncation) {
+			os.Remove(truncation.Path)
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			truncation := writeTruncationTest(t, junk)
+			test.change(&truncation)
+			if err := truncation.Apply(); err == nil {
+				t.Fatalf("Apply() succeeded")
+			}
+			if data, err := os.ReadFile(truncation.Path); err == nil && !bytes.Equal(data, junk) {
+				t.Errorf("Apply() changed the file")
+			}
+		})
+	}
+
+	t.Run("structure problem found on the second walk", func(t *testing.T) {
+		// Without its media data the file's logical end can't be trusted, however much trailing data there is
+		broken := append(append([]byte{}, mp4[:len(mp4)-len(bmffTestBox("mdat", []byte("sample data")))]...), bytes.Repeat([]byte{0}, 4096)...)
+		truncation := writeTruncationTest(t, broken)
+		truncation.TrailingBytes = 4096
+		if err := truncation.Apply(); err == nil {
+			t.Fatalf("Apply() succeeded")
+		}
+		if data, err := os.ReadFile(truncation.Path); err != nil || !bytes.Equal(data, broken) {
+			t.Errorf("Apply() changed the file")
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package mediaaudit
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// inProgram reports whether a stream belongs to program, always true outside of transport streams
+func inProgram(streamProgram, program string) bool {
+	return program == "" || streamProgram == "" || streamProgram == program
+}
+
+// bdmvClip returns the folder an AVCHD or Blu-ray clip was imported in and the clip's name,
+// e.g. Holiday and 00001.MTS for Holiday/PRIVATE/AVCHD/BDMV/STREAM/00001.MTS
+// Every camcorder numbers its clips from 00000, so the clip's name alone is meaningless
+func bdmvClip(path string) (string, string, bool) {
+	stream := filepath.Dir(path)
+	bdmv := filepath.Dir(stream)
+	if !strings.EqualFold(filepath.Base(stream), "STREAM") || !strings.EqualFold(filepath.Base(bdmv), "BDMV") {
+		return "", "", false
+	}
+
+	folder := filepath.Dir(bdmv)
+	if strings.EqualFold(filepath.Base(folder), "AVCHD") {
+		folder = filepath.Dir(folder)
+		if strings.EqualFold(filepath.Base(folder), "PRIVATE") {
+			folder = filepath.Dir(folder)
+		}
+	}
+	return folder, filepath.Base(path), true
+}
@@ -0,0 +1,234 @@
+package mediaaudit
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Writer receives reports as a scan produces them
+// Implementations don't need to be safe for concurrent use, the Scanner serializes writes
+type Writer interface {
+	Write(report *Report) error
+	Close() error
+}
+
+// CSVWriter streams each report straight out as a CSV row
+type CSVWriter struct {
+	writer       *csv.Writer
+	extraColumns []string
+	columns      []int // Which columns to write, by their index in a row, nil for all of them
+	started      bool  // Whether the header row has been written
+}
+
+// NewCSVWriter returns a CSVWriter that writes the header row to w ahead of the first report
+// extraColumns are added after ReportHeaders, see Scanner.ExtraColumns
+func NewCSVWriter(w io.Writer, extraColumns []string) *CSVWriter {
+	return &CSVWriter{writer: csv.NewWriter(w), extraColumns: extraColumns}
+}
+
+// SelectColumns writes only the named columns, in that order, rather than all of them
+// It must be called before the first report is written
+func (c *CSVWriter) SelectColumns(names []string) error {
+	columns, err := columnIndexes(c.extraColumns, names)
+	if err != nil {
+		return err
+	}
+	c.columns = columns
+	return nil
+}
+
+// start writes the header row if it hasn't been yet
+func (c *CSVWriter) start() {
+	if !c.started {
+		c.started = true
+		c.writer.Write(pickColumns(append(append([]string{}, ReportHeaders...), c.extraColumns...), c.columns))
+	}
+}
+
+func (c *CSVWriter) Write(report *Report) error {
+	c.start()
+	c.writer.Write(pickColumns(report.Row(c.extraColumns), c.columns))
+	// Flush on every row so partial results are visible during long scans
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *CSVWriter) Close() error {
+	c.start()
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// CheckColumns returns an error if any of names isn't one of ReportHeaders or extraColumns
+func CheckColumns(extraColumns, names []string) error {
+	_, err := columnIndexes(extraColumns, names)
+	return err
+}
+
+// columnIndexes finds where each of names is in a row with extraColumns, nil if names is empty
+func columnIndexes(extraColumns, names []string) ([]int, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	headers := append(append([]string{}, ReportHeaders...), extraColumns...)
+	var columns []int
+	for _, name := range names {
+		found := false
+		for i, header := range headers {
+			if strings.EqualFold(header, name) {
+				columns = append(columns, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown column %q", name)
+		}
+	}
+	return columns, nil
+}
+
+// pickColumns returns the values in row at columns, or row itself if columns is nil
+func pickColumns(row []string, columns []int) []string {
+	if columns == nil {
+		return row
+	}
+	picked := make([]string, len(columns))
+	for i, column := range columns {
+		picked[i] = row[column]
+	}
+	return picked
+}
+
+// TableWriter buffers every report and renders an aligned table on Close
+// It's meant for interactive use, where raw CSV wraps badly
+type TableWriter struct {
+	out          io.Writer
+	rows         [][]string
+	extraColumns []string
+	columns      []int // Which columns to show, by their index in a row, nil for all of them
+	width        int   // Terminal width, 0 if unknown
+	fullWidth    bool  // Don't truncate to fit the terminal
+}
+
+// NewTableWriter returns a TableWriter that fits its output into width columns,
+// unless width is 0 or fullWidth is set
+// extraColumns are added after ReportHeaders, see Scanner.ExtraColumns
+func NewTableWriter(out io.Writer, extraColumns []string, width int, fullWidth bool) *TableWriter {
+	headers := append(append([]string{}, ReportHeaders...), extraColumns...)
+	return &TableWriter{out: out, rows: [][]string{headers}, extraColumns: extraColumns, width: width, fullWidth: fullWidth}
+}
+
+// SelectColumns shows only the named columns, in that order, rather than all of them
+func (t *TableWriter) SelectColumns(names []string) error {
+	columns, err := columnIndexes(t.extraColumns, names)
+	if err != nil {
+		return err
+	}
+	t.columns = columns
+	return nil
+}
+
+func (t *TableWriter) Write(report *Report) error {
+	t.rows = append(t.rows, report.Row(t.extraColumns))
+	return nil
+}
+
+func (t *TableWriter) Close() error {
+	for i, row := range t.rows {
+		t.rows[i] = pickColumns(row, t.columns)
+	}
+	if !t.fullWidth && t.width > 0 {
+		t.truncate()
+	}
+
+	tw := tabwriter.NewWriter(t.out, 0, 0, 2, ' ', 0)
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// truncate shortens the name column so that each row fits in the terminal
+// Names are cut from the front since the end of a path is the interesting part
+func (t *TableWriter) truncate() {
+	const padding = 2
+	const minNameWidth = 12
+	nameColumn := -1
+	for i, header := range t.rows[0] {
+		if header == "Name" {
+			nameColumn = i
+		}
+	}
+	if nameColumn < 0 {
+		return
+	}
+
+	var widths []int
+	for _, row := range t.rows {
+		for i, value := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if l := len([]rune(value)); l > widths[i] {
+				widths[i] = l
+			}
+		}
+	}
+
+	total := 0
+	for _, w := range widths {
+		total += w + padding
+	}
+	if total <= t.width {
+		return
+	}
+
+	nameWidth := widths[nameColumn] - (total - t.width)
+	if nameWidth < minNameWidth {
+		nameWidth = minNameWidth
+	}
+	for _, row := range t.rows {
+		if len(row) <= nameColumn {
+			continue
+		}
+		name := []rune(row[nameColumn])
+		if len(name) > nameWidth {
+			row[nameColumn] = "…" + string(name[len(name)-nameWidth+1:])
+		}
+	}
+}
+
+// MultiWriter sends every report to each of its writers in turn
+type MultiWriter struct {
+	writers []Writer
+}
+
+// NewMultiWriter returns a Writer that writes to, and closes, all of writers
+func NewMultiWriter(writers ...Writer) *MultiWriter {
+	return &MultiWriter{writers: writers}
+}
+
+// Write stops at the first writer to fail
+func (m *MultiWriter) Write(report *Report) error {
+	for _, w := range m.writers {
+		if err := w.Write(report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every writer, even if one fails, and returns the first error
+func (m *MultiWriter) Close() error {
+	var firstErr error
+	for _, w := range m.writers {
+		if err := w.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
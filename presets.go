@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// preset is a bundle of flags for a common kind of library, so a single -preset gives useful output
+type preset struct {
+	name     string
+	settings [][2]string // Flag names and values
+}
+
+// presets are applied after the command line, environment and config file, to whatever flags they left unset
+// The specs they name are the built-in ones mediaaudit init writes
+var presets = []preset{
+	{"homelab-streaming", [][2]string{
+		// Files should direct play, be found by Plex/Jellyfin and not be broken, and walking the container is cheap
+		{"spec", "streaming"},
+		{"check-naming", "true"},
+		{"check-aspect-ratio", "true"},
+		{"verify", "structure"},
+		{"group-parts", "true"},
+		{"order", "newest-first"},
+		{"path-style", "relative"},
+		{"report-card", "true"},
+		{"columns", "Name,Container,Codec,Width,Height,BitrateMbps,SizeMB,AudioLanguages,SubtitleLanguages,Structure,Naming,AspectRatio,Spec"},
+	}},
+	{"archival", [][2]string{
+		// Files should still be readable in years to come, so decode everything, and retry network storage
+		{"spec", "archive"},
+		{"verify", "decode"},
+		{"retries", "2"},
+		{"path-style", "relative"},
+		{"report-card", "true"},
+		{"columns", "Name,Container,Codec,CodecProfile,SizeMB,DurationSeconds,Modified,Hardlinks,Decode,Spec"},
+	}},
+	{"minimal", [][2]string{
+		// What's in the library, as fast as mediainfo can say
+		{"verify", "none"},
+		{"columns", "Name,Container,Codec,Width,Height,BitrateMbps,SizeMB,DurationSeconds,AudioLanguages,SubtitleLanguages"},
+	}},
+}
+
+// presetNames lists every preset, for help and error messages
+func presetNames() []string {
+	var names []string
+	for _, p := range presets {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+// applyPreset sets the flags in the named preset that haven't been set already, returning the names of those it set
+func applyPreset(name string, flags *flag.FlagSet) ([]string, error) {
+	for _, p := range presets {
+		if p.name != name {
+			continue
+		}
+
+		alreadySet := make(map[string]bool)
+		flags.Visit(func(f *flag.Flag) {
+			alreadySet[f.Name] = true
+		})
+		var set []string
+		for _, setting := range p.settings {
+			if alreadySet[setting[0]] {
+				continue
+			}
+			if err := flags.Set(setting[0], setting[1]); err != nil {
+				return nil, fmt.Errorf("Preset %s: %w", name, err)
+			}
+			set = append(set, setting[0])
+		}
+		return set, nil
+	}
+	return nil, fmt.Errorf("Unknown preset %q, expected one of %s", name, strings.Join(presetNames(), ", "))
+}
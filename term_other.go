@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+// terminalWidth returns the number of columns of the terminal, or 0 if unknown
+// We can't ask the terminal directly here, so rely on the shell telling us
+func terminalWidth(f *os.File) int {
+	cols, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	return cols
+}
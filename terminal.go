@@ -0,0 +1,12 @@
+package main
+
+import "os"
+
+// isTerminal reports whether f is attached to a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}